@@ -0,0 +1,314 @@
+package evaluation
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// compiledCondition holds a condition's filter values parsed ahead of evaluation. Matching against
+// a compiled condition gives the same result as matching against the raw filter values.
+type compiledCondition struct {
+	containsNone bool
+	// resultKey is true if the condition selects the key of a dependency's result, resultFlagKey.
+	resultKey     bool
+	resultFlagKey string
+	// valueSet contains the filter values, for is and set contains any lookups.
+	valueSet map[string]struct{}
+	// booleanSet contains the lowercase filter values which are "true" or "false", which match
+	// property values case insensitively.
+	booleanSet map[string]struct{}
+	// lowerValues are the lowercase filter values, for contains.
+	lowerValues []string
+	// numbers are the filter values which parse as numbers, or nil if none do.
+	numbers []float64
+	// versions are the filter values which parse as versions, or nil if none do.
+	versions []version
+	// regexes are the filter values which compile as regular expressions.
+	regexes []*regexp.Regexp
+}
+
+// Compile parses the filter values of the flag's conditions, so that they are not re-parsed on every
+// evaluation, and merges the metadata of the results each segment may return. It must be called
+// before the flag is shared between goroutines. Conditions which are already compiled are not
+// compiled again.
+func (f *Flag) Compile() {
+	for _, segment := range f.Segments {
+		if segment == nil {
+			continue
+		}
+		if segment.resultMetadata == nil {
+			segment.resultMetadata = make(map[*Variant]map[string]interface{}, len(f.Variants))
+			for _, variant := range f.Variants {
+				if variant != nil {
+					segment.resultMetadata[variant] = mergeMetadata([]map[string]interface{}{f.Metadata, segment.Metadata, variant.Metadata})
+				}
+			}
+		}
+		for _, conditions := range segment.Conditions {
+			for _, condition := range conditions {
+				if condition != nil && condition.compiled == nil {
+					condition.compiled = compileCondition(condition)
+				}
+			}
+		}
+	}
+}
+
+func compileCondition(condition *Condition) *compiledCondition {
+	c := &compiledCondition{containsNone: containsNone(condition.Values)}
+	selector := condition.Selector
+	if len(selector) == 3 && selector[0] == "result" && selector[2] == "key" {
+		c.resultKey = true
+		c.resultFlagKey = selector[1]
+	}
+	switch condition.Op {
+	case OpIs, OpIsNot, OpSetContainsAny, OpSetDoesNotContainAny:
+		c.valueSet = make(map[string]struct{}, len(condition.Values))
+		for _, value := range condition.Values {
+			c.valueSet[value] = struct{}{}
+			lower := strings.ToLower(value)
+			if lower == "true" || lower == "false" {
+				if c.booleanSet == nil {
+					c.booleanSet = make(map[string]struct{}, 2)
+				}
+				c.booleanSet[lower] = struct{}{}
+			}
+		}
+	case OpContains, OpDoesNotContain:
+		c.lowerValues = make([]string, len(condition.Values))
+		for i, value := range condition.Values {
+			c.lowerValues[i] = strings.ToLower(value)
+		}
+	case OpLessThan, OpLessThanEquals, OpGreaterThan, OpGreaterThanEquals:
+		for _, value := range condition.Values {
+			if number, err := strconv.ParseFloat(value, 64); err == nil {
+				c.numbers = append(c.numbers, number)
+			}
+		}
+	case OpVersionLessThan, OpVersionLessThanEquals, OpVersionGreaterThan, OpVersionGreaterThanEquals:
+		for _, value := range condition.Values {
+			if v := parseVersion(value); v != nil {
+				c.versions = append(c.versions, *v)
+			}
+		}
+	case OpRegexMatch, OpRegexDoesNotMatch:
+		for _, value := range condition.Values {
+			if regex, err := regexp.Compile(value); err == nil {
+				c.regexes = append(c.regexes, regex)
+			}
+		}
+	}
+	return c
+}
+
+// match matches the property value selected for the condition. It mirrors Engine.matchCondition.
+func (c *compiledCondition) match(propValue interface{}, op string, filterValues []string) bool {
+	if propValue == nil {
+		return matchNullOp(op, c.containsNone)
+	}
+	if values, ok := propValue.([]interface{}); ok {
+		if result, ok := c.matchInterfaces(values, op, filterValues); ok {
+			return result
+		}
+	}
+	propValueStringList, _ := coerceStringList(propValue)
+	if isSetOperator(op) {
+		if propValueStringList == nil {
+			return false
+		}
+		switch op {
+		case OpSetContainsAny:
+			return c.matchesSetContainsAny(propValueStringList)
+		case OpSetDoesNotContainAny:
+			return !c.matchesSetContainsAny(propValueStringList)
+		default:
+			return matchSet(propValueStringList, op, filterValues)
+		}
+	}
+	if propValueStringList != nil {
+		for _, v := range propValueStringList {
+			if c.matchString(v, op, filterValues) {
+				return true
+			}
+		}
+		return false
+	}
+	if c.numbers != nil {
+		if propValueNumber, ok := numberValue(propValue); ok {
+			switch op {
+			case OpLessThan, OpLessThanEquals, OpGreaterThan, OpGreaterThanEquals:
+				return compareNumber(propValueNumber, op, c.numbers)
+			}
+		}
+	}
+	propValueString, ok := coerceStringValue(propValue)
+	if !ok {
+		return false
+	}
+	return c.matchString(propValueString, op, filterValues)
+}
+
+// matchInterfaces matches a list property value like match, without converting it to a list of
+// strings. It returns false if the list or operator is not handled.
+func (c *compiledCondition) matchInterfaces(values []interface{}, op string, filterValues []string) (bool, bool) {
+	switch op {
+	case OpSetIs, OpSetIsNot, OpSetContains, OpSetDoesNotContain:
+		return false, false
+	}
+	// Lists without non-nil values are not coerced to lists.
+	hasValue := false
+	for _, value := range values {
+		if value != nil {
+			hasValue = true
+			break
+		}
+	}
+	if !hasValue {
+		return false, false
+	}
+	matched := false
+	for _, value := range values {
+		propValue, ok := coerceStringValue(value)
+		if !ok {
+			continue
+		}
+		if op == OpSetContainsAny || op == OpSetDoesNotContainAny {
+			matched = c.matchesIs(propValue)
+		} else {
+			matched = c.matchString(propValue, op, filterValues)
+		}
+		if matched {
+			break
+		}
+	}
+	if op == OpSetDoesNotContainAny {
+		return !matched, true
+	}
+	return matched, true
+}
+
+// matchResultKey matches the key of a dependency's result like match, without storing it in an
+// interface.
+func (c *compiledCondition) matchResultKey(target *target, op string, filterValues []string) bool {
+	key := target.result[c.resultFlagKey].Key
+	if strings.HasPrefix(key, "[") {
+		return c.match(key, op, filterValues)
+	}
+	if isSetOperator(op) {
+		return false
+	}
+	return c.matchString(key, op, filterValues)
+}
+
+// numberValue returns the value of numeric property values. Numbers compare the same as their string
+// formatting parsed.
+func numberValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func (c *compiledCondition) matchString(propValue string, op string, filterValues []string) bool {
+	switch op {
+	case OpIs:
+		return c.matchesIs(propValue)
+	case OpIsNot:
+		return !c.matchesIs(propValue)
+	case OpContains:
+		return c.matchesContains(propValue)
+	case OpDoesNotContain:
+		return !c.matchesContains(propValue)
+	case OpLessThan, OpLessThanEquals, OpGreaterThan, OpGreaterThanEquals:
+		if c.numbers != nil {
+			if propValueNumber, err := strconv.ParseFloat(propValue, 64); err == nil {
+				return compareNumber(propValueNumber, op, c.numbers)
+			}
+		}
+		return compareString(propValue, op, filterValues)
+	case OpVersionLessThan, OpVersionLessThanEquals, OpVersionGreaterThan,
+		OpVersionGreaterThanEquals:
+		return c.compareVersion(propValue, op, filterValues)
+	case OpRegexMatch:
+		return c.matchesRegex(propValue)
+	case OpRegexDoesNotMatch:
+		return !c.matchesRegex(propValue)
+	default:
+		return false
+	}
+}
+
+// matchesIs is equivalent to matchesIs(propValue, filterValues).
+func (c *compiledCondition) matchesIs(propValue string) bool {
+	if _, ok := c.valueSet[propValue]; ok {
+		return true
+	}
+	if c.booleanSet != nil {
+		_, ok := c.booleanSet[strings.ToLower(propValue)]
+		return ok
+	}
+	return false
+}
+
+// matchesSetContainsAny is equivalent to matchesSetContainsAny(propValues, filterValues).
+func (c *compiledCondition) matchesSetContainsAny(propValues []string) bool {
+	for _, propValue := range propValues {
+		if c.matchesIs(propValue) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compiledCondition) matchesContains(propValue string) bool {
+	propValueLower := strings.ToLower(propValue)
+	for _, filterValueLower := range c.lowerValues {
+		if strings.Contains(propValueLower, filterValueLower) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compiledCondition) compareVersion(propValue string, op string, filterValues []string) bool {
+	propValueVersion, ok := parseVersionValue(propValue)
+	if !ok || c.versions == nil {
+		return compareString(propValue, op, filterValues)
+	}
+	for _, filterValueVersion := range c.versions {
+		compareResult := versionCompare(propValueVersion, filterValueVersion)
+		var result bool
+		switch op {
+		case OpVersionLessThan:
+			result = compareResult < 0
+		case OpVersionLessThanEquals:
+			result = compareResult <= 0
+		case OpVersionGreaterThan:
+			result = compareResult > 0
+		case OpVersionGreaterThanEquals:
+			result = compareResult >= 0
+		}
+		if result {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compiledCondition) matchesRegex(propValue string) bool {
+	for _, regex := range c.regexes {
+		if regex.MatchString(propValue) {
+			return true
+		}
+	}
+	return false
+}
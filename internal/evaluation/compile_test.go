@@ -0,0 +1,72 @@
+package evaluation
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+)
+
+func TestCompiledConditionMatchesUncompiled(t *testing.T) {
+	compileEngine := NewEngine(logger.New(logger.Error, logger.NewDefault()))
+	conditions := []*Condition{
+		{Op: OpIs, Values: []string{"a", "b"}},
+		{Op: OpIs, Values: []string{"TRUE"}},
+		{Op: OpIs, Values: []string{"(none)"}},
+		{Op: OpIsNot, Values: []string{"a", "false"}},
+		{Op: OpContains, Values: []string{"AB", "z"}},
+		{Op: OpDoesNotContain, Values: []string{"ab"}},
+		{Op: OpLessThan, Values: []string{"10", "x"}},
+		{Op: OpLessThanEquals, Values: []string{"b"}},
+		{Op: OpGreaterThan, Values: []string{"1.5"}},
+		{Op: OpGreaterThanEquals, Values: []string{"10", "(none)"}},
+		{Op: OpVersionLessThan, Values: []string{"2.0.0"}},
+		{Op: OpVersionLessThanEquals, Values: []string{"1.2.3", "x"}},
+		{Op: OpVersionGreaterThan, Values: []string{"not a version"}},
+		{Op: OpVersionGreaterThanEquals, Values: []string{"1.10"}},
+		{Op: OpSetIs, Values: []string{"a", "b"}},
+		{Op: OpSetIsNot, Values: []string{"a"}},
+		{Op: OpSetContains, Values: []string{"a", "true"}},
+		{Op: OpSetDoesNotContain, Values: []string{"c"}},
+		{Op: OpSetContainsAny, Values: []string{"b", "FALSE"}},
+		{Op: OpSetDoesNotContainAny, Values: []string{"a", "(none)"}},
+		{Op: OpRegexMatch, Values: []string{"^a.*", "["}},
+		{Op: OpRegexDoesNotMatch, Values: []string{"b$"}},
+		{Op: "unknown", Values: []string{"a"}},
+	}
+	propValues := []interface{}{
+		nil, "a", "b", "ab", "ABC", "true", "False", "5", "10", "10.5", "1.2.3", "1.10.0", "2.0.0-beta",
+		13, 1.5, true, false, []string{"a", "b"}, []interface{}{"a", true, 10}, []interface{}{}, []interface{}{nil}, []interface{}{nil, "b", 1.5, "FALSE"}, `["a","c"]`, []string{},
+		map[string]interface{}{"a": "b"},
+	}
+	for _, condition := range conditions {
+		condition.Selector = []string{"context", "value"}
+		compiled := &Condition{Selector: condition.Selector, Op: condition.Op, Values: condition.Values}
+		(&Flag{Segments: []*Segment{{Conditions: [][]*Condition{{compiled}}}}}).Compile()
+		if compiled.compiled == nil {
+			t.Fatalf("condition %v was not compiled", condition)
+		}
+		for _, propValue := range propValues {
+			target := &target{context: map[string]interface{}{"value": propValue}}
+			expected := compileEngine.matchCondition(target, condition)
+			actual := compileEngine.matchCondition(target, compiled)
+			if expected != actual {
+				t.Errorf("%s %v with %s: expected %v, got %v", condition.Op, condition.Values, fmt.Sprintf("%#v", propValue), expected, actual)
+			}
+		}
+	}
+	// Conditions on the keys of dependencies' results.
+	for _, condition := range conditions {
+		condition := &Condition{Selector: []string{"result", "dep", "key"}, Op: condition.Op, Values: condition.Values}
+		compiled := &Condition{Selector: condition.Selector, Op: condition.Op, Values: condition.Values}
+		(&Flag{Segments: []*Segment{{Conditions: [][]*Condition{{compiled}}}}}).Compile()
+		for _, result := range []map[string]Variant{{}, {"dep": {Key: "a"}}, {"dep": {Key: "true"}}, {"dep": {Key: `["a","c"]`}}} {
+			target := &target{result: result}
+			expected := compileEngine.matchCondition(target, condition)
+			actual := compileEngine.matchCondition(target, compiled)
+			if expected != actual {
+				t.Errorf("%s %v with result %v: expected %v, got %v", condition.Op, condition.Values, result, expected, actual)
+			}
+		}
+	}
+}
@@ -5,106 +5,134 @@ import (
 )
 
 func UserToContext(user *experiment.User) map[string]interface{} {
+	return (&ContextBuilder{}).Build(user)
+}
+
+// ContextBuilder builds evaluation contexts like UserToContext. Each context is built by updating
+// the maps of the previous context in place, so that building contexts for similar users allocates
+// little or nothing. A context is only valid until the next call to Build, and a ContextBuilder
+// must not be used concurrently.
+type ContextBuilder struct {
+	context map[string]interface{}
+	user    map[string]interface{}
+	groups  map[string]interface{}
+}
+
+func (b *ContextBuilder) Build(user *experiment.User) map[string]interface{} {
 	if user == nil {
 		return nil
 	}
-	context := make(map[string]interface{})
-	userMap := make(map[string]interface{})
-
-	if len(user.UserId) != 0 {
-		userMap["user_id"] = user.UserId
-	}
-	if len(user.DeviceId) != 0 {
-		userMap["device_id"] = user.DeviceId
-	}
-	if len(user.Country) != 0 {
-		userMap["country"] = user.Country
-	}
-	if len(user.Region) != 0 {
-		userMap["region"] = user.Region
-	}
-	if len(user.Dma) != 0 {
-		userMap["dma"] = user.Dma
-	}
-	if len(user.City) != 0 {
-		userMap["city"] = user.City
-	}
-	if len(user.Language) != 0 {
-		userMap["language"] = user.Language
-	}
-	if len(user.Platform) != 0 {
-		userMap["platform"] = user.Platform
-	}
-	if len(user.Version) != 0 {
-		userMap["version"] = user.Version
-	}
-	if len(user.Os) != 0 {
-		userMap["os"] = user.Os
-	}
-	if len(user.DeviceManufacturer) != 0 {
-		userMap["device_manufacturer"] = user.DeviceManufacturer
-	}
-	if len(user.DeviceBrand) != 0 {
-		userMap["device_brand"] = user.DeviceBrand
-	}
-	if len(user.DeviceModel) != 0 {
-		userMap["device_model"] = user.DeviceModel
-	}
-	if len(user.Carrier) != 0 {
-		userMap["carrier"] = user.Carrier
-	}
-	if len(user.Library) != 0 {
-		userMap["library"] = user.Library
-	}
+	if b.context == nil {
+		b.context = make(map[string]interface{}, 2)
+		b.user = make(map[string]interface{})
+		b.groups = make(map[string]interface{})
+	}
+	userMap := b.user
+	setNonEmptyString(userMap, "user_id", user.UserId)
+	setNonEmptyString(userMap, "device_id", user.DeviceId)
+	setNonEmptyString(userMap, "country", user.Country)
+	setNonEmptyString(userMap, "region", user.Region)
+	setNonEmptyString(userMap, "dma", user.Dma)
+	setNonEmptyString(userMap, "city", user.City)
+	setNonEmptyString(userMap, "language", user.Language)
+	setNonEmptyString(userMap, "platform", user.Platform)
+	setNonEmptyString(userMap, "version", user.Version)
+	setNonEmptyString(userMap, "os", user.Os)
+	setNonEmptyString(userMap, "device_manufacturer", user.DeviceManufacturer)
+	setNonEmptyString(userMap, "device_brand", user.DeviceBrand)
+	setNonEmptyString(userMap, "device_model", user.DeviceModel)
+	setNonEmptyString(userMap, "carrier", user.Carrier)
+	setNonEmptyString(userMap, "library", user.Library)
 	if len(user.UserProperties) != 0 {
 		userMap["user_properties"] = user.UserProperties
+	} else {
+		delete(userMap, "user_properties")
 	}
 	if len(user.Groups) != 0 {
 		userMap["groups"] = user.Groups
+	} else {
+		delete(userMap, "groups")
 	}
 	if len(user.CohortIds) != 0 {
-		userMap["cohort_ids"] = extractKeys(user.CohortIds)
+		setKeys(userMap, "cohort_ids", user.CohortIds)
+	} else {
+		delete(userMap, "cohort_ids")
 	}
 
-	context["user"] = userMap
+	b.context["user"] = userMap
+	b.buildGroups(user)
+	if len(b.groups) > 0 {
+		b.context["groups"] = b.groups
+	} else {
+		delete(b.context, "groups")
+	}
+	return b.context
+}
 
-	if user.Groups == nil {
-		return context
+func (b *ContextBuilder) buildGroups(user *experiment.User) {
+	for groupType := range b.groups {
+		if len(user.Groups[groupType]) == 0 {
+			delete(b.groups, groupType)
+		}
 	}
-
-	groups := make(map[string]interface{})
 	for groupType, groupNames := range user.Groups {
-		if len(groupNames) > 0 {
-			groupName := groupNames[0]
-			groupNameMap := map[string]interface{}{
-				"group_name": groupName,
-			}
-
-			if user.GroupProperties != nil {
-				if groupPropertiesType, ok := user.GroupProperties[groupType]; ok {
-					if groupPropertiesName, ok := groupPropertiesType[groupName]; ok {
-						groupNameMap["group_properties"] = groupPropertiesName
-					}
-				}
-			}
+		if len(groupNames) == 0 {
+			continue
+		}
+		groupName := groupNames[0]
+		groupNameMap, _ := b.groups[groupType].(map[string]interface{})
+		if groupNameMap == nil {
+			groupNameMap = make(map[string]interface{}, 3)
+			b.groups[groupType] = groupNameMap
+		}
+		setString(groupNameMap, "group_name", groupName)
 
-			if user.GroupCohortIds != nil {
-				if groupCohortIdsType, ok := user.GroupCohortIds[groupType]; ok {
-					if groupCohortIdsName, ok := groupCohortIdsType[groupName]; ok {
-						groupNameMap["cohort_ids"] = extractKeys(groupCohortIdsName)
-					}
-				}
-			}
+		groupProperties, ok := user.GroupProperties[groupType][groupName]
+		if ok {
+			groupNameMap["group_properties"] = groupProperties
+		} else {
+			delete(groupNameMap, "group_properties")
+		}
 
-			groups[groupType] = groupNameMap
+		groupCohortIds, ok := user.GroupCohortIds[groupType][groupName]
+		if ok {
+			setKeys(groupNameMap, "cohort_ids", groupCohortIds)
+		} else {
+			delete(groupNameMap, "cohort_ids")
 		}
 	}
+}
+
+// setString sets the value, unless the map already contains it. Storing a string in a map of
+// interfaces allocates.
+func setString(m map[string]interface{}, key string, value string) {
+	if existing, ok := m[key].(string); ok && existing == value {
+		return
+	}
+	m[key] = value
+}
 
-	if len(groups) > 0 {
-		context["groups"] = groups
+// setNonEmptyString sets the value, or deletes the key if the value is empty.
+func setNonEmptyString(m map[string]interface{}, key string, value string) {
+	if len(value) == 0 {
+		delete(m, key)
+		return
 	}
+	setString(m, key, value)
+}
 
-	return context
+// setKeys sets the keys of the set as a list, reusing the list already in the map if it has the same
+// length.
+func setKeys(m map[string]interface{}, key string, set map[string]struct{}) {
+	if existing, ok := m[key].([]string); ok && len(existing) == len(set) {
+		i := 0
+		for k := range set {
+			existing[i] = k
+			i++
+		}
+		return
+	}
+	m[key] = extractKeys(set)
 }
 
 func extractKeys(m map[string]struct{}) []string {
@@ -0,0 +1,83 @@
+package evaluation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+)
+
+func TestUserToContext(t *testing.T) {
+	user := &experiment.User{
+		UserId:         "user_id",
+		Country:        "country",
+		UserProperties: map[string]interface{}{"k": "v"},
+		CohortIds:      map[string]struct{}{"c": {}},
+		Groups:         map[string][]string{"org": {"org name"}, "empty": {}},
+		GroupProperties: map[string]map[string]interface{}{
+			"org": {"org name": map[string]interface{}{"gk": "gv"}},
+		},
+		GroupCohortIds: map[string]map[string]map[string]struct{}{
+			"org": {"org name": {"gc": {}}},
+		},
+	}
+	expected := map[string]interface{}{
+		"user": map[string]interface{}{
+			"user_id":         "user_id",
+			"country":         "country",
+			"user_properties": map[string]interface{}{"k": "v"},
+			"groups":          map[string][]string{"org": {"org name"}, "empty": {}},
+			"cohort_ids":      []string{"c"},
+		},
+		"groups": map[string]interface{}{
+			"org": map[string]interface{}{
+				"group_name":       "org name",
+				"group_properties": map[string]interface{}{"gk": "gv"},
+				"cohort_ids":       []string{"gc"},
+			},
+		},
+	}
+	if actual := UserToContext(user); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v, actual %v", expected, actual)
+	}
+	if actual := UserToContext(nil); actual != nil {
+		t.Fatalf("expected nil, actual %v", actual)
+	}
+}
+
+func TestContextBuilderReuse(t *testing.T) {
+	users := []*experiment.User{
+		{
+			UserId:         "1",
+			DeviceId:       "device",
+			Platform:       "iOS",
+			UserProperties: map[string]interface{}{"k": "v"},
+			CohortIds:      map[string]struct{}{"a": {}},
+			Groups:         map[string][]string{"org": {"org 1"}, "team": {"team 1"}},
+			GroupProperties: map[string]map[string]interface{}{
+				"org": {"org 1": map[string]interface{}{"gk": "gv"}},
+			},
+			GroupCohortIds: map[string]map[string]map[string]struct{}{
+				"team": {"team 1": {"c": {}}},
+			},
+		},
+		{
+			UserId:    "2",
+			Platform:  "iOS",
+			CohortIds: map[string]struct{}{"c": {}},
+			Groups:    map[string][]string{"org": {"org 2"}},
+		},
+		{UserId: "3", Groups: map[string][]string{"org": {}}},
+		{DeviceId: "device"},
+	}
+	builder := &ContextBuilder{}
+	for i := 0; i < 2; i++ {
+		for _, user := range users {
+			expected := UserToContext(user)
+			actual := builder.Build(user)
+			if !reflect.DeepEqual(expected, actual) {
+				t.Fatalf("expected %v, actual %v", expected, actual)
+			}
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type Engine struct {
@@ -18,6 +19,16 @@ type Engine struct {
 type target struct {
 	context map[string]interface{}
 	result  map[string]Variant
+	// sharedMetadata is true if results may share the metadata merged when the flags were compiled.
+	sharedMetadata bool
+	// buffer is reused to build the keys hashed when bucketing.
+	buffer []byte
+}
+
+var targetPool = sync.Pool{
+	New: func() interface{} {
+		return &target{}
+	},
 }
 
 func NewEngine(log *logger.Logger) *Engine {
@@ -25,63 +36,156 @@ func NewEngine(log *logger.Logger) *Engine {
 }
 
 func (e *Engine) Evaluate(context map[string]interface{}, flags []*Flag) map[string]Variant {
-	e.log.Debug("Evaluating %v flags with context %v", len(flags), context)
 	results := make(map[string]Variant)
-	target := &target{context, results}
+	e.evaluate(&target{context: context, result: results}, flags, "")
+	return results
+}
+
+// EvaluateInto evaluates the flags like Evaluate, writing the results into results, which is cleared
+// first. Buffers are reused between calls, so that evaluating compiled flags against property values
+// of common types does not allocate. The metadata of the results is shared between calls and must not
+// be modified.
+func (e *Engine) EvaluateInto(context map[string]interface{}, flags []*Flag, results map[string]Variant) {
+	clear(results)
+	target := targetPool.Get().(*target)
+	target.context = context
+	target.result = results
+	target.sharedMetadata = true
+	e.evaluate(target, flags, "")
+	target.context = nil
+	target.result = nil
+	targetPool.Put(target)
+}
+
+// EvaluateWithTrace evaluates the flags like Evaluate, and also returns a trace of the evaluation
+// of the flag with the given key, or nil if the flag is not in flags.
+func (e *Engine) EvaluateWithTrace(context map[string]interface{}, flags []*Flag, flagKey string) (map[string]Variant, *Trace) {
+	results := make(map[string]Variant)
+	trace := e.evaluate(&target{context: context, result: results}, flags, flagKey)
+	return results, trace
+}
+
+func (e *Engine) evaluate(target *target, flags []*Flag, traceFlagKey string) *Trace {
+	if e.log.Enabled(logger.Debug) {
+		e.log.Debug("Evaluating %v flags with context %v", len(flags), target.context)
+	}
+	var trace *Trace
 	for _, flag := range flags {
+		var flagTrace *Trace
+		if traceFlagKey != "" && flag.Key == traceFlagKey {
+			flagTrace = newTrace(target, flag)
+			trace = flagTrace
+		}
 		// Evaluate flag and update results
-		variant := e.evaluateFlag(target, flag)
-		if variant != nil {
-			results[flag.Key] = *variant
-		} else {
+		variant, ok := e.evaluateFlag(target, flag, flagTrace)
+		if ok {
+			target.result[flag.Key] = variant
+		} else if e.log.Enabled(logger.Debug) {
 			e.log.Debug("Flag %v evaluation returned nil result", flag.Key)
 		}
 	}
-	e.log.Debug("Evaluation completed. %v", results)
-	return results
+	if e.log.Enabled(logger.Debug) {
+		e.log.Debug("Evaluation completed. %v", target.result)
+	}
+	return trace
+}
+
+func newTrace(target *target, flag *Flag) *Trace {
+	trace := &Trace{FlagKey: flag.Key, Segments: make([]*SegmentTrace, 0, len(flag.Segments))}
+	for _, dependency := range flag.Dependencies {
+		dependencyTrace := &DependencyTrace{FlagKey: dependency}
+		if variant, ok := target.result[dependency]; ok {
+			dependencyTrace.Variant = &variant
+		}
+		trace.Dependencies = append(trace.Dependencies, dependencyTrace)
+	}
+	return trace
 }
 
-func (e *Engine) evaluateFlag(target *target, flag *Flag) *Variant {
-	e.log.Verbose("Evaluating flag %v with target %v", flag, target)
-	var result *Variant
-	for _, segment := range flag.Segments {
-		result = e.evaluateSegment(target, flag, segment)
-		if result != nil {
+// evaluateFlag evaluates the flag for the target, recording the evaluation in trace if non-nil.
+// It returns false if no variant was assigned.
+func (e *Engine) evaluateFlag(target *target, flag *Flag, trace *Trace) (Variant, bool) {
+	if e.log.Enabled(logger.Verbose) {
+		e.log.Verbose("Evaluating flag %v with target %v", flag, target)
+	}
+	var result Variant
+	matched := false
+	for i, segment := range flag.Segments {
+		var segmentTrace *SegmentTrace
+		if trace != nil {
+			segmentTrace = &SegmentTrace{Index: i, Metadata: segment.Metadata}
+			trace.Segments = append(trace.Segments, segmentTrace)
+		}
+		variant := e.evaluateSegment(target, flag, segment, segmentTrace)
+		if variant != nil {
 			// Merge all metadata into the result
-			metadata := mergeMetadata([]map[string]interface{}{flag.Metadata, segment.Metadata, result.Metadata})
-			result = &Variant{result.Key, result.Value, result.Payload, metadata}
-			e.log.Verbose("Flag evaluation returned result %v on segment %v", result, segment)
+			result = Variant{variant.Key, variant.Value, variant.Payload, resultMetadata(target, flag, segment, variant)}
+			matched = true
+			if e.log.Enabled(logger.Verbose) {
+				e.log.Verbose("Flag evaluation returned result %v on segment %v", result, segment)
+			}
 			break
 		}
 	}
-	return result
+	if trace != nil && matched {
+		variant := result
+		trace.Variant = &variant
+	}
+	return result, matched
+}
+
+// resultMetadata returns the flag, segment and variant metadata merged, or nil if there is none.
+func resultMetadata(target *target, flag *Flag, segment *Segment, variant *Variant) map[string]interface{} {
+	if target.sharedMetadata && segment.resultMetadata != nil {
+		if metadata, ok := segment.resultMetadata[variant]; ok {
+			return metadata
+		}
+	}
+	return mergeMetadata([]map[string]interface{}{flag.Metadata, segment.Metadata, variant.Metadata})
 }
 
-func (e *Engine) evaluateSegment(target *target, flag *Flag, segment *Segment) *Variant {
-	e.log.Verbose("Evaluating segment %v with target %")
+func (e *Engine) evaluateSegment(target *target, flag *Flag, segment *Segment, trace *SegmentTrace) *Variant {
+	if e.log.Enabled(logger.Verbose) {
+		e.log.Verbose("Evaluating segment %v with target %v", segment, target)
+	}
 	if segment.Conditions == nil {
 		e.log.Verbose("Segment conditions are nil, bucketing target")
 		// Null conditions always match
-		variantKey := e.bucket(target, segment)
+		variantKey := e.bucket(target, segment, trace)
 		return flag.Variants[variantKey]
 	}
 	// Outer list logic is "or" (||)
 	for _, conditions := range segment.Conditions {
 		match := true
+		var conditionTraces []*ConditionTrace
 		// Inner list logic is "and" (&&)
 		for _, condition := range conditions {
 			match = e.matchCondition(target, condition)
+			if trace != nil {
+				conditionTraces = append(conditionTraces, &ConditionTrace{
+					Selector:      condition.Selector,
+					Op:            condition.Op,
+					Values:        condition.Values,
+					PropertyValue: selectEach(target, condition.Selector),
+					Matched:       match,
+				})
+			}
 			if !match {
-				e.log.Verbose("Segment condition %v did not match target", condition)
+				if e.log.Enabled(logger.Verbose) {
+					e.log.Verbose("Segment condition %v did not match target", condition)
+				}
 				break
-			} else {
+			} else if e.log.Enabled(logger.Verbose) {
 				e.log.Verbose("Segment condition %v matched target", condition)
 			}
 		}
+		if trace != nil {
+			trace.Conditions = append(trace.Conditions, conditionTraces)
+		}
 		// On match bucket the user
 		if match {
 			e.log.Verbose("Segment conditions matched, bucketing target")
-			variantKey := e.bucket(target, segment)
+			variantKey := e.bucket(target, segment, trace)
 			return flag.Variants[variantKey]
 		}
 	}
@@ -89,7 +193,13 @@ func (e *Engine) evaluateSegment(target *target, flag *Flag, segment *Segment) *
 }
 
 func (e *Engine) matchCondition(target *target, condition *Condition) bool {
+	if condition.compiled != nil && condition.compiled.resultKey {
+		return condition.compiled.matchResultKey(target, condition.Op, condition.Values)
+	}
 	propValue := selectEach(target, condition.Selector)
+	if condition.compiled != nil {
+		return condition.compiled.match(propValue, condition.Op, condition.Values)
+	}
 	if propValue == nil {
 		return matchNull(condition.Op, condition.Values)
 	}
@@ -118,26 +228,61 @@ func (e *Engine) getHash(key string) uint64 {
 	return uint64(murmur3.Sum32WithSeed([]byte(key), 0))
 }
 
-func (e *Engine) bucket(target *target, segment *Segment) string {
-	e.log.Verbose("Bucketing segment %v with target %v", segment, target)
+// bucket selects the variant key for a matched segment, recording the bucketing in trace if non-nil.
+func (e *Engine) bucket(target *target, segment *Segment, trace *SegmentTrace) string {
+	variantKey := e.bucketVariant(target, segment, trace)
+	if trace != nil {
+		trace.Matched = true
+		trace.VariantKey = variantKey
+	}
+	return variantKey
+}
+
+func (e *Engine) bucketVariant(target *target, segment *Segment, trace *SegmentTrace) string {
+	if e.log.Enabled(logger.Verbose) {
+		e.log.Verbose("Bucketing segment %v with target %v", segment, target)
+	}
 	if segment.Bucket == nil {
 		// A nil bucket means the segment is fully rolled out. Select the default variant.
-		e.log.Verbose("Segment bucket is nil, returning default variant %v", segment.Variant)
+		if e.log.Enabled(logger.Verbose) {
+			e.log.Verbose("Segment bucket is nil, returning default variant %v", segment.Variant)
+		}
 		return segment.Variant
 	}
 	// Select the bucketing value
-	bucketingValue := coerceString(selectEach(target, segment.Bucket.Selector))
-	e.log.Verbose("Selected bucketing value %v from target", bucketingValue)
-	if bucketingValue == nil || len(*bucketingValue) == 0 {
+	bucketingValue, ok := coerceStringValue(selectEach(target, segment.Bucket.Selector))
+	if e.log.Enabled(logger.Verbose) {
+		e.log.Verbose("Selected bucketing value %v from target", bucketingValue)
+	}
+	var bucketTrace *BucketTrace
+	if trace != nil {
+		bucketTrace = &BucketTrace{
+			Selector: segment.Bucket.Selector,
+			Salt:     segment.Bucket.Salt,
+		}
+		if ok {
+			tracedValue := bucketingValue
+			bucketTrace.BucketingValue = &tracedValue
+		}
+		trace.Bucket = bucketTrace
+	}
+	if !ok || len(bucketingValue) == 0 {
 		// A nil or empty bucketing value cannot be bucketed. Select the default variant.
 		e.log.Verbose("Selected bucketing value is nil or empty")
 		return segment.Variant
 	}
 	// Salt and hash the value, and compute the allocation and distribution values.
-	keyToHash := fmt.Sprintf("%v/%v", segment.Bucket.Salt, *bucketingValue)
-	hash := e.getHash(keyToHash)
+	target.buffer = append(target.buffer[:0], segment.Bucket.Salt...)
+	target.buffer = append(target.buffer, '/')
+	target.buffer = append(target.buffer, bucketingValue...)
+	hash := uint64(murmur3.Sum32WithSeed(target.buffer, 0))
 	allocationValue := hash % 100
 	distributionValue := hash / 100
+	if bucketTrace != nil {
+		bucketTrace.Hash = hash
+		bucketTrace.AllocationValue = allocationValue
+		bucketTrace.DistributionValue = distributionValue
+	}
 	for _, allocation := range segment.Bucket.Allocations {
 		allocationStart := allocation.Range[0]
 		allocationEnd := allocation.Range[1]
@@ -146,7 +291,13 @@ func (e *Engine) bucket(target *target, segment *Segment) string {
 				distributionStart := distribution.Range[0]
 				distributionEnd := distribution.Range[1]
 				if distributionValue >= distributionStart && distributionValue < distributionEnd {
-					e.log.Verbose("Bucketing hit allocation and distribution, returning variant %v", distribution.Variant)
+					if e.log.Enabled(logger.Verbose) {
+						e.log.Verbose("Bucketing hit allocation and distribution, returning variant %v", distribution.Variant)
+					}
+					if bucketTrace != nil {
+						bucketTrace.Allocation = allocation
+						bucketTrace.Distribution = distribution
+					}
 					return distribution.Variant
 				}
 			}
@@ -170,7 +321,10 @@ func mergeMetadata(metadata []map[string]interface{}) map[string]interface{} {
 }
 
 func matchNull(op string, filterValues []string) bool {
-	containsNone := containsNone(filterValues)
+	return matchNullOp(op, containsNone(filterValues))
+}
+
+func matchNullOp(op string, containsNone bool) bool {
 	switch op {
 	case OpIs, OpContains, OpLessThan, OpLessThanEquals, OpGreaterThan,
 		OpGreaterThanEquals, OpVersionLessThan, OpVersionLessThanEquals,
@@ -464,26 +618,58 @@ func containsBooleans(filterValues []string) bool {
 }
 
 func coerceString(value interface{}) *string {
-	if value == nil {
+	s, ok := coerceStringValue(value)
+	if !ok {
 		return nil
 	}
+	return &s
+}
+
+// coerceStringValue converts the value to a string like coerceString, without reflection or
+// allocation for strings, booleans and numbers. It returns false if the value is nil.
+func coerceStringValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int:
+		return strconv.Itoa(v), true
+	case int32:
+		return strconv.FormatInt(int64(v), 10), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	}
 	kind := reflect.TypeOf(value).Kind()
 	if kind == reflect.Map || kind == reflect.Slice || kind == reflect.Array {
 		b, err := json.Marshal(value)
 		if err == nil {
-			s := string(b)
-			return &s
+			return string(b), true
 		}
 	}
-	s := fmt.Sprintf("%v", value)
-	return &s
+	return fmt.Sprintf("%v", value), true
 }
 
 func coerceStringList(value interface{}) ([]string, error) {
 	// Convert a list to a list of strings
-	_, ok := value.([]string)
-	if ok {
-		return value.([]string), nil
+	switch v := value.(type) {
+	case []string:
+		return v, nil
+	case string:
+		if !strings.HasPrefix(v, "[") {
+			return nil, nil
+		}
+	case bool, int, int32, int64, uint64, float32, float64:
+		// Scalars other than strings never format as JSON arrays.
+		return nil, nil
 	}
 	// Fall back to reflection for slices with unexpected value types
 	kind := reflect.TypeOf(value).Kind()
@@ -0,0 +1,109 @@
+//go:build !race
+
+package evaluation
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+)
+
+// Buffers are pooled, and sync.Pool drops pooled values at random under the race detector, so
+// allocations are not measured with it enabled.
+
+const allocsFlagsJson = `[
+  {
+    "key": "targeted",
+    "metadata": {"flagType": "release"},
+    "variants": {"on": {"key": "on", "value": "on"}, "off": {"key": "off", "metadata": {"default": true}}},
+    "segments": [
+      {"conditions": [[{"selector": ["context", "user", "country"], "op": "is", "values": ["US", "CA"]}]], "variant": "on"},
+      {"conditions": [[{"selector": ["context", "user", "user_properties", "tags"], "op": "set contains any", "values": ["beta"]}]], "variant": "on"},
+      {"conditions": [[{"selector": ["context", "user", "user_properties", "seats"], "op": "greater", "values": ["100"]}]], "variant": "on"},
+      {"variant": "off"}
+    ]
+  },
+  {
+    "key": "rollout",
+    "dependencies": ["targeted"],
+    "variants": {"control": {"key": "control", "value": "control"}, "treatment": {"key": "treatment", "value": "treatment"}},
+    "segments": [
+      {
+        "conditions": [[{"selector": ["result", "targeted", "key"], "op": "is", "values": ["off"]}]],
+        "bucket": {
+          "selector": ["context", "user", "user_id"],
+          "salt": "salt",
+          "allocations": [{"range": [0, 100], "distributions": [{"variant": "control", "range": [0, 21474837]}, {"variant": "treatment", "range": [21474837, 42949673]}]}]
+        },
+        "metadata": {"segmentName": "rollout"}
+      }
+    ]
+  }
+]`
+
+func newAllocsFlags(t *testing.T) []*Flag {
+	var flags []*Flag
+	if err := json.Unmarshal([]byte(allocsFlagsJson), &flags); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, flag := range flags {
+		flag.Compile()
+	}
+	return flags
+}
+
+func TestEvaluateIntoAllocs(t *testing.T) {
+	flags := newAllocsFlags(t)
+	allocsEngine := NewEngine(logger.New(logger.Error, logger.NewDefault()))
+	user := &experiment.User{
+		UserId:   "user_id",
+		DeviceId: "device_id",
+		Country:  "GB",
+		UserProperties: map[string]interface{}{
+			"tags":  []string{"alpha"},
+			"seats": float64(42),
+		},
+	}
+	builder := &ContextBuilder{}
+	results := make(map[string]Variant)
+	evaluate := func() {
+		allocsEngine.EvaluateInto(builder.Build(user), flags, results)
+	}
+	evaluate()
+	if results["targeted"].Key != "off" || results["rollout"].Key == "" || results["rollout"].Metadata["segmentName"] != "rollout" {
+		t.Fatalf("unexpected results %v", results)
+	}
+	if allocs := testing.AllocsPerRun(100, evaluate); allocs != 0 {
+		t.Fatalf("expected no allocations, got %v", allocs)
+	}
+	// The results match the allocating evaluation.
+	expected := allocsEngine.Evaluate(UserToContext(user), flags)
+	if len(expected) != len(results) {
+		t.Fatalf("expected %v, actual %v", expected, results)
+	}
+	for key, variant := range expected {
+		if results[key].Key != variant.Key || results[key].Value != variant.Value {
+			t.Fatalf("expected %v, actual %v", expected, results)
+		}
+	}
+}
+
+func TestContextBuilderAllocs(t *testing.T) {
+	builder := &ContextBuilder{}
+	users := []*experiment.User{
+		{UserId: "1", Country: "US", Platform: "iOS", Groups: map[string][]string{"org": {"org name"}}},
+		{UserId: "2", Country: "US", Platform: "iOS", Groups: map[string][]string{"org": {"org name"}}},
+	}
+	builder.Build(users[0])
+	// Only the changed user ID is stored in the reused maps.
+	i := 0
+	allocs := testing.AllocsPerRun(100, func() {
+		i++
+		builder.Build(users[i%2])
+	})
+	if allocs > 1 {
+		t.Fatalf("expected at most 1 allocation, got %v", allocs)
+	}
+}
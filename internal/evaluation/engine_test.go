@@ -1007,3 +1007,127 @@ func getFlagConfigsRaw() ([]byte, error) {
 	}
 	return body, nil
 }
+
+func TestCoerceStringValue(t *testing.T) {
+	values := []interface{}{
+		"string", true, false, 0, -12, int32(7), int64(1) << 40, uint64(1) << 63,
+		float32(1.5), 0.1, 42.0, -3.25, 1e21, 1e-7, 123456789.0,
+		[]string{"a"}, map[string]interface{}{"a": 1}, int8(3), struct{}{},
+	}
+	for _, value := range values {
+		expected := coerceString(value)
+		actual, ok := coerceStringValue(value)
+		if !ok || *expected != actual {
+			t.Fatalf("%#v: expected %v, actual %v", value, *expected, actual)
+		}
+		var sprintf string
+		switch value.(type) {
+		case []string, map[string]interface{}:
+			continue
+		default:
+			sprintf = fmt.Sprintf("%v", value)
+		}
+		if sprintf != actual {
+			t.Fatalf("%#v: expected %v, actual %v", value, sprintf, actual)
+		}
+	}
+	if _, ok := coerceStringValue(nil); ok {
+		t.Fatalf("expected nil to not coerce")
+	}
+}
+
+// Benchmarks
+
+func BenchmarkEvaluate(b *testing.B) {
+	context := userContext(map[string]interface{}{
+		"user_id":   "user_id",
+		"device_id": "device_id",
+		"country":   "United States",
+		"platform":  "iOS",
+		"version":   "4.12.1",
+		"email":     "user@example.com",
+		"user_properties": map[string]interface{}{
+			"plan":        "enterprise",
+			"seats":       "42",
+			"beta_tester": "true",
+			"tags":        []interface{}{"alpha", "beta", "gamma"},
+		},
+	})
+	b.Run("uncompiled", func(b *testing.B) {
+		benchmarkFlags := newBenchmarkFlags(100)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = engine.Evaluate(context, benchmarkFlags)
+		}
+	})
+	b.Run("compiled", func(b *testing.B) {
+		benchmarkFlags := newBenchmarkFlags(100)
+		for _, flag := range benchmarkFlags {
+			flag.Compile()
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = engine.Evaluate(context, benchmarkFlags)
+		}
+	})
+	b.Run("compiled into", func(b *testing.B) {
+		benchmarkFlags := newBenchmarkFlags(100)
+		for _, flag := range benchmarkFlags {
+			flag.Compile()
+		}
+		results := make(map[string]Variant)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			engine.EvaluateInto(context, benchmarkFlags, results)
+		}
+	})
+}
+
+// newBenchmarkFlags returns flags targeting segments with a mix of operators, none of which match
+// the benchmark context, so that every condition of every flag is evaluated.
+func newBenchmarkFlags(count int) []*Flag {
+	countries := make([]string, 50)
+	for i := range countries {
+		countries[i] = fmt.Sprintf("Country %d", i)
+	}
+	result := make([]*Flag, count)
+	for i := range result {
+		n := strconv.Itoa(i)
+		result[i] = &Flag{
+			Key: "flag-" + n,
+			Variants: map[string]*Variant{
+				"off": {Key: "off"},
+				"on":  {Key: "on", Value: "on"},
+			},
+			Segments: []*Segment{
+				{
+					Conditions: [][]*Condition{
+						{{Selector: []string{"context", "user", "country"}, Op: OpIs, Values: countries}},
+						{{Selector: []string{"context", "user", "email"}, Op: OpRegexMatch, Values: []string{`^.+@amplitude\.com$`, `^qa-` + n}}},
+					},
+					Variant: "on",
+				},
+				{
+					Conditions: [][]*Condition{{
+						{Selector: []string{"context", "user", "version"}, Op: OpVersionGreaterThanEquals, Values: []string{"5.0.0"}},
+						{Selector: []string{"context", "user", "platform"}, Op: OpIs, Values: []string{"iOS", "Android"}},
+					}},
+					Variant: "on",
+				},
+				{
+					Conditions: [][]*Condition{{
+						{Selector: []string{"context", "user", "user_properties", "seats"}, Op: OpGreaterThan, Values: []string{"100", "1000"}},
+					}, {
+						{Selector: []string{"context", "user", "user_properties", "tags"}, Op: OpSetContainsAny, Values: []string{"delta", "epsilon", n}},
+					}, {
+						{Selector: []string{"context", "user", "user_properties", "beta_tester"}, Op: OpIs, Values: []string{"false"}},
+					}},
+					Variant: "on",
+				},
+				{Variant: "off"},
+			},
+		}
+	}
+	return result
+}
@@ -0,0 +1,59 @@
+package evaluation
+
+// Trace explains how a flag was evaluated for a context.
+type Trace struct {
+	FlagKey string `json:"flagKey"`
+	// Variant is the result of the evaluation, or nil if no variant was assigned.
+	Variant *Variant `json:"variant"`
+	// Dependencies are the results of the flag's dependencies, evaluated before the flag.
+	Dependencies []*DependencyTrace `json:"dependencies,omitempty"`
+	// Segments are the segments evaluated, in order, up to and including the matching segment.
+	Segments []*SegmentTrace `json:"segments"`
+}
+
+// DependencyTrace is the result of a dependency flag consulted during evaluation.
+type DependencyTrace struct {
+	FlagKey string `json:"flagKey"`
+	// Variant is the dependency's result, or nil if no variant was assigned.
+	Variant *Variant `json:"variant"`
+}
+
+// SegmentTrace explains the evaluation of a segment.
+type SegmentTrace struct {
+	Index    int                    `json:"index"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// Conditions are the evaluated condition groups. Conditions in a group are evaluated until one
+	// does not match, and groups are evaluated until one matches.
+	Conditions [][]*ConditionTrace `json:"conditions,omitempty"`
+	// Matched is true if the segment's conditions matched the context.
+	Matched bool `json:"matched"`
+	// Bucket is the bucketing of a matched segment.
+	Bucket *BucketTrace `json:"bucket,omitempty"`
+	// VariantKey is the key of the variant selected by a matched segment.
+	VariantKey string `json:"variantKey,omitempty"`
+}
+
+// ConditionTrace explains the evaluation of a condition.
+type ConditionTrace struct {
+	Selector []string `json:"selector"`
+	Op       string   `json:"op"`
+	Values   []string `json:"values"`
+	// PropertyValue is the value selected from the context, or nil if not set.
+	PropertyValue interface{} `json:"propertyValue"`
+	Matched       bool        `json:"matched"`
+}
+
+// BucketTrace explains the bucketing of a context into a variant.
+type BucketTrace struct {
+	Selector []string `json:"selector"`
+	Salt     string   `json:"salt"`
+	// BucketingValue is the value selected from the context, or nil if not set.
+	BucketingValue    *string `json:"bucketingValue"`
+	Hash              uint64  `json:"hash"`
+	AllocationValue   uint64  `json:"allocationValue"`
+	DistributionValue uint64  `json:"distributionValue"`
+	// Allocation and Distribution are the allocation and distribution hit, or nil if none was hit and
+	// the segment's default variant was selected.
+	Allocation   *Allocation   `json:"allocation,omitempty"`
+	Distribution *Distribution `json:"distribution,omitempty"`
+}
@@ -0,0 +1,93 @@
+package evaluation
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+)
+
+const traceFlagsJson = `[
+  {"key": "dep", "variants": {"on": {"key": "on", "value": "on"}}, "segments": [{"variant": "on"}]},
+  {
+    "key": "main",
+    "dependencies": ["dep"],
+    "variants": {"control": {"key": "control", "value": "control"}, "treatment": {"key": "treatment", "value": "treatment"}},
+    "segments": [
+      {"conditions": [[{"selector": ["context", "user", "country"], "op": "is", "values": ["US"]}]], "variant": "treatment"},
+      {
+        "metadata": {"segmentName": "dependency on"},
+        "conditions": [[{"selector": ["result", "dep", "key"], "op": "is", "values": ["on"]}]],
+        "bucket": {
+          "selector": ["context", "user", "user_id"],
+          "salt": "salt",
+          "allocations": [{"range": [0, 100], "distributions": [{"variant": "treatment", "range": [0, 42949673]}]}]
+        },
+        "variant": "control"
+      }
+    ]
+  }
+]`
+
+func TestEvaluateWithTrace(t *testing.T) {
+	var traceFlags []*Flag
+	if err := json.Unmarshal([]byte(traceFlagsJson), &traceFlags); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	traceEngine := NewEngine(logger.New(logger.Error, logger.NewDefault()))
+	context := map[string]interface{}{"user": map[string]interface{}{"user_id": "user", "country": "CA"}}
+
+	results, trace := traceEngine.EvaluateWithTrace(context, traceFlags, "main")
+	if results["main"].Key != "treatment" {
+		t.Fatalf("unexpected result %v", results["main"])
+	}
+	if trace == nil || trace.FlagKey != "main" || trace.Variant == nil || trace.Variant.Key != "treatment" {
+		t.Fatalf("unexpected trace %+v", trace)
+	}
+	if len(trace.Dependencies) != 1 || trace.Dependencies[0].FlagKey != "dep" || trace.Dependencies[0].Variant.Key != "on" {
+		t.Fatalf("unexpected dependencies %+v", trace.Dependencies)
+	}
+	if len(trace.Segments) != 2 {
+		t.Fatalf("expected 2 segments, got %d", len(trace.Segments))
+	}
+
+	segment := trace.Segments[0]
+	if segment.Matched || segment.Bucket != nil || len(segment.Conditions) != 1 || len(segment.Conditions[0]) != 1 {
+		t.Fatalf("unexpected first segment %+v", segment)
+	}
+	condition := segment.Conditions[0][0]
+	if condition.Matched || condition.PropertyValue != "CA" || condition.Op != OpIs {
+		t.Fatalf("unexpected first segment condition %+v", condition)
+	}
+
+	segment = trace.Segments[1]
+	if !segment.Matched || segment.VariantKey != "treatment" || segment.Metadata["segmentName"] != "dependency on" {
+		t.Fatalf("unexpected second segment %+v", segment)
+	}
+	condition = segment.Conditions[0][0]
+	if !condition.Matched || condition.PropertyValue != "on" {
+		t.Fatalf("unexpected second segment condition %+v", condition)
+	}
+	bucket := segment.Bucket
+	hash := traceEngine.getHash("salt/user")
+	if bucket == nil || *bucket.BucketingValue != "user" || bucket.Hash != hash ||
+		bucket.AllocationValue != hash%100 || bucket.DistributionValue != hash/100 ||
+		bucket.Distribution == nil || bucket.Distribution.Variant != "treatment" {
+		t.Fatalf("unexpected bucket %+v", bucket)
+	}
+
+	// Traces are JSON serializable.
+	if _, err := json.Marshal(trace); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The untraced evaluation is unchanged, and flags not evaluated are not traced.
+	untraced := traceEngine.Evaluate(context, traceFlags)
+	if untraced["main"].Key != "treatment" {
+		t.Fatalf("unexpected result %v", untraced["main"])
+	}
+	_, trace = traceEngine.EvaluateWithTrace(context, traceFlags, "missing")
+	if trace != nil {
+		t.Fatalf("expected nil trace, got %+v", trace)
+	}
+}
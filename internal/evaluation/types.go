@@ -20,6 +20,8 @@ type Segment struct {
 	Conditions [][]*Condition         `json:"conditions,omitempty"`
 	Variant    string                 `json:"variant,omitempty"`
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	// resultMetadata is the merged metadata of each variant of the flag, set when the flag is compiled.
+	resultMetadata map[*Variant]map[string]interface{}
 }
 
 type Bucket struct {
@@ -32,6 +34,7 @@ type Condition struct {
 	Selector []string `json:"selector,omitempty"`
 	Op       string   `json:"op,omitempty"`
 	Values   []string `json:"values,omitempty"`
+	compiled *compiledCondition
 }
 
 type Allocation struct {
@@ -1,7 +1,6 @@
 package evaluation
 
 import (
-	"regexp"
 	"strconv"
 )
 
@@ -12,29 +11,80 @@ type version struct {
 	preRelease string
 }
 
-const versionPattern = "^(\\d+)\\.(\\d+)(\\.(\\d+)(-(([-\\w]+\\.?)*))?)?$"
-
-var regex, _ = regexp.Compile(versionPattern)
-
+// parseVersion parses versions matching ^(\d+)\.(\d+)(\.(\d+)(-(([-\w]+\.?)*))?)?$, or returns nil.
 func parseVersion(versionString string) *version {
-	if len(versionString) == 0 {
+	v, ok := parseVersionValue(versionString)
+	if !ok {
 		return nil
 	}
-	matchGroup := regex.FindStringSubmatch(versionString)
-	if matchGroup == nil {
-		return nil
+	return &v
+}
+
+// parseVersionValue parses the version like parseVersion, without allocating.
+func parseVersionValue(versionString string) (version, bool) {
+	var v version
+	rest := versionString
+	major, rest, ok := cutDigits(rest)
+	if !ok || len(rest) == 0 || rest[0] != '.' {
+		return v, false
 	}
-	major, err := strconv.Atoi(matchGroup[1])
-	if err != nil {
-		return nil
+	minor, rest, ok := cutDigits(rest[1:])
+	if !ok {
+		return v, false
 	}
-	minor, err := strconv.Atoi(matchGroup[2])
-	if err != nil {
-		return nil
+	var patch string
+	if len(rest) > 0 {
+		if rest[0] != '.' {
+			return v, false
+		}
+		patch, rest, ok = cutDigits(rest[1:])
+		if !ok {
+			return v, false
+		}
+		if len(rest) > 0 {
+			if rest[0] != '-' || !isPreRelease(rest[1:]) {
+				return v, false
+			}
+			// The pre-release includes the hyphen.
+			v.preRelease = rest
+		}
+	}
+	var err error
+	if v.major, err = strconv.Atoi(major); err != nil {
+		return v, false
+	}
+	if v.minor, err = strconv.Atoi(minor); err != nil {
+		return v, false
+	}
+	v.patch, _ = strconv.Atoi(patch)
+	return v, true
+}
+
+// cutDigits returns the leading ASCII digits of s, which must not be empty, and the rest of s.
+func cutDigits(s string) (string, string, bool) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i], s[i:], i > 0
+}
+
+// isPreRelease reports whether s matches ([-\w]+\.?)*: word characters and hyphens, with each dot
+// following one of them.
+func isPreRelease(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '.':
+			if i == 0 || s[i-1] == '.' {
+				return false
+			}
+		case c == '-' || c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		default:
+			return false
+		}
 	}
-	patch, _ := strconv.Atoi(matchGroup[4])
-	preRelease := matchGroup[5]
-	return &version{major, minor, patch, preRelease}
+	return true
 }
 
 func versionCompare(v1, v2 version) int {
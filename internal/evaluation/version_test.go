@@ -1,6 +1,9 @@
 package evaluation
 
 import (
+	"math/rand"
+	"regexp"
+	"strconv"
 	"testing"
 )
 
@@ -100,6 +103,39 @@ func TestVersionComparison(t *testing.T) {
 	assertVersionComparison(t, "20.5.6-b1.2.x", OpVersionGreaterThan, "20.5.5")
 }
 
+func TestParseVersionMatchesPattern(t *testing.T) {
+	pattern := regexp.MustCompile(`^(\d+)\.(\d+)(\.(\d+)(-(([-\w]+\.?)*))?)?$`)
+	versions := []string{
+		"", "1", "1.", "1.2", "1.2.", "1.2.3", "1.2.3-", "1.2.3-alpha", "1.2.3-alpha.1", "1.2.3-alpha..1",
+		"1.2.3-.alpha", "1.2.3-a_b-c.", "1.2.3.4", "01.002.0003", "99999999999999999999.1", "1.2.99999999999999999999",
+		"1.2-alpha", "1.2.3+build", "1.2.3-al pha", "1.2.3-é",
+	}
+	random := rand.New(rand.NewSource(1))
+	alphabet := "0123456789.-_a"
+	for i := 0; i < 10000; i++ {
+		b := make([]byte, random.Intn(10))
+		for j := range b {
+			b[j] = alphabet[random.Intn(len(alphabet))]
+		}
+		versions = append(versions, string(b))
+	}
+	for _, ver := range versions {
+		var expected *version
+		if matchGroup := pattern.FindStringSubmatch(ver); matchGroup != nil {
+			major, majorErr := strconv.Atoi(matchGroup[1])
+			minor, minorErr := strconv.Atoi(matchGroup[2])
+			patch, _ := strconv.Atoi(matchGroup[4])
+			if majorErr == nil && minorErr == nil {
+				expected = &version{major, minor, patch, matchGroup[5]}
+			}
+		}
+		actual := parseVersion(ver)
+		if (expected == nil) != (actual == nil) || (expected != nil && *expected != *actual) {
+			t.Fatalf("%q: expected %v, actual %v", ver, expected, actual)
+		}
+	}
+}
+
 func assertInvalidVersion(t *testing.T, ver string) {
 	if parseVersion(ver) != nil {
 		t.Fatalf("expected invalid version %v", ver)
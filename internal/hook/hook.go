@@ -0,0 +1,80 @@
+// Package hook calls the experiment.Hook hooks of the local and remote clients.
+package hook
+
+import (
+	"context"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+)
+
+// Before calls BeforeEvaluate on each hook in order, passing each hook the user returned by the
+// previous one, and returns the user returned by the last hook. Hooks which implement
+// experiment.ContextHook are called with the context instead.
+func Before(ctx context.Context, log *logger.Logger, hooks []experiment.Hook, user *experiment.User) *experiment.User {
+	for _, h := range hooks {
+		user = before(ctx, log, h, user)
+	}
+	return user
+}
+
+// After calls AfterEvaluate on each hook in reverse order. Hooks which implement
+// experiment.ContextHook are called with the context instead. The metadata of each variant is
+// copied first, since it may be shared with compiled flags or cached variants.
+func After(ctx context.Context, log *logger.Logger, hooks []experiment.Hook, user *experiment.User, variants map[string]experiment.Variant, err error) {
+	if len(hooks) == 0 {
+		return
+	}
+	copyMetadata(variants)
+	for i := len(hooks) - 1; i >= 0; i-- {
+		after(ctx, log, hooks[i], user, variants, err)
+	}
+}
+
+func before(ctx context.Context, log *logger.Logger, h experiment.Hook, user *experiment.User) (result *experiment.User) {
+	result = user
+	defer func() {
+		if r := recover(); r != nil {
+			log.ErrorContext(ctx, "evaluation hook %T panicked before evaluation: %v", h, r)
+			result = user
+		}
+	}()
+	var hookUser *experiment.User
+	if ch, ok := h.(experiment.ContextHook); ok {
+		hookUser = ch.BeforeEvaluateContext(ctx, user)
+	} else {
+		hookUser = h.BeforeEvaluate(user)
+	}
+	if hookUser != nil {
+		result = hookUser
+	}
+	return result
+}
+
+func after(ctx context.Context, log *logger.Logger, h experiment.Hook, user *experiment.User, variants map[string]experiment.Variant, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.ErrorContext(ctx, "evaluation hook %T panicked after evaluation: %v", h, r)
+		}
+	}()
+	if ch, ok := h.(experiment.ContextHook); ok {
+		ch.AfterEvaluateContext(ctx, user, variants, err)
+		return
+	}
+	h.AfterEvaluate(user, variants, err)
+}
+
+// copyMetadata replaces the metadata of each variant with a copy.
+func copyMetadata(variants map[string]experiment.Variant) {
+	for key, variant := range variants {
+		if variant.Metadata == nil {
+			continue
+		}
+		metadata := make(map[string]interface{}, len(variant.Metadata))
+		for k, v := range variant.Metadata {
+			metadata[k] = v
+		}
+		variant.Metadata = metadata
+		variants[key] = variant
+	}
+}
@@ -0,0 +1,120 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type testHook struct {
+	name   string
+	calls  *[]string
+	before func(user *experiment.User) *experiment.User
+	after  func(variants map[string]experiment.Variant)
+}
+
+func (h *testHook) BeforeEvaluate(user *experiment.User) *experiment.User {
+	*h.calls = append(*h.calls, "before "+h.name)
+	if h.before != nil {
+		return h.before(user)
+	}
+	return nil
+}
+
+func (h *testHook) AfterEvaluate(_ *experiment.User, variants map[string]experiment.Variant, _ error) {
+	*h.calls = append(*h.calls, "after "+h.name)
+	if h.after != nil {
+		h.after(variants)
+	}
+}
+
+func TestHookOrder(t *testing.T) {
+	log := logger.New(logger.Error, logger.NewDefault())
+	var calls []string
+	hooks := []experiment.Hook{
+		&testHook{name: "1", calls: &calls, before: func(user *experiment.User) *experiment.User {
+			return &experiment.User{UserId: user.UserId, DeviceId: "device_id"}
+		}},
+		&testHook{name: "2", calls: &calls, before: func(user *experiment.User) *experiment.User {
+			user.Country = "US"
+			return user
+		}},
+		&testHook{name: "3", calls: &calls},
+	}
+	user := &experiment.User{UserId: "user_id"}
+	result := Before(context.Background(), log, hooks, user)
+	assert.Equal(t, &experiment.User{UserId: "user_id", DeviceId: "device_id", Country: "US"}, result)
+	assert.Equal(t, &experiment.User{UserId: "user_id"}, user)
+
+	After(context.Background(), log, hooks, result, nil, errors.New("failed"))
+	assert.Equal(t, []string{"before 1", "before 2", "before 3", "after 3", "after 2", "after 1"}, calls)
+}
+
+func TestHookPanic(t *testing.T) {
+	log := logger.New(logger.Disable, logger.NewDefault())
+	var calls []string
+	hooks := []experiment.Hook{
+		&testHook{name: "1", calls: &calls, after: func(variants map[string]experiment.Variant) {
+			variants["flag"] = experiment.Variant{Key: "override"}
+		}},
+		&testHook{name: "2", calls: &calls,
+			before: func(*experiment.User) *experiment.User { panic("before") },
+			after:  func(map[string]experiment.Variant) { panic("after") },
+		},
+	}
+	user := &experiment.User{UserId: "user_id"}
+	assert.Same(t, user, Before(context.Background(), log, hooks, user))
+
+	variants := map[string]experiment.Variant{"flag": {Key: "on"}}
+	After(context.Background(), log, hooks, user, variants, nil)
+	assert.Equal(t, "override", variants["flag"].Key)
+	assert.Equal(t, []string{"before 1", "before 2", "after 2", "after 1"}, calls)
+}
+
+type testContextKey struct{}
+
+// testContextHook records the context value passed to it.
+type testContextHook struct {
+	testHook
+	values []interface{}
+}
+
+func (h *testContextHook) BeforeEvaluateContext(ctx context.Context, user *experiment.User) *experiment.User {
+	h.values = append(h.values, ctx.Value(testContextKey{}))
+	return h.BeforeEvaluate(user)
+}
+
+func (h *testContextHook) AfterEvaluateContext(ctx context.Context, user *experiment.User, variants map[string]experiment.Variant, err error) {
+	h.values = append(h.values, ctx.Value(testContextKey{}))
+	h.AfterEvaluate(user, variants, err)
+}
+
+func TestContextHook(t *testing.T) {
+	log := logger.New(logger.Disable, logger.NewDefault())
+	var calls []string
+	contextHook := &testContextHook{testHook: testHook{name: "context", calls: &calls}}
+	hooks := []experiment.Hook{contextHook, &testHook{name: "plain", calls: &calls}}
+	ctx := context.WithValue(context.Background(), testContextKey{}, "value")
+	user := Before(ctx, log, hooks, &experiment.User{UserId: "user_id"})
+	After(ctx, log, hooks, user, nil, nil)
+	assert.Equal(t, []string{"before context", "before plain", "after plain", "after context"}, calls)
+	assert.Equal(t, []interface{}{"value", "value"}, contextHook.values)
+}
+
+func TestHookMetadataCopy(t *testing.T) {
+	log := logger.New(logger.Error, logger.NewDefault())
+	var calls []string
+	hooks := []experiment.Hook{&testHook{name: "1", calls: &calls, after: func(variants map[string]experiment.Variant) {
+		variants["flag"].Metadata["traceId"] = "trace"
+	}}}
+	shared := map[string]interface{}{"flagType": "experiment"}
+	variants := map[string]experiment.Variant{"flag": {Key: "on", Metadata: shared}, "other": {Key: "off"}}
+	After(context.Background(), log, hooks, &experiment.User{}, variants, nil)
+	assert.Equal(t, map[string]interface{}{"flagType": "experiment", "traceId": "trace"}, variants["flag"].Metadata)
+	assert.Equal(t, map[string]interface{}{"flagType": "experiment"}, shared)
+	assert.Nil(t, variants["other"].Metadata)
+}
@@ -0,0 +1,163 @@
+// Package variation decodes the variants of evaluated flags into typed values, for the typed
+// variation methods of the local and remote clients.
+//
+// The variant's payload is decoded if it is set, otherwise its value is parsed. Errors are
+// *experiment.VariationError.
+package variation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+)
+
+// Lookup returns the variant for the flag, or an error if the flag was not evaluated or is off.
+func Lookup(variants map[string]experiment.Variant, flagKey string) (experiment.Variant, error) {
+	variant, ok := variants[flagKey]
+	if !ok {
+		return variant, &experiment.VariationError{FlagKey: flagKey, Reason: experiment.VariationFlagNotFound}
+	}
+	isDefault, _ := variant.Metadata["default"].(bool)
+	isDeployed, ok := variant.Metadata["deployed"].(bool)
+	if !ok {
+		isDeployed = true
+	}
+	if variant.Key == "" || isDefault || !isDeployed {
+		return variant, &experiment.VariationError{FlagKey: flagKey, Reason: experiment.VariationFlagOff}
+	}
+	return variant, nil
+}
+
+func Bool(variants map[string]experiment.Variant, flagKey string, defaultValue bool) (bool, error) {
+	variant, err := Lookup(variants, flagKey)
+	if err != nil {
+		return defaultValue, err
+	}
+	if variant.Payload != nil {
+		if value, ok := variant.Payload.(bool); ok {
+			return value, nil
+		}
+		return defaultValue, mismatch(flagKey, fmt.Errorf("payload %v is not a bool", variant.Payload))
+	}
+	value, err := strconv.ParseBool(variant.Value)
+	if err != nil {
+		return defaultValue, mismatch(flagKey, err)
+	}
+	return value, nil
+}
+
+func String(variants map[string]experiment.Variant, flagKey string, defaultValue string) (string, error) {
+	variant, err := Lookup(variants, flagKey)
+	if err != nil {
+		return defaultValue, err
+	}
+	if variant.Payload != nil {
+		if value, ok := variant.Payload.(string); ok {
+			return value, nil
+		}
+		return defaultValue, mismatch(flagKey, fmt.Errorf("payload %v is not a string", variant.Payload))
+	}
+	return variant.Value, nil
+}
+
+func Int(variants map[string]experiment.Variant, flagKey string, defaultValue int) (int, error) {
+	variant, err := Lookup(variants, flagKey)
+	if err != nil {
+		return defaultValue, err
+	}
+	if variant.Payload != nil {
+		var value float64
+		switch payload := variant.Payload.(type) {
+		case int:
+			return payload, nil
+		case int64:
+			value = float64(payload)
+		case float64:
+			value = payload
+		default:
+			return defaultValue, mismatch(flagKey, fmt.Errorf("payload %v is not a number", variant.Payload))
+		}
+		if value != math.Trunc(value) || value < math.MinInt || value >= -math.MinInt {
+			return defaultValue, mismatch(flagKey, fmt.Errorf("payload %v is not an int", variant.Payload))
+		}
+		return int(value), nil
+	}
+	value, err := strconv.Atoi(variant.Value)
+	if err != nil {
+		return defaultValue, mismatch(flagKey, err)
+	}
+	return value, nil
+}
+
+func Float(variants map[string]experiment.Variant, flagKey string, defaultValue float64) (float64, error) {
+	variant, err := Lookup(variants, flagKey)
+	if err != nil {
+		return defaultValue, err
+	}
+	if variant.Payload != nil {
+		switch payload := variant.Payload.(type) {
+		case float64:
+			return payload, nil
+		case int:
+			return float64(payload), nil
+		case int64:
+			return float64(payload), nil
+		default:
+			return defaultValue, mismatch(flagKey, fmt.Errorf("payload %v is not a number", variant.Payload))
+		}
+	}
+	value, err := strconv.ParseFloat(variant.Value, 64)
+	if err != nil {
+		return defaultValue, mismatch(flagKey, err)
+	}
+	return value, nil
+}
+
+// JSON decodes the variant into target, which must be a non-nil pointer. If the variant cannot be
+// used, defaultValue, if non-nil, is decoded into target instead.
+func JSON(variants map[string]experiment.Variant, flagKey string, defaultValue interface{}, target interface{}) error {
+	return JSONDefault(decodeJSON(variants, flagKey, target), defaultValue, target)
+}
+
+// JSONDefault decodes defaultValue, if non-nil, into target if err is non-nil, and returns err.
+func JSONDefault(err error, defaultValue interface{}, target interface{}) error {
+	if err != nil && defaultValue != nil {
+		if defaultErr := roundTrip(defaultValue, target); defaultErr != nil {
+			return errors.Join(err, fmt.Errorf("decoding default value: %w", defaultErr))
+		}
+	}
+	return err
+}
+
+func decodeJSON(variants map[string]experiment.Variant, flagKey string, target interface{}) error {
+	variant, err := Lookup(variants, flagKey)
+	if err != nil {
+		return err
+	}
+	if variant.Payload != nil {
+		err = roundTrip(variant.Payload, target)
+	} else {
+		err = json.Unmarshal([]byte(variant.Value), target)
+	}
+	if err != nil {
+		return mismatch(flagKey, err)
+	}
+	return nil
+}
+
+// roundTrip decodes the JSON encoding of value into target.
+func roundTrip(value interface{}, target interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+func mismatch(flagKey string, err error) error {
+	return &experiment.VariationError{FlagKey: flagKey, Reason: experiment.VariationTypeMismatch, Err: err}
+}
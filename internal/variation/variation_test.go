@@ -0,0 +1,96 @@
+package variation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/stretchr/testify/assert"
+)
+
+var testVariants = map[string]experiment.Variant{
+	"bool-value":    {Key: "on", Value: "true"},
+	"bool-payload":  {Key: "on", Value: "on", Payload: true},
+	"string-value":  {Key: "treatment", Value: "treatment"},
+	"int-value":     {Key: "on", Value: "42"},
+	"int-payload":   {Key: "on", Value: "on", Payload: float64(7)},
+	"float-payload": {Key: "on", Value: "on", Payload: 2.5},
+	"json-value":    {Key: "on", Value: `{"limit": 3}`},
+	"json-payload":  {Key: "on", Value: "on", Payload: map[string]interface{}{"limit": float64(5)}},
+	"default":       {Key: "off", Metadata: map[string]interface{}{"default": true}},
+	"not-deployed":  {Key: "on", Value: "true", Metadata: map[string]interface{}{"deployed": false}},
+	"empty":         {},
+}
+
+type limitConfig struct {
+	Limit int `json:"limit"`
+}
+
+func assertReason(t *testing.T, err error, reason experiment.VariationErrorReason) {
+	var variationErr *experiment.VariationError
+	if assert.True(t, errors.As(err, &variationErr), "expected a VariationError, got %v", err) {
+		assert.Equal(t, reason, variationErr.Reason)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	b, err := Bool(testVariants, "bool-value", false)
+	assert.NoError(t, err)
+	assert.True(t, b)
+	b, err = Bool(testVariants, "bool-payload", false)
+	assert.NoError(t, err)
+	assert.True(t, b)
+	s, err := String(testVariants, "string-value", "control")
+	assert.NoError(t, err)
+	assert.Equal(t, "treatment", s)
+	i, err := Int(testVariants, "int-value", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, i)
+	i, err = Int(testVariants, "int-payload", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, i)
+	f, err := Float(testVariants, "float-payload", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.5, f)
+	f, err = Float(testVariants, "int-value", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 42.0, f)
+
+	var config limitConfig
+	assert.NoError(t, JSON(testVariants, "json-value", nil, &config))
+	assert.Equal(t, 3, config.Limit)
+	assert.NoError(t, JSON(testVariants, "json-payload", nil, &config))
+	assert.Equal(t, 5, config.Limit)
+}
+
+func TestDecodeDefaults(t *testing.T) {
+	b, err := Bool(testVariants, "missing", true)
+	assert.True(t, b)
+	assertReason(t, err, experiment.VariationFlagNotFound)
+	for _, flagKey := range []string{"default", "not-deployed", "empty"} {
+		s, err := String(testVariants, flagKey, "fallback")
+		assert.Equal(t, "fallback", s)
+		assertReason(t, err, experiment.VariationFlagOff)
+	}
+
+	b, err = Bool(testVariants, "string-value", true)
+	assert.True(t, b)
+	assertReason(t, err, experiment.VariationTypeMismatch)
+	s, err := String(testVariants, "bool-payload", "fallback")
+	assert.Equal(t, "fallback", s)
+	assertReason(t, err, experiment.VariationTypeMismatch)
+	i, err := Int(testVariants, "float-payload", -1)
+	assert.Equal(t, -1, i)
+	assertReason(t, err, experiment.VariationTypeMismatch)
+	f, err := Float(testVariants, "string-value", -1)
+	assert.Equal(t, -1.0, f)
+	assertReason(t, err, experiment.VariationTypeMismatch)
+
+	config := limitConfig{}
+	err = JSON(testVariants, "string-value", limitConfig{Limit: 1}, &config)
+	assertReason(t, err, experiment.VariationTypeMismatch)
+	assert.Equal(t, 1, config.Limit)
+	err = JSONDefault(errors.New("evaluation failed"), map[string]interface{}{"limit": 2}, &config)
+	assert.EqualError(t, err, "evaluation failed")
+	assert.Equal(t, 2, config.Limit)
+}
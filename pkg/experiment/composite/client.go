@@ -0,0 +1,63 @@
+// Package composite provides a client which evaluates flags with a local or remote evaluator, or
+// both in hybrid mode, selected by configuration, so that application code written against
+// experiment.Evaluator can switch evaluation modes without changes.
+package composite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+)
+
+// Client evaluates flags with the evaluator of the configured mode. It implements
+// experiment.Evaluator.
+type Client struct {
+	mode      EvaluationMode
+	evaluator experiment.Evaluator
+}
+
+// NewClient returns a client for the configuration, or an error if the evaluators of the configured
+// mode are not set.
+func NewClient(config *Config) (*Client, error) {
+	if config == nil {
+		return nil, errors.New("composite client requires a config")
+	}
+	var evaluator experiment.Evaluator
+	switch config.Mode {
+	case LocalEvaluationMode:
+		evaluator = config.Local
+	case RemoteEvaluationMode:
+		evaluator = config.Remote
+	case HybridEvaluationMode:
+		if config.Local == nil || config.Remote == nil {
+			return nil, errors.New("hybrid evaluation mode requires a local and a remote evaluator")
+		}
+		metadata, ok := config.Local.(flagMetadataProvider)
+		if !ok {
+			return nil, errors.New("hybrid evaluation mode requires a local evaluator which provides flag metadata")
+		}
+		hybrid := &hybridEvaluator{local: config.Local, metadata: metadata, remote: config.Remote}
+		if config.Hybrid != nil {
+			hybrid.config = *config.Hybrid
+		}
+		evaluator = hybrid
+	default:
+		return nil, fmt.Errorf("unknown evaluation mode %v", config.Mode)
+	}
+	if evaluator == nil {
+		return nil, fmt.Errorf("%v evaluation mode requires a %v evaluator", config.Mode, config.Mode)
+	}
+	return &Client{mode: config.Mode, evaluator: evaluator}, nil
+}
+
+// Mode returns the evaluation mode of the client.
+func (c *Client) Mode() EvaluationMode {
+	return c.mode
+}
+
+// EvaluateWithContext evaluates the flags for the user with the evaluator of the client's mode.
+func (c *Client) EvaluateWithContext(ctx context.Context, user *experiment.User, options *experiment.EvaluateOptions) (map[string]experiment.Variant, error) {
+	return c.evaluator.EvaluateWithContext(ctx, user, options)
+}
@@ -0,0 +1,60 @@
+package composite
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/amplitude/experiment-go-server/pkg/experiment/experimenttest"
+	"github.com/amplitude/experiment-go-server/pkg/experiment/local"
+	"github.com/amplitude/experiment-go-server/pkg/experiment/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ experiment.Evaluator = (*Client)(nil)
+	_ experiment.Evaluator = (*local.Client)(nil)
+	_ experiment.Evaluator = (*remote.Client)(nil)
+)
+
+func TestParseEvaluationMode(t *testing.T) {
+	mode, err := ParseEvaluationMode("local")
+	assert.NoError(t, err)
+	assert.Equal(t, LocalEvaluationMode, mode)
+	mode, err = ParseEvaluationMode(" Remote ")
+	assert.NoError(t, err)
+	assert.Equal(t, RemoteEvaluationMode, mode)
+	mode, err = ParseEvaluationMode("HYBRID")
+	assert.NoError(t, err)
+	assert.Equal(t, HybridEvaluationMode, mode)
+	_, err = ParseEvaluationMode("edge")
+	assert.EqualError(t, err, `unknown evaluation mode "edge"`)
+	assert.Equal(t, "EvaluationMode(7)", EvaluationMode(7).String())
+}
+
+func TestClientEvaluatesWithMode(t *testing.T) {
+	localEvaluator := experimenttest.NewClient(experimenttest.NewFlag("flag").Variant("local", "local").All("local"))
+	remoteEvaluator := experimenttest.NewClient(experimenttest.NewFlag("flag").Variant("remote", "remote").All("remote"))
+	user := &experiment.User{UserId: "user_id"}
+
+	for _, mode := range []EvaluationMode{LocalEvaluationMode, RemoteEvaluationMode} {
+		client, err := NewClient(&Config{Mode: mode, Local: localEvaluator, Remote: remoteEvaluator})
+		require.NoError(t, err)
+		assert.Equal(t, mode, client.Mode())
+		variants, err := client.EvaluateWithContext(context.Background(), user, nil)
+		require.NoError(t, err)
+		assert.Equal(t, mode.String(), variants["flag"].Key)
+	}
+	assert.Equal(t, 1, len(localEvaluator.Evaluations()))
+	assert.Equal(t, 1, len(remoteEvaluator.Evaluations()))
+}
+
+func TestNewClientErrors(t *testing.T) {
+	_, err := NewClient(nil)
+	assert.EqualError(t, err, "composite client requires a config")
+	_, err = NewClient(&Config{Mode: RemoteEvaluationMode, Local: experimenttest.NewClient()})
+	assert.EqualError(t, err, "remote evaluation mode requires a remote evaluator")
+	_, err = NewClient(&Config{Mode: EvaluationMode(7)})
+	assert.EqualError(t, err, "unknown evaluation mode EvaluationMode(7)")
+}
@@ -0,0 +1,79 @@
+package composite
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+)
+
+// EvaluationMode selects how a Client evaluates flags.
+type EvaluationMode int
+
+const (
+	// LocalEvaluationMode evaluates flags with the local evaluator.
+	LocalEvaluationMode EvaluationMode = iota
+	// RemoteEvaluationMode fetches variants with the remote evaluator.
+	RemoteEvaluationMode
+	// HybridEvaluationMode evaluates flags which can be evaluated locally with the local evaluator,
+	// and fetches the variants of the other flags with the remote evaluator, falling back to local
+	// evaluation or fallback variants if the fetch fails. See HybridConfig.
+	HybridEvaluationMode
+)
+
+func (m EvaluationMode) String() string {
+	switch m {
+	case LocalEvaluationMode:
+		return "local"
+	case RemoteEvaluationMode:
+		return "remote"
+	case HybridEvaluationMode:
+		return "hybrid"
+	default:
+		return fmt.Sprintf("EvaluationMode(%d)", int(m))
+	}
+}
+
+// ParseEvaluationMode returns the evaluation mode named "local", "remote" or "hybrid", ignoring case, so that
+// the mode can be read from configuration such as an environment variable.
+func ParseEvaluationMode(name string) (EvaluationMode, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "local":
+		return LocalEvaluationMode, nil
+	case "remote":
+		return RemoteEvaluationMode, nil
+	case "hybrid":
+		return HybridEvaluationMode, nil
+	default:
+		return 0, fmt.Errorf("unknown evaluation mode %q", name)
+	}
+}
+
+// Config is the configuration of a composite Client. Local is usually a local.Client and Remote a
+// remote.Client; only the evaluators of the selected mode are required.
+type Config struct {
+	Mode   EvaluationMode
+	Local  experiment.Evaluator
+	Remote experiment.Evaluator
+	Hybrid *HybridConfig
+}
+
+// HybridConfig is the configuration of the hybrid evaluation mode, which requires both evaluators,
+// and a local evaluator which provides flag metadata, such as local.Client.
+//
+// A flag is evaluated locally if the local evaluator has its config, unless the flag's
+// "evaluationMode" metadata is "remote", as for flags which rely on server-side user enrichment.
+// The variants of all other flags are fetched with the remote evaluator. If the fetch fails or
+// times out, the variants of remote flags known to the local evaluator are evaluated locally from
+// their last known configs, and the FallbackVariants are used for the others.
+type HybridConfig struct {
+	// RemoteTimeout limits the time spent fetching remote variants. Defaults to no limit other than
+	// the remote evaluator's own timeout.
+	RemoteTimeout time.Duration
+	// FallbackVariants are the variants, by flag key, of remote flags which cannot be fetched or
+	// evaluated locally. Flags without a fallback variant are omitted.
+	FallbackVariants map[string]experiment.Variant
+	// OnRemoteError, if set, is called with the error of each failed fetch, before falling back.
+	OnRemoteError func(err error)
+}
@@ -0,0 +1,181 @@
+package composite
+
+import (
+	"context"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+)
+
+// flagMetadataProvider is implemented by local evaluators which can route flags in hybrid mode,
+// such as local.Client.
+type flagMetadataProvider interface {
+	// FlagKeys returns the keys of the flags whose configs are known.
+	FlagKeys() []string
+	// FlagMetadata returns the metadata of the flag's config, or nil if the flag is not known.
+	FlagMetadata(flagKey string) map[string]interface{}
+}
+
+// hybridEvaluator implements the hybrid evaluation mode described by HybridConfig.
+type hybridEvaluator struct {
+	local    experiment.Evaluator
+	metadata flagMetadataProvider
+	remote   experiment.Evaluator
+	config   HybridConfig
+}
+
+// EvaluateWithContext evaluates the flags for the user. Remote variants are fetched before local
+// evaluation, rather than concurrently, since both clients modify the user.
+//
+// When all flags are evaluated, the remote flags cannot be known in advance, so exposures are only
+// tracked for the locally evaluated flags. Request flag keys to track exposures of remote flags.
+func (h *hybridEvaluator) EvaluateWithContext(ctx context.Context, user *experiment.User, options *experiment.EvaluateOptions) (map[string]experiment.Variant, error) {
+	if options == nil {
+		options = &experiment.EvaluateOptions{}
+	}
+	if len(options.FlagKeys) == 0 {
+		return h.evaluateAll(ctx, user, options)
+	}
+	return h.evaluateFlags(ctx, user, options)
+}
+
+func (h *hybridEvaluator) evaluateAll(ctx context.Context, user *experiment.User, options *experiment.EvaluateOptions) (map[string]experiment.Variant, error) {
+	remoteVariants, remoteErr := h.fetch(ctx, user, &experiment.EvaluateOptions{})
+	// Only local flags are evaluated locally, so that remote flags are not tracked with variants
+	// which are discarded, unless the remote variants are unavailable.
+	var localKeys []string
+	for _, key := range h.metadata.FlagKeys() {
+		if remoteErr != nil || h.isLocalFlag(key) {
+			localKeys = append(localKeys, key)
+		}
+	}
+	variants, err := h.evaluateLocal(ctx, user, localKeys, options.TracksExposure)
+	if err != nil {
+		return nil, err
+	}
+	if remoteErr != nil {
+		h.putFallbackVariants(variants, nil)
+		return variants, nil
+	}
+	for key, variant := range remoteVariants {
+		if _, ok := variants[key]; ok || h.isLocalFlag(key) {
+			continue
+		}
+		variants[key] = variant
+	}
+	return variants, nil
+}
+
+func (h *hybridEvaluator) evaluateFlags(ctx context.Context, user *experiment.User, options *experiment.EvaluateOptions) (map[string]experiment.Variant, error) {
+	var localKeys, remoteKeys []string
+	for _, key := range options.FlagKeys {
+		if h.isLocalFlag(key) {
+			localKeys = append(localKeys, key)
+		} else {
+			remoteKeys = append(remoteKeys, key)
+		}
+	}
+	var remoteVariants map[string]experiment.Variant
+	var remoteErr error
+	if len(remoteKeys) > 0 {
+		remoteVariants, remoteErr = h.fetch(ctx, user, &experiment.EvaluateOptions{
+			FlagKeys:       remoteKeys,
+			TracksExposure: options.TracksExposure,
+		})
+		if remoteErr != nil {
+			// Evaluate the remote flags known locally from their last known configs.
+			for _, key := range remoteKeys {
+				if h.metadata.FlagMetadata(key) != nil {
+					localKeys = append(localKeys, key)
+				}
+			}
+		}
+	}
+	variants, err := h.evaluateLocal(ctx, user, localKeys, options.TracksExposure)
+	if err != nil {
+		return nil, err
+	}
+	if remoteErr != nil {
+		h.putFallbackVariants(variants, remoteKeys)
+		return variants, nil
+	}
+	for key, variant := range remoteVariants {
+		if _, ok := variants[key]; !ok {
+			variants[key] = variant
+		}
+	}
+	return variants, nil
+}
+
+// evaluateLocal evaluates the flag keys with the local evaluator. No flags are evaluated if there
+// are no flag keys, rather than all flags.
+func (h *hybridEvaluator) evaluateLocal(ctx context.Context, user *experiment.User, flagKeys []string, tracksExposure bool) (map[string]experiment.Variant, error) {
+	variants := make(map[string]experiment.Variant, len(flagKeys))
+	if len(flagKeys) == 0 {
+		return variants, nil
+	}
+	localVariants, err := h.local.EvaluateWithContext(ctx, user, &experiment.EvaluateOptions{
+		FlagKeys:       flagKeys,
+		TracksExposure: tracksExposure,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for key, variant := range localVariants {
+		variants[key] = variant
+	}
+	return variants, nil
+}
+
+// fetch fetches remote variants, limited by the remote timeout, and reports any error.
+func (h *hybridEvaluator) fetch(ctx context.Context, user *experiment.User, options *experiment.EvaluateOptions) (map[string]experiment.Variant, error) {
+	if h.config.RemoteTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.config.RemoteTimeout)
+		defer cancel()
+	}
+	variants, err := h.remote.EvaluateWithContext(ctx, user, options)
+	if err == nil {
+		// A context which is done without the remote evaluator noticing is still a timeout.
+		err = ctx.Err()
+	}
+	if err != nil {
+		if h.config.OnRemoteError != nil {
+			h.config.OnRemoteError(err)
+		}
+		return nil, err
+	}
+	return variants, nil
+}
+
+// putFallbackVariants puts the fallback variants of the flag keys, or of all flags if flagKeys is
+// nil, which have no variant.
+func (h *hybridEvaluator) putFallbackVariants(variants map[string]experiment.Variant, flagKeys []string) {
+	if flagKeys == nil {
+		for key, variant := range h.config.FallbackVariants {
+			if _, ok := variants[key]; !ok {
+				variants[key] = variant
+			}
+		}
+		return
+	}
+	for _, key := range flagKeys {
+		if _, ok := variants[key]; ok {
+			continue
+		}
+		if variant, ok := h.config.FallbackVariants[key]; ok {
+			variants[key] = variant
+		}
+	}
+}
+
+// isLocalFlag reports whether the flag is known to the local evaluator and can be evaluated locally.
+func (h *hybridEvaluator) isLocalFlag(flagKey string) bool {
+	metadata := h.metadata.FlagMetadata(flagKey)
+	return metadata != nil && !isRemoteFlag(metadata)
+}
+
+// isRemoteFlag reports whether the flag metadata requires remote evaluation.
+func isRemoteFlag(metadata map[string]interface{}) bool {
+	evaluationMode, _ := metadata["evaluationMode"].(string)
+	return evaluationMode == "remote"
+}
@@ -0,0 +1,130 @@
+package composite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/amplitude/experiment-go-server/pkg/experiment/experimenttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingEvaluator blocks until the context is done.
+type blockingEvaluator struct{}
+
+func (blockingEvaluator) EvaluateWithContext(ctx context.Context, _ *experiment.User, _ *experiment.EvaluateOptions) (map[string]experiment.Variant, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func newTestHybridEvaluators() (*experimenttest.Client, *experimenttest.Client) {
+	localEvaluator := experimenttest.NewClient(
+		experimenttest.NewFlag("local-flag").Metadata("evaluationMode", "local").Variant("local", "local").All("local"),
+		experimenttest.NewFlag("remote-flag").Metadata("evaluationMode", "remote").Variant("stale", "stale").All("stale"),
+	)
+	remoteEvaluator := experimenttest.NewClient(
+		experimenttest.NewFlag("local-flag").Variant("remote", "remote").All("remote"),
+		experimenttest.NewFlag("remote-flag").Variant("fresh", "fresh").All("fresh"),
+		experimenttest.NewFlag("server-flag").Variant("server", "server").All("server"),
+	)
+	return localEvaluator, remoteEvaluator
+}
+
+func variantKeys(variants map[string]experiment.Variant) map[string]string {
+	keys := make(map[string]string, len(variants))
+	for flagKey, variant := range variants {
+		keys[flagKey] = variant.Key
+	}
+	return keys
+}
+
+func TestHybridEvaluation(t *testing.T) {
+	localEvaluator, remoteEvaluator := newTestHybridEvaluators()
+	client, err := NewClient(&Config{Mode: HybridEvaluationMode, Local: localEvaluator, Remote: remoteEvaluator})
+	require.NoError(t, err)
+	user := &experiment.User{UserId: "user_id"}
+	expected := map[string]string{"local-flag": "local", "remote-flag": "fresh", "server-flag": "server"}
+
+	// Remote flags are not evaluated, or tracked, locally.
+	variants, err := client.EvaluateWithContext(context.Background(), user, &experiment.EvaluateOptions{TracksExposure: true})
+	require.NoError(t, err)
+	assert.Equal(t, expected, variantKeys(variants))
+	exposures := localEvaluator.Exposures()
+	require.Equal(t, 1, len(exposures))
+	assert.Equal(t, "local-flag", exposures[0].FlagKey)
+
+	options := &experiment.EvaluateOptions{FlagKeys: []string{"local-flag", "remote-flag", "server-flag"}, TracksExposure: true}
+	variants, err = client.EvaluateWithContext(context.Background(), user, options)
+	require.NoError(t, err)
+	assert.Equal(t, expected, variantKeys(variants))
+	evaluations := remoteEvaluator.Evaluations()
+	require.Equal(t, 2, len(evaluations))
+	assert.Equal(t, experiment.EvaluateOptions{}, evaluations[0].Options)
+	assert.Equal(t, experiment.EvaluateOptions{FlagKeys: []string{"remote-flag", "server-flag"}, TracksExposure: true}, evaluations[1].Options)
+	evaluations = localEvaluator.Evaluations()
+	require.Equal(t, 2, len(evaluations))
+	assert.Equal(t, experiment.EvaluateOptions{FlagKeys: []string{"local-flag"}, TracksExposure: true}, evaluations[0].Options)
+	assert.Equal(t, experiment.EvaluateOptions{FlagKeys: []string{"local-flag"}, TracksExposure: true}, evaluations[1].Options)
+}
+
+func TestHybridEvaluationFallback(t *testing.T) {
+	localEvaluator, remoteEvaluator := newTestHybridEvaluators()
+	remoteErr := errors.New("remote evaluation unavailable")
+	remoteEvaluator.SetError(remoteErr)
+	var reportedErrs []error
+	client, err := NewClient(&Config{
+		Mode:   HybridEvaluationMode,
+		Local:  localEvaluator,
+		Remote: remoteEvaluator,
+		Hybrid: &HybridConfig{
+			FallbackVariants: map[string]experiment.Variant{"server-flag": {Key: "fallback"}, "local-flag": {Key: "unused"}},
+			OnRemoteError:    func(err error) { reportedErrs = append(reportedErrs, err) },
+		},
+	})
+	require.NoError(t, err)
+	user := &experiment.User{UserId: "user_id"}
+	expected := map[string]string{"local-flag": "local", "remote-flag": "stale", "server-flag": "fallback"}
+
+	variants, err := client.EvaluateWithContext(context.Background(), user, nil)
+	require.NoError(t, err)
+	assert.Equal(t, expected, variantKeys(variants))
+	evaluations := localEvaluator.Evaluations()
+	require.Equal(t, 1, len(evaluations))
+	assert.Equal(t, []string{"local-flag", "remote-flag"}, evaluations[0].Options.FlagKeys)
+
+	variants, err = client.EvaluateWithContext(context.Background(), user, &experiment.EvaluateOptions{FlagKeys: []string{"local-flag", "remote-flag", "server-flag", "unknown-flag"}})
+	require.NoError(t, err)
+	assert.Equal(t, expected, variantKeys(variants))
+	assert.Equal(t, []error{remoteErr, remoteErr}, reportedErrs)
+
+	// Local evaluation errors are returned.
+	localErr := errors.New("local evaluation failed")
+	localEvaluator.SetError(localErr)
+	_, err = client.EvaluateWithContext(context.Background(), user, nil)
+	assert.Equal(t, localErr, err)
+}
+
+func TestHybridEvaluationRemoteTimeout(t *testing.T) {
+	localEvaluator, _ := newTestHybridEvaluators()
+	client, err := NewClient(&Config{
+		Mode:   HybridEvaluationMode,
+		Local:  localEvaluator,
+		Remote: blockingEvaluator{},
+		Hybrid: &HybridConfig{RemoteTimeout: 10 * time.Millisecond},
+	})
+	require.NoError(t, err)
+
+	variants, err := client.EvaluateWithContext(context.Background(), &experiment.User{UserId: "user_id"}, &experiment.EvaluateOptions{FlagKeys: []string{"remote-flag"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"remote-flag": "stale"}, variantKeys(variants))
+}
+
+func TestNewHybridClientErrors(t *testing.T) {
+	_, err := NewClient(&Config{Mode: HybridEvaluationMode, Local: experimenttest.NewClient()})
+	assert.EqualError(t, err, "hybrid evaluation mode requires a local and a remote evaluator")
+	_, err = NewClient(&Config{Mode: HybridEvaluationMode, Local: blockingEvaluator{}, Remote: blockingEvaluator{}})
+	assert.EqualError(t, err, "hybrid evaluation mode requires a local evaluator which provides flag metadata")
+}
@@ -0,0 +1,73 @@
+package experiment
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrUnauthorized matches a RequestError whose response status is 401 or 403, which means the
+	// deployment or secret key is invalid or not allowed to make the request.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrRateLimited matches a RequestError whose response status is 429.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrFlagNotFound matches errors returned when an evaluated flag does not exist, including a
+	// VariationError with the reason VariationFlagNotFound.
+	ErrFlagNotFound = errors.New("flag not found")
+)
+
+// RequestError is returned when a request to an Amplitude service fails, either because no response
+// was received or because the response status was unexpected. Use errors.Is with ErrUnauthorized
+// and ErrRateLimited, or with the cause, to classify the failure.
+type RequestError struct {
+	// StatusCode is the status of the response, or 0 if no response was received.
+	StatusCode int
+	// Endpoint is the URL of the request, without its query.
+	Endpoint string
+	// Attempt is the number of the failed request, starting at 1, when requests are retried.
+	Attempt int
+	// Retryable reports whether the request could succeed if sent again.
+	Retryable bool
+	// RetryAfter is the delay requested by the response's Retry-After header, if any.
+	RetryAfter time.Duration
+	// Err is the cause of the failure, such as a network error, or nil.
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	message := e.Endpoint
+	if e.StatusCode != 0 {
+		message = fmt.Sprintf("%s: %d %s", message, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	if e.Attempt > 1 {
+		message = fmt.Sprintf("%s (attempt %d)", message, e.Attempt)
+	}
+	if e.Err != nil {
+		message = fmt.Sprintf("%s: %v", message, e.Err)
+	}
+	return message
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrUnauthorized and ErrRateLimited by the response status.
+func (e *RequestError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// IsRetryableStatus reports whether a request which failed with the response status could succeed
+// if sent again, which is the case for server errors and 429. It is the Retryable classification of
+// a RequestError for an unexpected response status.
+func IsRetryableStatus(statusCode int) bool {
+	return statusCode >= 500 || statusCode == http.StatusTooManyRequests
+}
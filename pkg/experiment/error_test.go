@@ -0,0 +1,48 @@
+package experiment
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestError(t *testing.T) {
+	cause := errors.New("connection reset")
+	err := fmt.Errorf("fetch: %w", &RequestError{
+		StatusCode: http.StatusServiceUnavailable,
+		Endpoint:   "https://api.lab.amplitude.com/sdk/v2/vardata",
+		Attempt:    2,
+		Retryable:  true,
+		Err:        cause,
+	})
+	require.EqualError(t, err, "fetch: https://api.lab.amplitude.com/sdk/v2/vardata: 503 Service Unavailable (attempt 2): connection reset")
+	require.ErrorIs(t, err, cause)
+	require.NotErrorIs(t, err, ErrUnauthorized)
+	var requestErr *RequestError
+	require.ErrorAs(t, err, &requestErr)
+	require.True(t, requestErr.Retryable)
+
+	require.ErrorIs(t, &RequestError{StatusCode: http.StatusUnauthorized}, ErrUnauthorized)
+	require.ErrorIs(t, &RequestError{StatusCode: http.StatusForbidden}, ErrUnauthorized)
+	require.ErrorIs(t, &RequestError{StatusCode: http.StatusTooManyRequests}, ErrRateLimited)
+	require.NotErrorIs(t, &RequestError{StatusCode: http.StatusTooManyRequests}, ErrUnauthorized)
+
+	for statusCode, retryable := range map[int]bool{
+		http.StatusMultipleChoices:     false,
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusServiceUnavailable:  true,
+	} {
+		require.Equal(t, retryable, IsRetryableStatus(statusCode), "status %d", statusCode)
+	}
+}
+
+func TestVariationErrorIs(t *testing.T) {
+	require.ErrorIs(t, &VariationError{FlagKey: "flag", Reason: VariationFlagNotFound}, ErrFlagNotFound)
+	require.NotErrorIs(t, &VariationError{FlagKey: "flag", Reason: VariationFlagOff}, ErrFlagNotFound)
+}
@@ -0,0 +1,21 @@
+package experiment
+
+import "context"
+
+// Evaluator evaluates flags for users. It is implemented by local.Client, remote.Client, the
+// composite.Client which selects one of them by configuration, and the fake client of the
+// experimenttest package, so that application code can be written, and tested, against the
+// interface rather than a concrete client.
+type Evaluator interface {
+	// EvaluateWithContext returns the variants of the flags for the user, including default variants.
+	// A nil options evaluates all flags without tracking exposures.
+	EvaluateWithContext(ctx context.Context, user *User, options *EvaluateOptions) (map[string]Variant, error)
+}
+
+// EvaluateOptions contains options for evaluating variants for a user.
+type EvaluateOptions struct {
+	// FlagKeys are the flags to evaluate with the user. If nil or empty, all flags are evaluated.
+	FlagKeys []string
+	// TracksExposure indicates whether to track exposure event for the evaluation. Defaults to false.
+	TracksExposure bool
+}
@@ -0,0 +1,243 @@
+// Package experimenttest provides a fake client for unit testing code which evaluates flags with
+// the experiment.Evaluator interface, without touching the network.
+//
+// Flags are defined with the NewFlag and NewSegment builders, and evaluated by the same engine as
+// local.Client:
+//
+//	client := experimenttest.NewClient(
+//		experimenttest.NewFlag("checkout").
+//			Variant("control", "control").
+//			Variant("treatment", "treatment").
+//			Segment(experimenttest.NewSegment("treatment").Where(experimenttest.UserField("country"), experimenttest.OpIs, "US")).
+//			All("control"),
+//	)
+package experimenttest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/amplitude/experiment-go-server/internal/evaluation"
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+)
+
+// Evaluation is an evaluation recorded by Client.
+type Evaluation struct {
+	User     *experiment.User
+	Options  experiment.EvaluateOptions
+	Variants map[string]experiment.Variant
+	Err      error
+}
+
+// Exposure is an exposure recorded by Client.
+type Exposure struct {
+	User    *experiment.User
+	FlagKey string
+	Variant experiment.Variant
+}
+
+// Client is a fake experiment.Evaluator which evaluates flags defined in memory, and records each
+// evaluation and exposure for assertions. It is safe for concurrent use.
+type Client struct {
+	lock        sync.Mutex
+	engine      *evaluation.Engine
+	flags       map[string]*evaluation.Flag
+	err         error
+	evaluations []Evaluation
+	exposures   []Exposure
+}
+
+// NewClient returns a client with the flags.
+func NewClient(flags ...*Flag) *Client {
+	client := &Client{
+		engine: evaluation.NewEngine(logger.New(logger.Disable, logger.NewDefault())),
+		flags:  make(map[string]*evaluation.Flag),
+	}
+	client.SetFlags(flags...)
+	return client
+}
+
+// SetFlags adds the flags to the client, replacing any flags with the same keys. The flags are
+// copied through JSON, so that variant payloads decode as they would from the flag server, and
+// later changes to the builders do not affect the client.
+func (c *Client) SetFlags(flags ...*Flag) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, flag := range flags {
+		data, err := json.Marshal(flag.flag)
+		if err != nil {
+			panic(fmt.Sprintf("experimenttest: flag %s does not encode: %v", flag.flag.Key, err))
+		}
+		var copied evaluation.Flag
+		if err := json.Unmarshal(data, &copied); err != nil {
+			panic(fmt.Sprintf("experimenttest: flag %s does not decode: %v", flag.flag.Key, err))
+		}
+		c.flags[copied.Key] = &copied
+	}
+}
+
+// RemoveFlags removes the flags with the keys.
+func (c *Client) RemoveFlags(flagKeys ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, flagKey := range flagKeys {
+		delete(c.flags, flagKey)
+	}
+}
+
+// FlagMetadata returns a copy of the metadata of the flag, or nil if the flag is not set, like
+// local.Client.
+func (c *Client) FlagMetadata(flagKey string) map[string]interface{} {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	flag, ok := c.flags[flagKey]
+	if !ok {
+		return nil
+	}
+	metadata := make(map[string]interface{}, len(flag.Metadata))
+	for key, value := range flag.Metadata {
+		metadata[key] = value
+	}
+	return metadata
+}
+
+// FlagKeys returns the sorted keys of the flags which are set, like local.Client.
+func (c *Client) FlagKeys() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	flagKeys := make([]string, 0, len(c.flags))
+	for flagKey := range c.flags {
+		flagKeys = append(flagKeys, flagKey)
+	}
+	sort.Strings(flagKeys)
+	return flagKeys
+}
+
+// SetError makes evaluations fail with err, or succeed again if err is nil.
+func (c *Client) SetError(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.err = err
+}
+
+// EvaluateWithContext evaluates the flags for the user like local.Client: the variants of the
+// requested flags and their dependencies are returned, including default variants, and if
+// options.TracksExposure is set an exposure is recorded for each variant which is not a default
+// variant and does not disable exposure tracking. If the context is done, its error is returned.
+func (c *Client) EvaluateWithContext(ctx context.Context, user *experiment.User, options *experiment.EvaluateOptions) (map[string]experiment.Variant, error) {
+	if options == nil {
+		options = &experiment.EvaluateOptions{}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	variants, err := c.evaluate(ctx, user, options)
+	c.evaluations = append(c.evaluations, Evaluation{User: user, Options: *options, Variants: variants, Err: err})
+	if err != nil {
+		return nil, err
+	}
+	if options.TracksExposure {
+		for flagKey, variant := range variants {
+			if tracksExposure(variant) {
+				c.exposures = append(c.exposures, Exposure{User: user, FlagKey: flagKey, Variant: variant})
+			}
+		}
+	}
+	return variants, nil
+}
+
+func (c *Client) evaluate(ctx context.Context, user *experiment.User, options *experiment.EvaluateOptions) (map[string]experiment.Variant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	sortedFlags, err := c.sortedFlags(options.FlagKeys)
+	if err != nil {
+		return nil, err
+	}
+	results := c.engine.Evaluate(evaluation.UserToContext(user), sortedFlags)
+	variants := make(map[string]experiment.Variant, len(results))
+	for key, result := range results {
+		value, _ := result.Value.(string)
+		variants[key] = experiment.Variant{
+			Key:      result.Key,
+			Value:    value,
+			Payload:  result.Payload,
+			Metadata: result.Metadata,
+		}
+	}
+	return variants, nil
+}
+
+// sortedFlags returns the flags with the keys, or all flags, and their dependencies, dependencies
+// first. Unknown flag keys are ignored.
+func (c *Client) sortedFlags(flagKeys []string) ([]*evaluation.Flag, error) {
+	if len(flagKeys) == 0 {
+		for flagKey := range c.flags {
+			flagKeys = append(flagKeys, flagKey)
+		}
+	}
+	sorted := make([]*evaluation.Flag, 0, len(flagKeys))
+	visited := make(map[string]bool)
+	var visit func(flagKey string, path []string) error
+	visit = func(flagKey string, path []string) error {
+		flag, ok := c.flags[flagKey]
+		if !ok {
+			return nil
+		}
+		if done, ok := visited[flagKey]; ok {
+			if !done {
+				return fmt.Errorf("detected a cycle between flags %v", append(path, flagKey))
+			}
+			return nil
+		}
+		visited[flagKey] = false
+		for _, dependency := range flag.Dependencies {
+			if err := visit(dependency, append(path, flagKey)); err != nil {
+				return err
+			}
+		}
+		visited[flagKey] = true
+		sorted = append(sorted, flag)
+		return nil
+	}
+	for _, flagKey := range flagKeys {
+		if err := visit(flagKey, nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+func tracksExposure(variant experiment.Variant) bool {
+	isDefault, _ := variant.Metadata["default"].(bool)
+	trackExposure, ok := variant.Metadata["trackExposure"].(bool)
+	return !isDefault && (!ok || trackExposure)
+}
+
+// Evaluations returns the evaluations recorded since the client was created or reset.
+func (c *Client) Evaluations() []Evaluation {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]Evaluation(nil), c.evaluations...)
+}
+
+// Exposures returns the exposures recorded since the client was created or reset.
+func (c *Client) Exposures() []Exposure {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]Exposure(nil), c.exposures...)
+}
+
+// Reset clears the recorded evaluations and exposures.
+func (c *Client) Reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.evaluations = nil
+	c.exposures = nil
+}
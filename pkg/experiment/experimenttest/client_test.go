@@ -0,0 +1,125 @@
+package experimenttest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/amplitude/experiment-go-server/pkg/experiment/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ experiment.Evaluator = (*Client)(nil)
+	_ experiment.Evaluator = (*local.Client)(nil)
+)
+
+func newTestClient() *Client {
+	return NewClient(
+		NewFlag("checkout").
+			Variant("control", "control").
+			VariantWithPayload("treatment", "treatment", map[string]interface{}{"limit": 2}).
+			DefaultVariant("off").
+			Metadata("flagType", "experiment").
+			Segment(NewSegment("treatment").Where(UserField("country"), OpIs, "US").Or().Where(UserProperty("plan"), OpIs, "beta")).
+			Segment(NewSegment("off").Where(UserField("user_id"), OpIs, "excluded")).
+			All("control"),
+		NewFlag("banner").
+			Variant("on", "on").
+			DefaultVariant("off").
+			DependsOn("checkout").
+			Segment(NewSegment("on").Where(FlagResult("checkout"), OpIs, "treatment")).
+			All("off"),
+	)
+}
+
+func TestClientEvaluate(t *testing.T) {
+	client := newTestClient()
+	ctx := context.Background()
+
+	variants, err := client.EvaluateWithContext(ctx, &experiment.User{UserId: "user_id", Country: "US"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, experiment.Variant{
+		Key:      "treatment",
+		Value:    "treatment",
+		Payload:  map[string]interface{}{"limit": float64(2)},
+		Metadata: map[string]interface{}{"flagType": "experiment"},
+	}, variants["checkout"])
+	assert.Equal(t, "on", variants["banner"].Key)
+
+	variants, err = client.EvaluateWithContext(ctx, &experiment.User{UserId: "user_id", UserProperties: map[string]interface{}{"plan": "beta"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "treatment", variants["checkout"].Key)
+
+	variants, err = client.EvaluateWithContext(ctx, &experiment.User{UserId: "excluded", Country: "CA"}, &experiment.EvaluateOptions{FlagKeys: []string{"checkout"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]experiment.Variant{
+		"checkout": {Key: "off", Metadata: map[string]interface{}{"default": true, "flagType": "experiment"}},
+	}, variants)
+
+	variants, err = client.EvaluateWithContext(ctx, &experiment.User{UserId: "user_id"}, &experiment.EvaluateOptions{FlagKeys: []string{"banner"}})
+	require.NoError(t, err)
+	assert.Equal(t, "control", variants["checkout"].Key)
+	assert.Equal(t, "off", variants["banner"].Key)
+	assert.Equal(t, 4, len(client.Evaluations()))
+
+	assert.Equal(t, map[string]interface{}{"flagType": "experiment"}, client.FlagMetadata("checkout"))
+	assert.Equal(t, map[string]interface{}{}, client.FlagMetadata("banner"))
+	assert.Nil(t, client.FlagMetadata("missing"))
+	assert.Equal(t, []string{"banner", "checkout"}, client.FlagKeys())
+}
+
+func TestClientRecordsExposures(t *testing.T) {
+	client := newTestClient()
+	user := &experiment.User{UserId: "user_id"}
+	_, err := client.EvaluateWithContext(context.Background(), user, nil)
+	require.NoError(t, err)
+	assert.Empty(t, client.Exposures())
+
+	_, err = client.EvaluateWithContext(context.Background(), user, &experiment.EvaluateOptions{TracksExposure: true})
+	require.NoError(t, err)
+	assert.Equal(t, []Exposure{{User: user, FlagKey: "checkout", Variant: experiment.Variant{
+		Key:      "control",
+		Value:    "control",
+		Metadata: map[string]interface{}{"flagType": "experiment"},
+	}}}, client.Exposures())
+
+	evaluations := client.Evaluations()
+	require.Equal(t, 2, len(evaluations))
+	assert.Same(t, user, evaluations[1].User)
+	assert.True(t, evaluations[1].Options.TracksExposure)
+
+	client.Reset()
+	assert.Empty(t, client.Evaluations())
+	assert.Empty(t, client.Exposures())
+}
+
+func TestClientErrors(t *testing.T) {
+	client := newTestClient()
+	user := &experiment.User{UserId: "user_id"}
+	testErr := errors.New("evaluation failed")
+	client.SetError(testErr)
+	variants, err := client.EvaluateWithContext(context.Background(), user, nil)
+	assert.Equal(t, testErr, err)
+	assert.Nil(t, variants)
+	client.SetError(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.EvaluateWithContext(ctx, user, nil)
+	assert.Equal(t, context.Canceled, err)
+
+	client.SetFlags(NewFlag("a").DependsOn("b"), NewFlag("b").DependsOn("a"))
+	_, err = client.EvaluateWithContext(context.Background(), user, &experiment.EvaluateOptions{FlagKeys: []string{"a"}})
+	assert.EqualError(t, err, "detected a cycle between flags [a b a]")
+	client.RemoveFlags("a", "b")
+	variants, err = client.EvaluateWithContext(context.Background(), user, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(variants))
+
+	evaluations := client.Evaluations()
+	require.Equal(t, 4, len(evaluations))
+	assert.Equal(t, testErr, evaluations[0].Err)
+}
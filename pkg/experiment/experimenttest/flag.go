@@ -0,0 +1,142 @@
+package experimenttest
+
+import (
+	"github.com/amplitude/experiment-go-server/internal/evaluation"
+)
+
+// The condition operators supported by Segment.Where.
+const (
+	OpIs                       = evaluation.OpIs
+	OpIsNot                    = evaluation.OpIsNot
+	OpContains                 = evaluation.OpContains
+	OpDoesNotContain           = evaluation.OpDoesNotContain
+	OpLessThan                 = evaluation.OpLessThan
+	OpLessThanEquals           = evaluation.OpLessThanEquals
+	OpGreaterThan              = evaluation.OpGreaterThan
+	OpGreaterThanEquals        = evaluation.OpGreaterThanEquals
+	OpVersionLessThan          = evaluation.OpVersionLessThan
+	OpVersionLessThanEquals    = evaluation.OpVersionLessThanEquals
+	OpVersionGreaterThan       = evaluation.OpVersionGreaterThan
+	OpVersionGreaterThanEquals = evaluation.OpVersionGreaterThanEquals
+	OpSetIs                    = evaluation.OpSetIs
+	OpSetIsNot                 = evaluation.OpSetIsNot
+	OpSetContains              = evaluation.OpSetContains
+	OpSetDoesNotContain        = evaluation.OpSetDoesNotContain
+	OpSetContainsAny           = evaluation.OpSetContainsAny
+	OpSetDoesNotContainAny     = evaluation.OpSetDoesNotContainAny
+	OpRegexMatch               = evaluation.OpRegexMatch
+	OpRegexDoesNotMatch        = evaluation.OpRegexDoesNotMatch
+)
+
+// UserField returns the selector of a field of the user, by its JSON name, e.g. "user_id" or "country".
+func UserField(field string) []string {
+	return []string{"context", "user", field}
+}
+
+// UserProperty returns the selector of a user property.
+func UserProperty(property string) []string {
+	return []string{"context", "user", "user_properties", property}
+}
+
+// GroupProperty returns the selector of a property of the user's group of the group type.
+func GroupProperty(groupType, property string) []string {
+	return []string{"context", "groups", groupType, "group_properties", property}
+}
+
+// FlagResult returns the selector of the variant key assigned to a flag evaluated before, which
+// must be a dependency of the flag being evaluated.
+func FlagResult(flagKey string) []string {
+	return []string{"result", flagKey, "key"}
+}
+
+// Flag builds a flag config. Segments are evaluated in order, and the first segment which matches
+// the user assigns its variant. Users who match no segment are not assigned a variant.
+type Flag struct {
+	flag *evaluation.Flag
+}
+
+// NewFlag returns a builder of a flag with the key.
+func NewFlag(key string) *Flag {
+	return &Flag{flag: &evaluation.Flag{
+		Key:      key,
+		Variants: make(map[string]*evaluation.Variant),
+	}}
+}
+
+// Variant adds a variant to the flag.
+func (f *Flag) Variant(key string, value string) *Flag {
+	f.flag.Variants[key] = &evaluation.Variant{Key: key, Value: value}
+	return f
+}
+
+// VariantWithPayload adds a variant with a payload to the flag.
+func (f *Flag) VariantWithPayload(key string, value string, payload interface{}) *Flag {
+	f.flag.Variants[key] = &evaluation.Variant{Key: key, Value: value, Payload: payload}
+	return f
+}
+
+// DefaultVariant adds the variant assigned by the flag when it is off. Default variants are marked
+// with the "default" metadata, and are not tracked as exposures.
+func (f *Flag) DefaultVariant(key string) *Flag {
+	f.flag.Variants[key] = &evaluation.Variant{Key: key, Metadata: map[string]interface{}{"default": true}}
+	return f
+}
+
+// Metadata sets a metadata value of the flag, which is merged into the metadata of its variants.
+func (f *Flag) Metadata(key string, value interface{}) *Flag {
+	if f.flag.Metadata == nil {
+		f.flag.Metadata = make(map[string]interface{})
+	}
+	f.flag.Metadata[key] = value
+	return f
+}
+
+// DependsOn adds dependencies of the flag, which are evaluated before the flag so that segments
+// can target their results with FlagResult.
+func (f *Flag) DependsOn(flagKeys ...string) *Flag {
+	f.flag.Dependencies = append(f.flag.Dependencies, flagKeys...)
+	return f
+}
+
+// Segment adds a segment to the flag.
+func (f *Flag) Segment(segment *Segment) *Flag {
+	f.flag.Segments = append(f.flag.Segments, segment.segment)
+	return f
+}
+
+// All adds a segment which assigns the variant to all users, usually as the last segment.
+func (f *Flag) All(variantKey string) *Flag {
+	return f.Segment(NewSegment(variantKey))
+}
+
+// Segment builds a flag segment. A segment without conditions matches all users.
+type Segment struct {
+	segment  *evaluation.Segment
+	newGroup bool
+}
+
+// NewSegment returns a builder of a segment which assigns the variant to the users it matches.
+func NewSegment(variantKey string) *Segment {
+	return &Segment{segment: &evaluation.Segment{Variant: variantKey}}
+}
+
+// Where adds a condition to the segment's current group of conditions, all of which must match.
+func (s *Segment) Where(selector []string, op string, values ...string) *Segment {
+	if len(s.segment.Conditions) == 0 || s.newGroup {
+		s.segment.Conditions = append(s.segment.Conditions, nil)
+		s.newGroup = false
+	}
+	last := len(s.segment.Conditions) - 1
+	s.segment.Conditions[last] = append(s.segment.Conditions[last], &evaluation.Condition{
+		Selector: selector,
+		Op:       op,
+		Values:   values,
+	})
+	return s
+}
+
+// Or starts a new group of conditions. The segment matches if any group matches.
+func (s *Segment) Or() *Segment {
+	s.newGroup = len(s.segment.Conditions) > 0
+	return s
+}
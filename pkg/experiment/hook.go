@@ -0,0 +1,35 @@
+package experiment
+
+import "context"
+
+// Hook runs custom logic around each evaluation of the local and remote clients, for example to
+// enrich users from a profile service, override variants for QA accounts, or record metrics. Hooks
+// are registered with the Hooks of the client's Config.
+//
+// BeforeEvaluate is called on each hook in registration order, and AfterEvaluate in reverse
+// registration order, so that the first hook wraps the others. A hook which panics is skipped: the
+// panic is recovered and logged, and evaluation continues with the user or variants as they were
+// before the hook was called, unless the hook had already modified them in place. Hooks may be
+// called concurrently and must be safe for concurrent use.
+type Hook interface {
+	// BeforeEvaluate is called with the user before flags are evaluated or fetched for them, and
+	// returns the user to evaluate, which may be the given user, modified or not, or another user.
+	// Returning nil keeps the given user.
+	BeforeEvaluate(user *User) *User
+	// AfterEvaluate is called with the evaluated user and the resulting variants, or the error which
+	// failed the evaluation. The variants may be modified in place, including each variant's
+	// Metadata, which is a copy; they are returned to the caller and, for local evaluation, tracked
+	// after all hooks have been called. A variant's Payload may be shared with other evaluations and
+	// must not be modified; replace it instead. If err is not nil, variants may be nil and are not
+	// returned.
+	AfterEvaluate(user *User, variants map[string]Variant, err error)
+}
+
+// ContextHook is an optional extension of Hook. If a hook implements it, these methods are called
+// instead of BeforeEvaluate and AfterEvaluate, with the context of the evaluation, which is
+// context.Background() for evaluations made without one.
+type ContextHook interface {
+	Hook
+	BeforeEvaluateContext(ctx context.Context, user *User) *User
+	AfterEvaluateContext(ctx context.Context, user *User, variants map[string]Variant, err error)
+}
@@ -1,6 +1,7 @@
 package local
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/amplitude/analytics-go/amplitude"
@@ -16,14 +17,23 @@ type assignmentService struct {
 	filter    *assignmentFilter
 }
 
-// Track tracks an assignment event.
+// Track tracks an assignment event, unless the context is done.
 // Deprecated: Assignment tracking is deprecated. Use ExposureService with Exposure tracking instead.
-func (s *assignmentService) Track(assignment *assignment) {
+func (s *assignmentService) Track(ctx context.Context, assignment *assignment) {
+	if ctx.Err() != nil {
+		return
+	}
 	if s.filter.shouldTrack(assignment) {
 		(*s.amplitude).Track(toEvent(assignment))
 	}
 }
 
+// shutdown flushes pending assignment events and stops the underlying amplitude client.
+// Deprecated: Assignment tracking is deprecated. Use ExposureService with Exposure tracking instead.
+func (s *assignmentService) shutdown() {
+	(*s.amplitude).Shutdown()
+}
+
 // toEvent converts an assignment to an Amplitude event.
 // Deprecated: Assignment tracking is deprecated. Use Exposure tracking instead.
 func toEvent(assignment *assignment) amplitude.Event {
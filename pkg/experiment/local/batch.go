@@ -0,0 +1,131 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+)
+
+// BatchEvaluateOptions are the options of EvaluateBatch.
+type BatchEvaluateOptions struct {
+	// FlagKeys are the flags to evaluate with each user. If nil or empty, all flags are evaluated.
+	FlagKeys []string
+	// TracksExposure indicates whether to track exposure events for each user. Defaults to false.
+	TracksExposure bool
+	// Concurrency is the number of users evaluated concurrently. Defaults to 1.
+	Concurrency int
+	// OnResult, if set, is called with the variants or the error of each user as soon as the user is
+	// evaluated, instead of the variants being collected and returned. The index is the user's index
+	// in the batch. Users are evaluated in order only if Concurrency is 1; otherwise OnResult is
+	// called concurrently and must be safe for concurrent use.
+	OnResult func(index int, variants map[string]experiment.Variant, err error)
+}
+
+// EvaluateBatch evaluates flags locally for each user of the batch, like EvaluateV2WithOptions. The
+// flags are resolved and sorted once for the whole batch, and the flag configs are not updated
+// during the batch. Cohort memberships are still looked up per user.
+//
+// Without OnResult, the variants of each user are returned in the order of the users, and the first
+// error stops the batch and is returned. With OnResult, the variants are not held in memory, an
+// error is passed to OnResult for the user it occurred for, and the batch continues. In both cases,
+// an error resolving the flags, such as a dependency cycle, is returned before any user is
+// evaluated.
+//
+// As with EvaluateV2, the users are enriched with their cohort IDs, so a user must not appear twice
+// in the batch.
+func (c *Client) EvaluateBatch(users []*experiment.User, options *BatchEvaluateOptions) ([]map[string]experiment.Variant, error) {
+	return c.EvaluateBatchWithContext(context.Background(), users, options)
+}
+
+// EvaluateBatchWithContext evaluates flags locally for each user of the batch, like EvaluateBatch,
+// with a context. The context is passed to each evaluation as with EvaluateWithContext. Once the
+// context is done, no more users are evaluated, users which have not been evaluated are not passed
+// to OnResult, and the context's error is returned.
+func (c *Client) EvaluateBatchWithContext(ctx context.Context, users []*experiment.User, options *BatchEvaluateOptions) ([]map[string]experiment.Variant, error) {
+	if options == nil {
+		options = &BatchEvaluateOptions{}
+	}
+	index := c.flagIndex()
+	sortedFlags, err := index.sortedFlags(options.FlagKeys)
+	if err != nil {
+		return nil, err
+	}
+	c.requiredCohortsInStorage(index, sortedFlags)
+	groupedCohortIDs := index.groupedCohortIDsOf(sortedFlags)
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var results []map[string]experiment.Variant
+	var firstErr error
+	var errOnce sync.Once
+	onResult := options.OnResult
+	if onResult == nil {
+		results = make([]map[string]experiment.Variant, len(users))
+		onResult = func(i int, variants map[string]experiment.Variant, err error) {
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			results[i] = variants
+		}
+	}
+
+	evaluateUser := func(i int) {
+		user := users[i]
+		if user == nil {
+			onResult(i, nil, fmt.Errorf("user %d is nil", i))
+			return
+		}
+		variants := make(map[string]experiment.Variant)
+		err := c.evaluateWithHooks(ctx, user, options.TracksExposure, variants, func(user *experiment.User) error {
+			return c.evaluateFlags(ctx, user, sortedFlags, groupedCohortIDs, variants, false)
+		})
+		if err != nil {
+			onResult(i, nil, err)
+			return
+		}
+		onResult(i, variants, nil)
+	}
+
+	concurrency := options.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < len(users); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if ctx.Err() == nil {
+					evaluateUser(i)
+				}
+			}
+		}()
+	}
+dispatch:
+	for i := range users {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := parent.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,129 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBatchClient(t *testing.T, cohortStorage CohortStorage) *Client {
+	client, _ := newTestClient(t, []byte(`[]`), &Config{
+		FlagConfigStorage: newReadOnlyFlagConfigStorage(t, testCohortDependencyFlagsStr),
+		CohortStorage:     cohortStorage,
+	})
+	return client
+}
+
+func newTestBatchUsers(count int) []*experiment.User {
+	users := make([]*experiment.User, count)
+	for i := range users {
+		users[i] = &experiment.User{UserId: fmt.Sprintf("user_%d", i)}
+	}
+	return users
+}
+
+func newTestBatchCohortStorage(t *testing.T) *inMemoryCohortStorage {
+	cohortStorage := newInMemoryCohortStorage()
+	require.Nil(t, cohortStorage.PutCohort(&Cohort{Id: "a", GroupType: userGroupType, Size: 2, MemberIds: []string{"user_0", "user_2"}}))
+	return cohortStorage
+}
+
+func TestEvaluateBatch(t *testing.T) {
+	client := newTestBatchClient(t, newTestBatchCohortStorage(t))
+	users := newTestBatchUsers(50)
+
+	results, err := client.EvaluateBatch(users, &BatchEvaluateOptions{FlagKeys: []string{"parent"}, Concurrency: 4})
+	require.Nil(t, err)
+	require.Equal(t, len(users), len(results))
+	for i, variants := range results {
+		expected, err := client.EvaluateV2(&experiment.User{UserId: users[i].UserId}, []string{"parent"})
+		require.Nil(t, err)
+		assert.Equal(t, expected, variants, "user %d", i)
+	}
+	assert.Equal(t, "on", results[0]["parent"].Key)
+	assert.Equal(t, "off", results[1]["parent"].Key)
+	assert.Equal(t, "on", results[2]["parent"].Key)
+	assert.NotContains(t, results[0], "other")
+}
+
+func TestEvaluateBatchOnResult(t *testing.T) {
+	client := newTestBatchClient(t, newTestBatchCohortStorage(t))
+	users := newTestBatchUsers(3)
+	users[1] = nil
+
+	var order []int
+	errs := make(map[int]error)
+	results, err := client.EvaluateBatch(users, &BatchEvaluateOptions{
+		OnResult: func(i int, variants map[string]experiment.Variant, err error) {
+			order = append(order, i)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			assert.Equal(t, "on", variants["dependency"].Key)
+		},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, results)
+	assert.Equal(t, []int{0, 1, 2}, order)
+	assert.Equal(t, 1, len(errs))
+	assert.EqualError(t, errs[1], "user 1 is nil")
+}
+
+func TestEvaluateBatchError(t *testing.T) {
+	cohortErr := errors.New("cohort storage unavailable")
+	client := newTestBatchClient(t, &failingCohortStorage{newTestBatchCohortStorage(t), cohortErr})
+	users := newTestBatchUsers(20)
+
+	results, err := client.EvaluateBatch(users, &BatchEvaluateOptions{Concurrency: 4})
+	assert.Equal(t, cohortErr, err)
+	assert.Nil(t, results)
+
+	var lock sync.Mutex
+	count := 0
+	results, err = client.EvaluateBatch(users, &BatchEvaluateOptions{
+		Concurrency: 4,
+		OnResult: func(i int, variants map[string]experiment.Variant, err error) {
+			lock.Lock()
+			defer lock.Unlock()
+			assert.Equal(t, cohortErr, err)
+			count++
+		},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, results)
+	assert.Equal(t, len(users), count)
+}
+
+func TestEvaluateBatchWithContext(t *testing.T) {
+	client := newTestBatchClient(t, newTestBatchCohortStorage(t))
+	users := newTestBatchUsers(50)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := client.EvaluateBatchWithContext(ctx, users, &BatchEvaluateOptions{Concurrency: 4})
+	assert.Equal(t, context.Canceled, err)
+	assert.Nil(t, results)
+
+	// The batch stops once the context is done.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	var evaluated []int
+	results, err = client.EvaluateBatchWithContext(ctx, users, &BatchEvaluateOptions{
+		OnResult: func(i int, variants map[string]experiment.Variant, err error) {
+			evaluated = append(evaluated, i)
+			if i == 9 {
+				cancel()
+			}
+		},
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Nil(t, results)
+	assert.Equal(t, 10, len(evaluated))
+}
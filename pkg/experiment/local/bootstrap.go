@@ -0,0 +1,82 @@
+package local
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/amplitude/experiment-go-server/internal/evaluation"
+)
+
+// serializedCohort is the JSON representation of a cohort, matching the cohort download api response.
+type serializedCohort struct {
+	Id           string   `json:"cohortId"`
+	LastModified int64    `json:"lastModified"`
+	Size         int      `json:"size"`
+	MemberIds    []string `json:"memberIds"`
+	GroupType    string   `json:"groupType,omitempty"`
+}
+
+func (c *serializedCohort) toCohort() *Cohort {
+	groupType := c.GroupType
+	if groupType == "" {
+		groupType = userGroupType
+	}
+	memberIds := c.MemberIds
+	if memberIds == nil {
+		memberIds = []string{}
+	}
+	return &Cohort{
+		Id:           c.Id,
+		LastModified: c.LastModified,
+		Size:         c.Size,
+		MemberIds:    memberIds,
+		GroupType:    groupType,
+	}
+}
+
+// bootstrapData is the contents of a bootstrap file.
+type bootstrapData struct {
+	Flags   []*evaluation.Flag  `json:"flags"`
+	Cohorts []*serializedCohort `json:"cohorts,omitempty"`
+}
+
+// readBootstrap reads bootstrap data from the configured file or reader. The data is either the JSON
+// array of flag configs returned by the flag config api, or an object with "flags" and "cohorts" arrays.
+func readBootstrap(config *BootstrapConfig) (*bootstrapData, error) {
+	var raw []byte
+	var err error
+	if config.File != "" {
+		raw, err = os.ReadFile(config.File)
+	} else if config.Reader != nil {
+		raw, err = io.ReadAll(config.Reader)
+	} else {
+		return nil, errors.New("bootstrap config requires a file or reader")
+	}
+	if err != nil {
+		return nil, err
+	}
+	data := &bootstrapData{}
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '[' {
+		err = json.Unmarshal(raw, &data.Flags)
+	} else {
+		err = json.Unmarshal(raw, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, flag := range data.Flags {
+		if flag == nil || flag.Key == "" {
+			return nil, errors.New("bootstrap flag config is missing a key")
+		}
+	}
+	for _, cohort := range data.Cohorts {
+		if cohort == nil || cohort.Id == "" {
+			return nil, errors.New("bootstrap cohort is missing a cohort id")
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,111 @@
+package local
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadBootstrapFlagsArray(t *testing.T) {
+	data, err := readBootstrap(&BootstrapConfig{Reader: strings.NewReader(string(testOnFlagStr))})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(data.Flags))
+	assert.Equal(t, "test-on", data.Flags[0].Key)
+	assert.Equal(t, 0, len(data.Cohorts))
+}
+
+func TestReadBootstrapFlagsAndCohortsFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bootstrap.json")
+	contents := `{"flags":[{"key":"flag"}],"cohorts":[{"cohortId":"1234","lastModified":10,"size":2,"memberIds":["a","b"]}]}`
+	assert.Nil(t, os.WriteFile(file, []byte(contents), 0600))
+
+	data, err := readBootstrap(&BootstrapConfig{File: file})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(data.Flags))
+	assert.Equal(t, 1, len(data.Cohorts))
+	assert.True(t, CohortEquals(
+		&Cohort{Id: "1234", LastModified: 10, Size: 2, MemberIds: []string{"a", "b"}, GroupType: userGroupType},
+		data.Cohorts[0].toCohort(),
+	))
+}
+
+func TestReadBootstrapErrors(t *testing.T) {
+	_, err := readBootstrap(&BootstrapConfig{})
+	assert.NotNil(t, err)
+	_, err = readBootstrap(&BootstrapConfig{File: filepath.Join(t.TempDir(), "missing.json")})
+	assert.NotNil(t, err)
+	_, err = readBootstrap(&BootstrapConfig{Reader: strings.NewReader("not json")})
+	assert.NotNil(t, err)
+	_, err = readBootstrap(&BootstrapConfig{Reader: strings.NewReader(`[{"variants":{}}]`)})
+	assert.NotNil(t, err)
+	_, err = readBootstrap(&BootstrapConfig{Reader: strings.NewReader(`{"flags":[],"cohorts":[{"size":1}]}`)})
+	assert.NotNil(t, err)
+}
+
+func TestClientBootstrapWhenFlagServerUnavailable(t *testing.T) {
+	var available int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&available) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(FLAG_1_STR)
+	}))
+	defer server.Close()
+
+	client := Initialize("server-bootstrap-test", &Config{
+		ServerUrl:                server.URL,
+		FlagConfigPollerInterval: 10 * time.Millisecond,
+		LogLevel:                 logger.Disable,
+		BootstrapConfig:          &BootstrapConfig{Reader: strings.NewReader(string(testOnFlagStr))},
+	})
+	defer func() { _ = client.Close(context.Background()) }()
+
+	// Bootstrapped flags are available before start, but the client is not ready until synced.
+	status := client.Status()
+	assert.True(t, status.Bootstrapped)
+	assert.False(t, status.Ready)
+	assert.Equal(t, uint64(0), status.FlagConfigVersion)
+	assert.True(t, status.LastFlagSync.IsZero())
+	variants, err := client.EvaluateV2(&experiment.User{UserId: "user_id"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "on", variants["test-on"].Key)
+
+	// Start does not fail while the flag server is unavailable.
+	err = client.Start()
+	assert.Nil(t, err)
+	variants, err = client.EvaluateV2(&experiment.User{UserId: "user_id"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "on", variants["test-on"].Key)
+
+	// Updater takes over once the flag server is available.
+	atomic.StoreInt32(&available, 1)
+	assert.Eventually(t, func() bool {
+		return client.FlagMetadata("flagkey") != nil && client.FlagMetadata("test-on") == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, UpdaterPoll, client.Status().ActiveUpdater)
+	assert.True(t, client.Ready())
+}
+
+func TestClientStartFailsWithoutBootstrap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := Initialize("server-no-bootstrap-test", &Config{ServerUrl: server.URL, LogLevel: logger.Disable})
+	defer func() { _ = client.Close(context.Background()) }()
+	assert.NotNil(t, client.Start())
+	assert.False(t, client.Ready())
+}
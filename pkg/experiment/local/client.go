@@ -7,13 +7,16 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
 	"reflect"
+	"sort"
 	"sync"
 
 	"github.com/amplitude/analytics-go/amplitude"
 
 	"github.com/amplitude/experiment-go-server/internal/evaluation"
+	"github.com/amplitude/experiment-go-server/internal/hook"
 
 	"github.com/amplitude/experiment-go-server/pkg/experiment"
 
@@ -28,15 +31,17 @@ type Client struct {
 	apiKey            string
 	config            *Config
 	client            *http.Client
-	poller            *poller
 	flagsMutex        *sync.RWMutex
 	engine            *evaluation.Engine
 	assignmentService *assignmentService
 	exposureService   *exposureService
-	cohortStorage     cohortStorage
-	flagConfigStorage flagConfigStorage
+	cohortStorage     CohortStorage
+	flagConfigStorage FlagConfigStorage
 	cohortLoader      *cohortLoader
 	deploymentRunner  *deploymentRunner
+	overrides         overrideStore
+	closeOnce         sync.Once
+	closed            chan struct{}
 }
 
 func Initialize(apiKey string, config *Config) *Client {
@@ -66,13 +71,20 @@ func Initialize(apiKey string, config *Config) *Client {
 				filter:    newExposureFilter(config.ExposureConfig.CacheCapacity),
 			}
 		}
-		cohortStorage := newInMemoryCohortStorage()
-		flagConfigStorage := newInMemoryFlagConfigStorage()
+		var cohortStorage CohortStorage = newInMemoryCohortStorage()
+		if config.CohortStorage != nil {
+			cohortStorage = config.CohortStorage
+		}
+		var flagConfigStorage FlagConfigStorage = newInMemoryFlagConfigStorage()
+		if config.FlagConfigStorage != nil {
+			flagConfigStorage = config.FlagConfigStorage
+		}
 		var cohortLoader *cohortLoader
 		var deploymentRunner *deploymentRunner
 		if config.CohortSyncConfig != nil {
-			cohortDownloadApi := newDirectCohortDownloadApi(config.CohortSyncConfig.ApiKey, config.CohortSyncConfig.SecretKey, config.CohortSyncConfig.MaxCohortSize, config.CohortSyncConfig.CohortServerUrl, config.LogLevel, config.LoggerProvider)
+			cohortDownloadApi := newDirectCohortDownloadApi(config.CohortSyncConfig.ApiKey, config.CohortSyncConfig.SecretKey, config.CohortSyncConfig.MaxCohortSize, config.CohortSyncConfig.CohortServerUrl, config.CohortSyncConfig.CohortRequestTimeout, config.LogLevel, config.LoggerProvider)
 			cohortLoader = newCohortLoader(cohortDownloadApi, cohortStorage, config.LogLevel, config.LoggerProvider)
+			cohortLoader.deltaDownloads = config.CohortSyncConfig.DeltaDownloads
 		}
 		var flagStreamApi *flagConfigStreamApiV2
 		if config.StreamUpdates {
@@ -82,12 +94,28 @@ func Initialize(apiKey string, config *Config) *Client {
 			config,
 			newFlagConfigApiV2(apiKey, config.ServerUrl, config.FlagConfigPollerRequestTimeout),
 			flagStreamApi, flagConfigStorage, cohortStorage, cohortLoader)
+		restored := false
+		if config.SnapshotConfig != nil {
+			snapshotter := newSnapshotter(apiKey, config.SnapshotConfig, flagConfigStorage, cohortStorage, config.LogLevel, config.LoggerProvider)
+			err := deploymentRunner.restoreSnapshot(snapshotter)
+			if err == nil {
+				restored = true
+			} else if os.IsNotExist(err) {
+				log.Debug("no flag config snapshot to restore")
+			} else {
+				log.Error("failed to restore flag config snapshot: %v", err)
+			}
+		}
+		if config.BootstrapConfig != nil && !restored {
+			if err := deploymentRunner.bootstrap(config.BootstrapConfig); err != nil {
+				log.Error("failed to load bootstrap flag configs: %v", err)
+			}
+		}
 		client = &Client{
 			log:               log,
 			apiKey:            apiKey,
 			config:            config,
 			client:            &http.Client{},
-			poller:            newPoller(),
 			flagsMutex:        &sync.RWMutex{},
 			engine:            evaluation.NewEngine(log),
 			assignmentService: as,
@@ -96,6 +124,7 @@ func Initialize(apiKey string, config *Config) *Client {
 			flagConfigStorage: flagConfigStorage,
 			cohortLoader:      cohortLoader,
 			deploymentRunner:  deploymentRunner,
+			closed:            make(chan struct{}),
 		}
 		client.log.Debug("config: %v", *config)
 		clients[apiKey] = client
@@ -112,6 +141,89 @@ func (c *Client) Start() error {
 	return nil
 }
 
+// Close stops all background flag config and cohort updaters, flushes pending exposure and
+// assignment events, and removes the client from the registry so a subsequent Initialize with
+// the same api key creates a new client. Close blocks until all background work has finished,
+// or until ctx is done, in which case the context's error is returned and shutdown continues in
+// the background. The client must not be started again after Close.
+func (c *Client) Close(ctx context.Context) error {
+	c.closeOnce.Do(func() {
+		initMutex.Lock()
+		if clients[c.apiKey] == c {
+			delete(clients, c.apiKey)
+		}
+		initMutex.Unlock()
+		go func() {
+			c.deploymentRunner.stop()
+			if c.exposureService != nil {
+				c.exposureService.shutdown()
+			}
+			if c.assignmentService != nil {
+				c.assignmentService.shutdown()
+			}
+			close(c.closed)
+		}()
+	})
+	select {
+	case <-c.closed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns a snapshot of the client's readiness: the active flag config updater, the time and
+// version of the last successful flag config sync, the load state of each cohort required by the
+// current flag configs, and the most recent update error.
+func (c *Client) Status() Status {
+	status, _ := c.status()
+	return status
+}
+
+// Ready reports whether flag configs have been synced and, if cohort sync is configured, all
+// cohorts required by the flag configs are loaded.
+func (c *Client) Ready() bool {
+	return c.Status().Ready
+}
+
+// WaitUntilReady blocks until the client is Ready or ctx is done, in which case the context's
+// error is returned.
+func (c *Client) WaitUntilReady(ctx context.Context) error {
+	for {
+		status, changed := c.status()
+		if status.Ready {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (c *Client) status() (Status, <-chan struct{}) {
+	status, changed := c.deploymentRunner.status.snapshot()
+	flagConfigs := getFlagConfigsArray(c.flagConfigStorage)
+	status.FlagCount = len(flagConfigs)
+	status.Cohorts = make(map[string]CohortStatus)
+	cohortsLoaded := true
+	for cohortID := range getAllCohortIDsFromFlags(flagConfigs) {
+		cohortStatus := CohortStatus{}
+		if cohort := c.cohortStorage.GetCohort(cohortID); cohort != nil {
+			cohortStatus.Loaded = true
+			cohortStatus.LastModified = cohort.LastModified
+		}
+		if c.cohortLoader != nil {
+			cohortStatus.LastError = c.cohortLoader.lastError(cohortID)
+		}
+		cohortsLoaded = cohortsLoaded && cohortStatus.Loaded
+		status.Cohorts[cohortID] = cohortStatus
+	}
+	status.Ready = status.FlagConfigVersion > 0 && (c.cohortLoader == nil || cohortsLoaded)
+	return status, changed
+}
+
 // Deprecated: Use EvaluateV2
 func (c *Client) Evaluate(user *experiment.User, flagKeys []string) (map[string]experiment.Variant, error) {
 	variants, err := c.EvaluateV2(user, flagKeys)
@@ -140,24 +252,141 @@ func (c *Client) EvaluateV2(user *experiment.User, flagKeys []string) (map[strin
 }
 
 func (c *Client) EvaluateV2WithOptions(user *experiment.User, options *EvaluateOptions) (map[string]experiment.Variant, error) {
-	flagKeys := options.FlagKeys
-	flagConfigs := c.flagConfigStorage.getFlagConfigs()
-	sortedFlags, err := topologicalSort(flagConfigs, flagKeys)
-	if err != nil {
+	return c.EvaluateWithContext(context.Background(), user, options)
+}
+
+// EvaluateWithContext evaluates flags for the user locally, like EvaluateV2WithOptions, with a context.
+// The context is checked before evaluation, before each cohort membership lookup, and before any
+// exposure or assignment is tracked. If the context is done, evaluation stops, nothing is tracked,
+// and the context's error is returned. The context is also passed to hooks which implement
+// experiment.ContextHook, and to debug logging when the configured LoggerProvider implements
+// logger.ContextLoggerProvider.
+func (c *Client) EvaluateWithContext(ctx context.Context, user *experiment.User, options *EvaluateOptions) (map[string]experiment.Variant, error) {
+	variants := make(map[string]experiment.Variant)
+	if err := c.evaluate(ctx, user, options, variants, false); err != nil {
 		return nil, err
 	}
-	c.requiredCohortsInStorage(sortedFlags)
-	enrichedUser, err := c.enrichUserWithCohorts(user, flagConfigs)
+	return variants, nil
+}
+
+// EvaluateInto evaluates flags for the user like EvaluateWithContext, writing the variants into
+// variants, which is cleared first. It is intended for hot request handlers: evaluation buffers are
+// pooled and reused, and, once warm, evaluating flags which do not target cohorts for users of common
+// property types does not allocate beyond the variants map itself, which the caller may also reuse.
+// The Metadata and Payload of the variants are shared between evaluations and must not be modified.
+// If an error is returned, variants is left empty.
+func (c *Client) EvaluateInto(ctx context.Context, user *experiment.User, options *EvaluateOptions, variants map[string]experiment.Variant) error {
+	clear(variants)
+	if err := c.evaluate(ctx, user, options, variants, true); err != nil {
+		clear(variants)
+		return err
+	}
+	return nil
+}
+
+// evaluationBuffer holds the buffers reused by EvaluateInto.
+type evaluationBuffer struct {
+	context evaluation.ContextBuilder
+	results map[string]evaluation.Variant
+}
+
+var evaluationBufferPool = sync.Pool{
+	New: func() interface{} {
+		return &evaluationBuffer{results: make(map[string]evaluation.Variant)}
+	},
+}
+
+// evaluate evaluates flags for the user into variants. If pooled, pooled buffers are used and the
+// metadata of the variants is shared between evaluations.
+func (c *Client) evaluate(ctx context.Context, user *experiment.User, options *EvaluateOptions, variants map[string]experiment.Variant, pooled bool) error {
+	if options == nil {
+		options = &EvaluateOptions{}
+	}
+	return c.evaluateWithHooks(ctx, user, options.TracksExposure, variants, func(user *experiment.User) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		index := c.flagIndex()
+		sortedFlags, err := index.sortedFlags(options.FlagKeys)
+		if err != nil {
+			return err
+		}
+		c.requiredCohortsInStorage(index, sortedFlags)
+		return c.evaluateFlags(ctx, user, sortedFlags, index.groupedCohortIDsOf(sortedFlags), variants, pooled)
+	})
+}
+
+// evaluateWithHooks calls the BeforeEvaluate hooks, evaluates the user returned by the hooks into
+// variants, calls the AfterEvaluate hooks, and then, if evaluation succeeded, tracks the variants
+// which are not overridden. The context is passed to the hooks and to tracking.
+func (c *Client) evaluateWithHooks(
+	ctx context.Context,
+	user *experiment.User,
+	tracksExposure bool,
+	variants map[string]experiment.Variant,
+	evaluate func(user *experiment.User) error,
+) error {
+	user = hook.Before(ctx, c.log, c.config.Hooks, user)
+	err := evaluate(user)
+	hook.After(ctx, c.log, c.config.Hooks, user, variants, err)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	userContext := evaluation.UserToContext(enrichedUser)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tracksExposure = tracksExposure && c.exposureService != nil
+	if !tracksExposure && c.assignmentService == nil {
+		return nil
+	}
+	trackedVariants := withoutOverrides(variants)
+	if tracksExposure {
+		c.exposureService.Track(ctx, newExposure(user, trackedVariants))
+	}
+	// Deprecated: Assignment tracking is deprecated. Use ExposureService with Exposure tracking instead.
+	if c.assignmentService != nil {
+		c.assignmentService.Track(ctx, newAssignment(user, trackedVariants))
+	}
+	return nil
+}
+
+// evaluateFlags evaluates the sorted flags for the user into variants, enriching the user with
+// the cohorts in the grouped cohort IDs.
+func (c *Client) evaluateFlags(
+	ctx context.Context,
+	user *experiment.User,
+	sortedFlags []*evaluation.Flag,
+	groupedCohortIDs map[string]map[string]struct{},
+	variants map[string]experiment.Variant,
+	pooled bool,
+) error {
+	enrichedUser, err := c.enrichUserWithCohorts(ctx, user, groupedCohortIDs)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	c.log.Debug("evaluate:\n\t- user: %v\n\t- flags: %v\n", user, sortedFlags)
-	results := c.engine.Evaluate(userContext, sortedFlags)
-	variants := make(map[string]experiment.Variant)
+	sortedFlags = c.overrides.apply(enrichedUser, sortedFlags)
+	if pooled {
+		buffer := evaluationBufferPool.Get().(*evaluationBuffer)
+		userContext := buffer.context.Build(enrichedUser)
+		c.logEvaluation(ctx, user, sortedFlags)
+		c.engine.EvaluateInto(userContext, sortedFlags, buffer.results)
+		putVariants(variants, buffer.results)
+		evaluationBufferPool.Put(buffer)
+	} else {
+		userContext := evaluation.UserToContext(enrichedUser)
+		c.logEvaluation(ctx, user, sortedFlags)
+		putVariants(variants, c.engine.Evaluate(userContext, sortedFlags))
+	}
+	return ctx.Err()
+}
+
+func (c *Client) logEvaluation(ctx context.Context, user *experiment.User, sortedFlags []*evaluation.Flag) {
+	if c.log.Enabled(logger.Debug) {
+		c.log.DebugContext(ctx, "evaluate:\n\t- user: %v\n\t- flags: %v\n", user, sortedFlags)
+	}
+}
+
+func putVariants(variants map[string]experiment.Variant, results map[string]evaluation.Variant) {
 	for key, result := range results {
 		variants[key] = experiment.Variant{
 			Key:      result.Key,
@@ -166,14 +395,60 @@ func (c *Client) EvaluateV2WithOptions(user *experiment.User, options *EvaluateO
 			Metadata: result.Metadata,
 		}
 	}
-	if options.TracksExposure {
-		c.exposureService.Track(newExposure(user, variants))
+}
+
+// EvaluateFlag evaluates a single flag for the user locally, like EvaluateV2 with the flag's key,
+// but only resolves the flag's dependencies and only looks up the cohorts targeted by the flag and
+// its dependencies. The variant is returned even if it is the flag's default variant. If the flag
+// does not exist, an *experiment.VariationError with reason experiment.VariationFlagNotFound is
+// returned.
+func (c *Client) EvaluateFlag(user *experiment.User, flagKey string) (experiment.Variant, error) {
+	variants := make(map[string]experiment.Variant)
+	ctx := context.Background()
+	err := c.evaluateWithHooks(ctx, user, false, variants, func(user *experiment.User) error {
+		index := c.flagIndex()
+		closure, ok := index.closure(flagKey)
+		if !ok {
+			return &experiment.VariationError{FlagKey: flagKey, Reason: experiment.VariationFlagNotFound}
+		}
+		if closure.err != nil {
+			return closure.err
+		}
+		c.requiredCohortsInStorage(index, closure.flags)
+		return c.evaluateFlags(ctx, user, closure.flags, closure.groupedCohortIDs, variants, false)
+	})
+	if err != nil {
+		return experiment.Variant{}, err
 	}
-	// Deprecated: Assignment tracking is deprecated. Use ExposureService with Exposure tracking instead.
-	if c.assignmentService != nil {
-		c.assignmentService.Track(newAssignment(user, variants))
+	return variants[flagKey], nil
+}
+
+// Explain evaluates the flag for the user and returns a trace of the evaluation: each segment
+// considered, each condition with the user's property value and whether it matched, the bucketing
+// of the user, and the results of the flag's dependencies. As in EvaluateFlag, the user is passed
+// through the BeforeEvaluate hooks and overrides are applied, so an overridden flag is traced as a
+// single segment with the metadata "overridden". AfterEvaluate hooks are not called, and exposures
+// are not tracked. If the flag does not exist, an *experiment.VariationError with reason
+// experiment.VariationFlagNotFound is returned.
+func (c *Client) Explain(user *experiment.User, flagKey string) (*EvaluationTrace, error) {
+	ctx := context.Background()
+	index := c.flagIndex()
+	closure, ok := index.closure(flagKey)
+	if !ok {
+		return nil, &experiment.VariationError{FlagKey: flagKey, Reason: experiment.VariationFlagNotFound}
+	}
+	if closure.err != nil {
+		return nil, closure.err
+	}
+	user = hook.Before(ctx, c.log, c.config.Hooks, user)
+	enrichedUser, err := c.enrichUserWithCohorts(ctx, user, closure.groupedCohortIDs)
+	if err != nil {
+		return nil, err
 	}
-	return variants, nil
+	sortedFlags := c.overrides.apply(enrichedUser, closure.flags)
+	userContext := evaluation.UserToContext(enrichedUser)
+	_, trace := c.engine.EvaluateWithTrace(userContext, sortedFlags, flagKey)
+	return trace, nil
 }
 
 func (c *Client) FlagsV2() (string, error) {
@@ -191,7 +466,7 @@ func (c *Client) FlagsV2() (string, error) {
 
 // FlagMetadata returns a copy of the flag's metadata. If the flag is not found then nil is returned.
 func (c *Client) FlagMetadata(flagKey string) map[string]interface{} {
-	f := c.flagConfigStorage.getFlagConfig(flagKey)
+	f := c.flagConfigStorage.GetFlagConfig(flagKey)
 	if f == nil {
 		return nil
 	}
@@ -204,6 +479,17 @@ func (c *Client) FlagMetadata(flagKey string) map[string]interface{} {
 	return metadata
 }
 
+// FlagKeys returns the sorted keys of the flags whose configs are known.
+func (c *Client) FlagKeys() []string {
+	flagConfigs := c.flagConfigStorage.GetFlagConfigs()
+	flagKeys := make([]string, 0, len(flagConfigs))
+	for flagKey := range flagConfigs {
+		flagKeys = append(flagKeys, flagKey)
+	}
+	sort.Strings(flagKeys)
+	return flagKeys
+}
+
 func (c *Client) doFlagsV2() (map[string]*evaluation.Flag, error) {
 	client := &http.Client{}
 	endpoint, err := url.Parse("https://api.lab.amplitude.com/")
@@ -357,8 +643,11 @@ func contains(s []string, e string) bool {
 }
 
 func coerceString(value interface{}) string {
-	if value == nil {
+	switch v := value.(type) {
+	case nil:
 		return ""
+	case string:
+		return v
 	}
 	kind := reflect.TypeOf(value).Kind()
 	if kind == reflect.Map || kind == reflect.Slice || kind == reflect.Array {
@@ -370,10 +659,26 @@ func coerceString(value interface{}) string {
 	return fmt.Sprintf("%v", value)
 }
 
-func (c *Client) requiredCohortsInStorage(flagConfigs []*evaluation.Flag) {
-	storedCohortIDs := c.cohortStorage.getCohortIds()
+// flagIndex returns the index of the flag configs in storage.
+func (c *Client) flagIndex() *flagIndex {
+	return c.deploymentRunner.index.current(c.flagConfigStorage)
+}
+
+func (c *Client) requiredCohortsInStorage(index *flagIndex, flagConfigs []*evaluation.Flag) {
+	// Stored cohort IDs are only read to log missing cohorts, which may be a round trip for a
+	// custom CohortStorage.
+	if !c.log.Enabled(logger.Debug) {
+		return
+	}
+	var storedCohortIDs map[string]struct{}
 	for _, flag := range flagConfigs {
-		flagCohortIDs := getAllCohortIDsFromFlag(flag)
+		flagCohortIDs := index.flagCohortIDs(flag)
+		if len(flagCohortIDs) == 0 {
+			continue
+		}
+		if storedCohortIDs == nil {
+			storedCohortIDs = c.cohortStorage.GetCohortIds()
+		}
 		missingCohorts := difference(flagCohortIDs, storedCohortIDs)
 
 		if len(missingCohorts) > 0 {
@@ -392,17 +697,19 @@ func (c *Client) requiredCohortsInStorage(flagConfigs []*evaluation.Flag) {
 	}
 }
 
-func (c *Client) enrichUserWithCohorts(user *experiment.User, flagConfigs map[string]*evaluation.Flag) (*experiment.User, error) {
-	flagConfigSlice := make([]*evaluation.Flag, 0, len(flagConfigs))
-
-	for _, value := range flagConfigs {
-		flagConfigSlice = append(flagConfigSlice, value)
-	}
-	groupedCohortIDs := getGroupedCohortIDsFromFlags(flagConfigSlice)
-
+// enrichUserWithCohorts sets the user's and groups' cohort IDs from cohort storage. The grouped cohort
+// IDs are the cohort IDs targeted by the flag configs, by group type.
+func (c *Client) enrichUserWithCohorts(ctx context.Context, user *experiment.User, groupedCohortIDs map[string]map[string]struct{}) (*experiment.User, error) {
 	if cohortIDs, ok := groupedCohortIDs[userGroupType]; ok {
 		if len(cohortIDs) > 0 && user.UserId != "" {
-			user.CohortIds = c.cohortStorage.getCohortsForUser(user.UserId, cohortIDs)
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			userCohortIDs, err := c.cohortStorage.GetCohortsForUser(ctx, user.UserId, cohortIDs)
+			if err != nil {
+				return nil, err
+			}
+			user.CohortIds = userCohortIDs
 		}
 	}
 
@@ -416,7 +723,14 @@ func (c *Client) enrichUserWithCohorts(user *experiment.User, flagConfigs map[st
 				continue
 			}
 			if cohortIDs, ok := groupedCohortIDs[groupType]; ok {
-				user.AddGroupCohortIds(groupType, groupName, c.cohortStorage.getCohortsForGroup(groupType, groupName, cohortIDs))
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				groupCohortIDs, err := c.cohortStorage.GetCohortsForGroup(ctx, groupType, groupName, cohortIDs)
+				if err != nil {
+					return nil, err
+				}
+				user.AddGroupCohortIds(groupType, groupName, groupCohortIDs)
 			}
 		}
 	}
@@ -0,0 +1,71 @@
+//go:build !race
+
+package local
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// Evaluation buffers are pooled, and sync.Pool drops pooled values at random under the race
+// detector, so allocations are not measured with it enabled.
+
+var allocsFlagsStr = []byte(`[
+  {
+    "key": "targeted",
+    "variants": {"on": {"key": "on", "value": "on"}, "off": {"key": "off", "metadata": {"default": true}}},
+    "segments": [
+      {"conditions": [[{"selector": ["context", "user", "country"], "op": "is", "values": ["US", "CA"]}]], "variant": "on"},
+      {"conditions": [[{"selector": ["context", "user", "user_properties", "plan"], "op": "is", "values": ["enterprise"]}]], "variant": "on"},
+      {"variant": "off"}
+    ]
+  },
+  {
+    "key": "rollout",
+    "dependencies": ["targeted"],
+    "variants": {"control": {"key": "control", "value": "control"}, "treatment": {"key": "treatment", "value": "treatment"}},
+    "segments": [
+      {
+        "conditions": [[{"selector": ["result", "targeted", "key"], "op": "is", "values": ["on"]}]],
+        "bucket": {
+          "selector": ["context", "user", "user_id"],
+          "salt": "salt",
+          "allocations": [{"range": [0, 100], "distributions": [{"variant": "control", "range": [0, 21474837]}, {"variant": "treatment", "range": [21474837, 42949673]}]}]
+        }
+      }
+    ]
+  }
+]`)
+
+func TestEvaluateIntoAllocs(t *testing.T) {
+	server := newTestFlagServer(allocsFlagsStr, nil)
+	defer server.Close()
+	client := Initialize("server-evaluate-into-allocs-test", &Config{
+		ServerUrl: server.URL,
+		LogLevel:  logger.Error,
+	})
+	defer func() { _ = client.Close(context.Background()) }()
+	assert.Nil(t, client.Start())
+
+	ctx := context.Background()
+	user := &experiment.User{
+		UserId:         "user_id",
+		DeviceId:       "device_id",
+		Country:        "GB",
+		UserProperties: map[string]interface{}{"plan": "enterprise"},
+	}
+	options := &EvaluateOptions{}
+	variants := make(map[string]experiment.Variant)
+	assert.Nil(t, client.EvaluateInto(ctx, user, options, variants))
+	assert.Equal(t, "on", variants["targeted"].Key)
+	assert.NotEmpty(t, variants["rollout"].Key)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = client.EvaluateInto(ctx, user, options, variants)
+	})
+	assert.Equal(t, float64(0), allocs)
+}
@@ -0,0 +1,124 @@
+package local
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amplitude/analytics-go/amplitude"
+	"github.com/amplitude/experiment-go-server/internal/evaluation"
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFlagServer serves the given flag configs on the v2 flags endpoint and counts flag requests.
+func newTestFlagServer(flagsJson []byte, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sdk/v2/flags" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if requests != nil {
+			atomic.AddInt32(requests, 1)
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(flagsJson)
+	}))
+}
+
+// newTestClient starts a client with the config, whose flag configs are served from flagsJson by a
+// test flag server. The client is closed when the test ends. Exposure events tracked by the client
+// are recorded in the returned events instead of being sent.
+func newTestClient(t *testing.T, flagsJson []byte, config *Config) (*Client, *[]amplitude.Event) {
+	server := newTestFlagServer(flagsJson, nil)
+	t.Cleanup(server.Close)
+	if config == nil {
+		config = &Config{}
+	}
+	config.ServerUrl = server.URL
+	if config.LogLevel == logger.Unknown {
+		config.LogLevel = logger.Error
+	}
+	if config.ExposureConfig == nil {
+		config.ExposureConfig = &ExposureConfig{Config: amplitude.Config{APIKey: "some_api_key"}}
+	}
+	client := Initialize("server-"+t.Name(), config)
+	t.Cleanup(func() { _ = client.Close(context.Background()) })
+	require.Nil(t, client.Start())
+	trackedEvents := make([]amplitude.Event, 0)
+	client.exposureService.amplitude = &mockAmplitudeClientForTest{trackedEvents: &trackedEvents}
+	return client, &trackedEvents
+}
+
+func TestClientCloseStopsPollingAndRemovesClient(t *testing.T) {
+	var requests int32
+	server := newTestFlagServer(FLAG_1_STR, &requests)
+	defer server.Close()
+
+	apiKey := "server-close-test"
+	client := Initialize(apiKey, &Config{
+		ServerUrl:                server.URL,
+		FlagConfigPollerInterval: 50 * time.Millisecond,
+		LogLevel:                 logger.Error,
+	})
+	err := client.Start()
+	assert.Nil(t, err)
+	time.Sleep(150 * time.Millisecond)
+	assert.Greater(t, atomic.LoadInt32(&requests), int32(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = client.Close(ctx)
+	assert.Nil(t, err)
+
+	// No more polling after close.
+	requestsAfterClose := atomic.LoadInt32(&requests)
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, requestsAfterClose, atomic.LoadInt32(&requests))
+
+	// Client removed from registry.
+	initMutex.Lock()
+	_, exists := clients[apiKey]
+	initMutex.Unlock()
+	assert.False(t, exists)
+	assert.NotSame(t, client, Initialize(apiKey, &Config{ServerUrl: server.URL}))
+
+	// Close is idempotent.
+	assert.Nil(t, client.Close(ctx))
+}
+
+func TestClientCloseReturnsContextError(t *testing.T) {
+	var blocking int32
+	block := make(chan struct{})
+	flagAPI := &mockFlagConfigApi{getFlagConfigsFunc: func() (map[string]*evaluation.Flag, error) {
+		if atomic.LoadInt32(&blocking) == 1 {
+			<-block
+		}
+		return FLAG_1, nil
+	}}
+	config := &Config{FlagConfigPollerInterval: 10 * time.Millisecond, LogLevel: logger.Error, LoggerProvider: logger.NewDefault()}
+	client := &Client{
+		apiKey:           "server-close-timeout-test",
+		config:           config,
+		deploymentRunner: newDeploymentRunner(config, flagAPI, nil, newInMemoryFlagConfigStorage(), newInMemoryCohortStorage(), nil),
+		closed:           make(chan struct{}),
+	}
+	err := client.Start()
+	assert.Nil(t, err)
+
+	// Block a poll in flight so stopping cannot complete.
+	atomic.StoreInt32(&blocking, 1)
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = client.Close(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(block)
+	assert.Nil(t, client.Close(context.Background()))
+}
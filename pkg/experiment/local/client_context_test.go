@@ -0,0 +1,78 @@
+package local
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/stretchr/testify/assert"
+)
+
+var testOnFlagStr = []byte(`[{"key":"test-on","variants":{"on":{"key":"on","value":"on"},"off":{"key":"off","metadata":{"default":true}}},"segments":[{"variant":"on"}]}]`)
+
+func TestEvaluateWithContext(t *testing.T) {
+	client, trackedEvents := newTestClient(t, testOnFlagStr, nil)
+
+	user := &experiment.User{UserId: "user_id"}
+	variants, err := client.EvaluateWithContext(context.Background(), user, &EvaluateOptions{TracksExposure: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "on", variants["test-on"].Key)
+	assert.Equal(t, 1, len(*trackedEvents))
+}
+
+func TestEvaluateWithContextCancelled(t *testing.T) {
+	client, trackedEvents := newTestClient(t, testOnFlagStr, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	user := &experiment.User{UserId: "user_id"}
+	variants, err := client.EvaluateWithContext(ctx, user, &EvaluateOptions{TracksExposure: true})
+	assert.Equal(t, context.Canceled, err)
+	assert.Nil(t, variants)
+	assert.Equal(t, 0, len(*trackedEvents))
+}
+
+func TestEvaluateWithContextNilOptions(t *testing.T) {
+	client, _ := newTestClient(t, testOnFlagStr, nil)
+	variants, err := client.EvaluateWithContext(context.Background(), &experiment.User{UserId: "user_id"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "on", variants["test-on"].Key)
+}
+
+func TestExplain(t *testing.T) {
+	client, trackedEvents := newTestClient(t, testOnFlagStr, nil)
+
+	trace, err := client.Explain(&experiment.User{UserId: "user_id"}, "test-on")
+	assert.Nil(t, err)
+	assert.Equal(t, "test-on", trace.FlagKey)
+	assert.Equal(t, "on", trace.Variant.Key)
+	assert.Equal(t, 1, len(trace.Segments))
+	assert.True(t, trace.Segments[0].Matched)
+	assert.Equal(t, "on", trace.Segments[0].VariantKey)
+	assert.Equal(t, 0, len(*trackedEvents))
+
+	trace, err = client.Explain(&experiment.User{UserId: "user_id"}, "missing")
+	var variationErr *experiment.VariationError
+	assert.ErrorAs(t, err, &variationErr)
+	assert.Equal(t, experiment.VariationFlagNotFound, variationErr.Reason)
+	assert.ErrorIs(t, err, experiment.ErrFlagNotFound)
+	assert.Nil(t, trace)
+}
+
+func TestEvaluateInto(t *testing.T) {
+	client, trackedEvents := newTestClient(t, testOnFlagStr, nil)
+
+	variants := map[string]experiment.Variant{"stale": {Key: "stale"}}
+	err := client.EvaluateInto(context.Background(), &experiment.User{UserId: "user_id"}, &EvaluateOptions{TracksExposure: true}, variants)
+	assert.Nil(t, err)
+	expected, err := client.EvaluateWithContext(context.Background(), &experiment.User{UserId: "user_id"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, variants)
+	assert.Equal(t, 1, len(*trackedEvents))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = client.EvaluateInto(ctx, &experiment.User{UserId: "user_id"}, nil, variants)
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, variants)
+}
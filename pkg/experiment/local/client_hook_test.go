@@ -0,0 +1,157 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCountryFlagStr = []byte(`[{"key":"test-country","variants":{"on":{"key":"on","value":"on"},"off":{"key":"off","metadata":{"default":true}}},
+  "segments":[{"conditions":[[{"selector":["context","user","country"],"op":"is","values":["US"]}]],"variant":"on"},{"variant":"off"}]}]`)
+
+// testEvaluationHook sets the country of each user and overrides the variants of QA users.
+type testEvaluationHook struct {
+	users  []*experiment.User
+	errors []error
+}
+
+func (h *testEvaluationHook) BeforeEvaluate(user *experiment.User) *experiment.User {
+	return &experiment.User{UserId: user.UserId, Country: "US"}
+}
+
+func (h *testEvaluationHook) AfterEvaluate(user *experiment.User, variants map[string]experiment.Variant, err error) {
+	h.users = append(h.users, user)
+	h.errors = append(h.errors, err)
+	if user.UserId == "qa_user" && err == nil {
+		variants["test-country"] = experiment.Variant{Key: "qa", Value: "qa"}
+	}
+}
+
+type panickingEvaluationHook struct{}
+
+func (panickingEvaluationHook) BeforeEvaluate(*experiment.User) *experiment.User {
+	panic("before")
+}
+
+func (panickingEvaluationHook) AfterEvaluate(*experiment.User, map[string]experiment.Variant, error) {
+	panic("after")
+}
+
+func TestClientHooks(t *testing.T) {
+	hook := &testEvaluationHook{}
+	client, trackedEvents := newTestClient(t, testCountryFlagStr, &Config{
+		LogLevel: logger.Disable,
+		Hooks:    []experiment.Hook{hook, panickingEvaluationHook{}},
+	})
+
+	variants, err := client.EvaluateV2WithOptions(&experiment.User{UserId: "user_id"}, &EvaluateOptions{TracksExposure: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "on", variants["test-country"].Key)
+	variants, err = client.EvaluateV2WithOptions(&experiment.User{UserId: "qa_user"}, &EvaluateOptions{TracksExposure: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "qa", variants["test-country"].Key)
+	require.Equal(t, 2, len(*trackedEvents))
+	assert.Equal(t, "qa", (*trackedEvents)[1].EventProperties["[Experiment] Variant"])
+
+	variant, err := client.EvaluateFlag(&experiment.User{UserId: "qa_user"}, "test-country")
+	assert.Nil(t, err)
+	assert.Equal(t, "qa", variant.Key)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.EvaluateWithContext(ctx, &experiment.User{UserId: "user_id"}, nil)
+	assert.Equal(t, context.Canceled, err)
+
+	// Explain traces the user returned by the BeforeEvaluate hooks.
+	trace, err := client.Explain(&experiment.User{UserId: "user_id"}, "test-country")
+	assert.Nil(t, err)
+	assert.Equal(t, "on", trace.Variant.Key)
+
+	require.Equal(t, 4, len(hook.users))
+	assert.Equal(t, &experiment.User{UserId: "user_id", Country: "US"}, hook.users[0])
+	assert.Nil(t, hook.errors[0])
+	assert.True(t, errors.Is(hook.errors[3], context.Canceled))
+}
+
+type testContextKey struct{}
+
+// testContextEvaluationHook records the context value passed to it, and cancels the evaluation
+// after the flags are evaluated.
+type testContextEvaluationHook struct {
+	testEvaluationHook
+	values []interface{}
+	cancel context.CancelFunc
+}
+
+func (h *testContextEvaluationHook) BeforeEvaluateContext(ctx context.Context, user *experiment.User) *experiment.User {
+	h.values = append(h.values, ctx.Value(testContextKey{}))
+	return h.BeforeEvaluate(user)
+}
+
+func (h *testContextEvaluationHook) AfterEvaluateContext(ctx context.Context, user *experiment.User, variants map[string]experiment.Variant, err error) {
+	h.values = append(h.values, ctx.Value(testContextKey{}))
+	h.AfterEvaluate(user, variants, err)
+	if h.cancel != nil {
+		h.cancel()
+	}
+}
+
+func TestClientContextHooks(t *testing.T) {
+	hook := &testContextEvaluationHook{}
+	client, trackedEvents := newTestClient(t, testCountryFlagStr, &Config{
+		LogLevel: logger.Disable,
+		Hooks:    []experiment.Hook{hook},
+	})
+
+	ctx := context.WithValue(context.Background(), testContextKey{}, "value")
+	variants, err := client.EvaluateWithContext(ctx, &experiment.User{UserId: "user_id"}, &EvaluateOptions{TracksExposure: true})
+	require.Nil(t, err)
+	assert.Equal(t, "on", variants["test-country"].Key)
+	assert.Equal(t, []interface{}{"value", "value"}, hook.values)
+	assert.Equal(t, 1, len(*trackedEvents))
+
+	// Nothing is tracked once the context is done.
+	ctx, hook.cancel = context.WithCancel(ctx)
+	_, err = client.EvaluateWithContext(ctx, &experiment.User{UserId: "user_id"}, &EvaluateOptions{TracksExposure: true})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, len(*trackedEvents))
+}
+
+var testMetadataFlagStr = []byte(`[{"key":"test-metadata","metadata":{"flagType":"experiment"},"variants":{"on":{"key":"on","value":"on"}},"segments":[{"variant":"on"}]}]`)
+
+// traceEvaluationHook adds a trace ID to the metadata of each variant, and records the trace ID the
+// metadata already had.
+type traceEvaluationHook struct {
+	previous []interface{}
+}
+
+func (h *traceEvaluationHook) BeforeEvaluate(*experiment.User) *experiment.User {
+	return nil
+}
+
+func (h *traceEvaluationHook) AfterEvaluate(_ *experiment.User, variants map[string]experiment.Variant, _ error) {
+	for _, variant := range variants {
+		h.previous = append(h.previous, variant.Metadata["traceId"])
+		variant.Metadata["traceId"] = len(h.previous)
+	}
+}
+
+func TestClientHooksModifyMetadata(t *testing.T) {
+	hook := &traceEvaluationHook{}
+	client, _ := newTestClient(t, testMetadataFlagStr, &Config{Hooks: []experiment.Hook{hook}})
+
+	for i := 1; i <= 2; i++ {
+		variants := make(map[string]experiment.Variant)
+		err := client.EvaluateInto(context.Background(), &experiment.User{UserId: "user_id"}, nil, variants)
+		require.Nil(t, err)
+		assert.Equal(t, i, variants["test-metadata"].Metadata["traceId"])
+		assert.Equal(t, "experiment", variants["test-metadata"].Metadata["flagType"])
+	}
+	// The metadata written by the hook is not shared with later evaluations.
+	assert.Equal(t, []interface{}{nil, nil}, hook.previous)
+}
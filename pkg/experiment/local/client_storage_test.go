@@ -0,0 +1,171 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/internal/evaluation"
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readOnlyFlagConfigStorage ignores writes, like a storage populated by a sidecar.
+type readOnlyFlagConfigStorage struct {
+	*inMemoryFlagConfigStorage
+}
+
+func (s *readOnlyFlagConfigStorage) PutFlagConfig(*FlagConfig) {}
+
+func (s *readOnlyFlagConfigStorage) RemoveIf(func(*FlagConfig) bool) {}
+
+type failingCohortStorage struct {
+	*inMemoryCohortStorage
+	err error
+}
+
+func (s *failingCohortStorage) GetCohortsForUser(context.Context, string, map[string]struct{}) (map[string]struct{}, error) {
+	return nil, s.err
+}
+
+func newReadOnlyFlagConfigStorage(t *testing.T, flagsJson []byte) *readOnlyFlagConfigStorage {
+	var flags []*FlagConfig
+	require.Nil(t, json.Unmarshal(flagsJson, &flags))
+	storage := newInMemoryFlagConfigStorage()
+	for _, flag := range flags {
+		storage.PutFlagConfig(flag)
+	}
+	return &readOnlyFlagConfigStorage{storage}
+}
+
+func TestClientCustomFlagConfigStorage(t *testing.T) {
+	client, _ := newTestClient(t, []byte(`[]`), &Config{
+		FlagConfigStorage: newReadOnlyFlagConfigStorage(t, testOnFlagStr),
+	})
+
+	variants, err := client.EvaluateV2(&experiment.User{UserId: "user_id"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "on", variants["test-on"].Key)
+	assert.Equal(t, []string{"test-on"}, client.FlagKeys())
+}
+
+// versionedFlagConfigStorage counts reads of its flag configs, which are only indexed again when
+// the version changes.
+type versionedFlagConfigStorage struct {
+	*readOnlyFlagConfigStorage
+	version uint64
+	reads   int32
+}
+
+func (s *versionedFlagConfigStorage) Version() uint64 {
+	return atomic.LoadUint64(&s.version)
+}
+
+func (s *versionedFlagConfigStorage) GetFlagConfigs() map[string]*FlagConfig {
+	atomic.AddInt32(&s.reads, 1)
+	return s.readOnlyFlagConfigStorage.GetFlagConfigs()
+}
+
+func TestClientCustomFlagConfigStorageUpdatedExternally(t *testing.T) {
+	flagConfigStorage := newReadOnlyFlagConfigStorage(t, testOnFlagStr)
+	flag := flagConfigStorage.GetFlagConfig("test-on")
+	updated := &FlagConfig{Key: flag.Key, Variants: flag.Variants, Segments: []*evaluation.Segment{{Variant: "off"}}}
+	client, _ := newTestClient(t, []byte(`[]`), &Config{FlagConfigStorage: flagConfigStorage})
+	variants, err := client.EvaluateV2(&experiment.User{UserId: "user_id"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "on", variants["test-on"].Key)
+
+	// The flag configs are read on each evaluation, but no index of every flag is built for them.
+	assert.Nil(t, client.deploymentRunner.index.get())
+	assert.Nil(t, client.flagIndex().closures)
+
+	// Flag configs written by another process are evaluated.
+	flagConfigStorage.inMemoryFlagConfigStorage.PutFlagConfig(updated)
+	variants, err = client.EvaluateV2(&experiment.User{UserId: "user_id"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "off", variants["test-on"].Key)
+}
+
+func TestClientVersionedFlagConfigStorage(t *testing.T) {
+	flagConfigStorage := &versionedFlagConfigStorage{readOnlyFlagConfigStorage: newReadOnlyFlagConfigStorage(t, testOnFlagStr)}
+	flag := flagConfigStorage.GetFlagConfig("test-on")
+	updated := &FlagConfig{Key: flag.Key, Variants: flag.Variants, Segments: []*evaluation.Segment{{Variant: "off"}}}
+	client, _ := newTestClient(t, []byte(`[]`), &Config{FlagConfigStorage: flagConfigStorage})
+	_, err := client.EvaluateV2(&experiment.User{UserId: "user_id"}, nil)
+	assert.Nil(t, err)
+	reads := atomic.LoadInt32(&flagConfigStorage.reads)
+
+	// The storage is only read again once its version changes.
+	flagConfigStorage.inMemoryFlagConfigStorage.PutFlagConfig(updated)
+	variants, err := client.EvaluateV2(&experiment.User{UserId: "user_id"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "on", variants["test-on"].Key)
+	assert.Equal(t, reads, atomic.LoadInt32(&flagConfigStorage.reads))
+	atomic.AddUint64(&flagConfigStorage.version, 1)
+	variants, err = client.EvaluateV2(&experiment.User{UserId: "user_id"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "off", variants["test-on"].Key)
+	assert.Equal(t, reads+1, atomic.LoadInt32(&flagConfigStorage.reads))
+}
+
+func TestClientCustomCohortStorageError(t *testing.T) {
+	flagConfigStorage := newReadOnlyFlagConfigStorage(t, []byte(`[]`))
+	flagConfigStorage.inMemoryFlagConfigStorage.PutFlagConfig(createTestFlag())
+	cohortErr := errors.New("cohort storage unavailable")
+	client, _ := newTestClient(t, []byte(`[]`), &Config{
+		FlagConfigStorage: flagConfigStorage,
+		CohortStorage:     &failingCohortStorage{newInMemoryCohortStorage(), cohortErr},
+	})
+
+	variants, err := client.EvaluateV2(&experiment.User{UserId: "user_id"}, nil)
+	assert.Equal(t, cohortErr, err)
+	assert.Nil(t, variants)
+}
+
+// recordingCohortStorage records the cohort IDs of each user membership lookup.
+type recordingCohortStorage struct {
+	*inMemoryCohortStorage
+	lookups []map[string]struct{}
+}
+
+func (s *recordingCohortStorage) GetCohortsForUser(ctx context.Context, userID string, cohortIDs map[string]struct{}) (map[string]struct{}, error) {
+	s.lookups = append(s.lookups, cohortIDs)
+	return s.inMemoryCohortStorage.GetCohortsForUser(ctx, userID, cohortIDs)
+}
+
+var testCohortDependencyFlagsStr = []byte(`[
+  {"key": "dependency", "variants": {"on": {"key": "on", "value": "on"}},
+   "segments": [{"conditions": [[{"selector": ["context", "user", "cohort_ids"], "op": "set contains any", "values": ["a"]}]], "variant": "on"}]},
+  {"key": "parent", "dependencies": ["dependency"], "variants": {"on": {"key": "on", "value": "on"}, "off": {"key": "off", "metadata": {"default": true}}},
+   "segments": [{"conditions": [[{"selector": ["result", "dependency", "key"], "op": "is", "values": ["on"]}]], "variant": "on"}, {"variant": "off"}]},
+  {"key": "other", "variants": {"on": {"key": "on", "value": "on"}},
+   "segments": [{"conditions": [[{"selector": ["context", "user", "cohort_ids"], "op": "set contains any", "values": ["b"]}]], "variant": "on"}]}
+]`)
+
+func TestClientEvaluateFlag(t *testing.T) {
+	cohortStorage := &recordingCohortStorage{inMemoryCohortStorage: newInMemoryCohortStorage()}
+	require.Nil(t, cohortStorage.PutCohort(&Cohort{Id: "a", GroupType: userGroupType, Size: 1, MemberIds: []string{"user_id"}}))
+	client, _ := newTestClient(t, []byte(`[]`), &Config{
+		FlagConfigStorage: newReadOnlyFlagConfigStorage(t, testCohortDependencyFlagsStr),
+		CohortStorage:     cohortStorage,
+	})
+
+	variant, err := client.EvaluateFlag(&experiment.User{UserId: "user_id"}, "parent")
+	assert.Nil(t, err)
+	assert.Equal(t, "on", variant.Key)
+	assert.Equal(t, []map[string]struct{}{{"a": {}}}, cohortStorage.lookups)
+
+	variant, err = client.EvaluateFlag(&experiment.User{UserId: "other_user_id"}, "parent")
+	assert.Nil(t, err)
+	assert.Equal(t, "off", variant.Key)
+
+	variant, err = client.EvaluateFlag(&experiment.User{UserId: "user_id"}, "missing")
+	assert.Equal(t, experiment.Variant{}, variant)
+	var variationErr *experiment.VariationError
+	require.True(t, errors.As(err, &variationErr))
+	assert.Equal(t, experiment.VariationFlagNotFound, variationErr.Reason)
+	assert.ErrorIs(t, err, experiment.ErrFlagNotFound)
+}
@@ -32,3 +32,48 @@ func CohortEquals(c1, c2 *Cohort) bool {
 
 	return true
 }
+
+// CohortDelta is the change to a cohort's members between two versions of the cohort.
+type CohortDelta struct {
+	Id string `json:"cohortId"`
+	// BaseLastModified is the last modified timestamp of the version the delta applies to.
+	BaseLastModified int64 `json:"baseLastModified"`
+	LastModified     int64 `json:"lastModified"`
+	// Size is the size of the cohort after the delta is applied.
+	Size             int      `json:"size"`
+	GroupType        string   `json:"groupType"`
+	AddedMemberIds   []string `json:"addedMemberIds"`
+	RemovedMemberIds []string `json:"removedMemberIds"`
+}
+
+// apply returns a new cohort with the delta applied to the given cohort. It returns false if the
+// delta does not apply to the cohort, or if the patched cohort does not have the expected size.
+func (d *CohortDelta) apply(cohort *Cohort) (*Cohort, bool) {
+	if d.Id != cohort.Id || d.BaseLastModified != cohort.LastModified || d.GroupType != cohort.GroupType {
+		return nil, false
+	}
+	members := make(map[string]struct{}, len(cohort.MemberIds)+len(d.AddedMemberIds))
+	for _, memberID := range cohort.MemberIds {
+		members[memberID] = struct{}{}
+	}
+	for _, memberID := range d.RemovedMemberIds {
+		delete(members, memberID)
+	}
+	for _, memberID := range d.AddedMemberIds {
+		members[memberID] = struct{}{}
+	}
+	if len(members) != d.Size {
+		return nil, false
+	}
+	memberIds := make([]string, 0, len(members))
+	for memberID := range members {
+		memberIds = append(memberIds, memberID)
+	}
+	return &Cohort{
+		Id:           cohort.Id,
+		LastModified: d.LastModified,
+		Size:         d.Size,
+		MemberIds:    memberIds,
+		GroupType:    cohort.GroupType,
+	}, true
+}
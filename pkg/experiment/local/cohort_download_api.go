@@ -4,8 +4,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"github.com/amplitude/experiment-go-server/pkg/logger"
 	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/amplitude/experiment-go-server/pkg/logger"
 	"net/http"
 	"strconv"
 	"time"
@@ -17,17 +17,26 @@ type cohortDownloadApi interface {
 	getCohort(cohortID string, cohort *Cohort) (*Cohort, error)
 }
 
+// cohortDeltaDownloadApi is implemented by cohort download apis which can download the changes to a
+// cohort's members since the stored cohort was last modified.
+type cohortDeltaDownloadApi interface {
+	// getCohortDelta returns nil if the cohort is not modified.
+	getCohortDelta(cohortID string, cohort *Cohort) (*CohortDelta, error)
+}
+
 type directCohortDownloadApi struct {
 	ApiKey        string
 	SecretKey     string
 	MaxCohortSize int
 	ServerUrl     string
+	client        *http.Client
 	log           *logger.Logger
 }
 
 func newDirectCohortDownloadApi(apiKey, secretKey string, 
 	maxCohortSize int, 
 	serverUrl string, 
+	requestTimeout time.Duration,
 	logLevel logger.LogLevel,
 	loggerProvider logger.LoggerProvider) *directCohortDownloadApi {
 	api := &directCohortDownloadApi{
@@ -35,6 +44,7 @@ func newDirectCohortDownloadApi(apiKey, secretKey string,
 		SecretKey:     secretKey,
 		MaxCohortSize: maxCohortSize,
 		ServerUrl:     serverUrl,
+		client:        &http.Client{Timeout: requestTimeout},
 		log:           logger.New(logLevel, loggerProvider),
 	}
 	return api
@@ -43,22 +53,15 @@ func newDirectCohortDownloadApi(apiKey, secretKey string,
 func (api *directCohortDownloadApi) getCohort(cohortID string, cohort *Cohort) (*Cohort, error) {
 	api.log.Debug("getCohortMembers(%s): start", cohortID)
 	errors := 0
-	client := &http.Client{}
+	endpoint := requestEndpoint(api.buildCohortURL(cohortID, cohort))
 
 	for {
-		response, err := api.getCohortMembersRequest(client, cohortID, cohort)
+		response, err := api.getCohortMembersRequest(api.client, cohortID, cohort)
 		if err != nil {
 			api.log.Error("getCohortMembers(%s): request-status error %d - %v", cohortID, errors, err)
 			errors++
-			if errors >= 3 || func(err error) bool {
-				switch err.(type) {
-				case *cohortTooLargeException:
-					return true
-				default:
-					return false
-				}
-			}(err) {
-				return nil, err
+			if errors >= 3 {
+				return nil, &experiment.RequestError{Endpoint: endpoint, Attempt: errors, Retryable: true, Err: err}
 			}
 			time.Sleep(cohortRequestDelay)
 			continue
@@ -92,9 +95,19 @@ func (api *directCohortDownloadApi) getCohort(cohortID string, cohort *Cohort) (
 			api.log.Debug("getCohortMembers(%s): Cohort not modified", cohortID)
 			return nil, nil
 		} else if response.StatusCode == http.StatusRequestEntityTooLarge {
-			return nil, &cohortTooLargeException{Message: "Cohort exceeds max cohort size of " + strconv.Itoa(api.MaxCohortSize)}
+			return nil, &experiment.RequestError{
+				StatusCode: response.StatusCode,
+				Endpoint:   endpoint,
+				Attempt:    errors + 1,
+				Err:        fmt.Errorf("%w of %d", ErrCohortTooLarge, api.MaxCohortSize),
+			}
 		} else {
-			return nil, &httpErrorResponseException{StatusCode: response.StatusCode, Message: "Unexpected response code"}
+			return nil, &experiment.RequestError{
+				StatusCode: response.StatusCode,
+				Endpoint:   endpoint,
+				Attempt:    errors + 1,
+				Retryable:  experiment.IsRetryableStatus(response.StatusCode),
+			}
 		}
 	}
 }
@@ -121,3 +134,62 @@ func (api *directCohortDownloadApi) buildCohortURL(cohortID string, cohort *Coho
 	}
 	return url
 }
+
+// getCohortDelta downloads the members added and removed since the stored cohort was last modified.
+// It is not retried; callers fall back to a full download on error.
+//
+// The delta endpoint, GET /sdk/v1/cohort/{id}/delta, takes the same maxCohortSize and lastModified
+// query parameters as the cohort endpoint, where lastModified is the stored cohort's. It responds
+// with 204 if the cohort is not modified, or with 200 and the cohort's new lastModified and size,
+// the baseLastModified the delta applies to, and the addedMemberIds and removedMemberIds. A 404
+// means the server cannot provide a delta for the cohort, for example because it does not serve
+// deltas or no longer has the base version, and is returned as errCohortDeltaUnavailable.
+func (api *directCohortDownloadApi) getCohortDelta(cohortID string, cohort *Cohort) (*CohortDelta, error) {
+	api.log.Debug("getCohortDelta(%s): start", cohortID)
+	deltaURL := api.buildCohortDeltaURL(cohortID, cohort)
+	req, err := http.NewRequest("GET", deltaURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Basic "+api.getBasicAuth())
+	req.Header.Set("X-Amp-Exp-Library", fmt.Sprintf("experiment-go-server/%v", experiment.VERSION))
+	response, err := api.client.Do(req)
+	if err != nil {
+		return nil, &experiment.RequestError{Endpoint: requestEndpoint(deltaURL), Attempt: 1, Retryable: true, Err: err}
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+		delta := &CohortDelta{}
+		if err := json.NewDecoder(response.Body).Decode(delta); err != nil {
+			return nil, err
+		}
+		if delta.GroupType == "" {
+			delta.GroupType = userGroupType
+		}
+		api.log.Debug("getCohortDelta(%s): end - added=%d, removed=%d", cohortID, len(delta.AddedMemberIds), len(delta.RemovedMemberIds))
+		return delta, nil
+	case http.StatusNoContent:
+		api.log.Debug("getCohortDelta(%s): Cohort not modified", cohortID)
+		return nil, nil
+	case http.StatusNotFound:
+		return nil, &experiment.RequestError{
+			StatusCode: response.StatusCode,
+			Endpoint:   requestEndpoint(deltaURL),
+			Attempt:    1,
+			Err:        errCohortDeltaUnavailable,
+		}
+	default:
+		return nil, &experiment.RequestError{
+			StatusCode: response.StatusCode,
+			Endpoint:   requestEndpoint(deltaURL),
+			Attempt:    1,
+			Retryable:  experiment.IsRetryableStatus(response.StatusCode),
+		}
+	}
+}
+
+func (api *directCohortDownloadApi) buildCohortDeltaURL(cohortID string, cohort *Cohort) string {
+	return api.ServerUrl + "/sdk/v1/cohort/" + cohortID + "/delta?maxCohortSize=" + strconv.Itoa(api.MaxCohortSize) +
+		"&lastModified=" + strconv.FormatInt(cohort.LastModified, 10)
+}
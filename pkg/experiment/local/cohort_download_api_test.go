@@ -2,8 +2,11 @@ package local
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
 	"github.com/amplitude/experiment-go-server/pkg/logger"
 
 	"github.com/jarcoal/httpmock"
@@ -35,7 +38,7 @@ func TestCohortDownloadApi(t *testing.T) {
 	httpmock.Activate()
 	defer httpmock.DeactivateAndReset()
 
-	api := newDirectCohortDownloadApi("api", "secret", 15000, "https://server.amplitude.com", logger.Debug, logger.NewDefault())
+	api := newDirectCohortDownloadApi("api", "secret", 15000, "https://server.amplitude.com", time.Minute, logger.Debug, logger.NewDefault())
 
 	t.Run("test_cohort_download_success", func(t *testing.T) {
 		cohort := &Cohort{Id: "1234", LastModified: 0, Size: 1, MemberIds: []string{"user"}, GroupType: "userGroupType"}
@@ -205,8 +208,12 @@ func TestCohortDownloadApi(t *testing.T) {
 
 		_, err := api.getCohort("1234", cohort)
 		assert.Error(t, err)
-		_, isCohortTooLargeException := err.(*cohortTooLargeException)
-		assert.True(t, isCohortTooLargeException)
+		assert.ErrorIs(t, err, ErrCohortTooLarge)
+		var requestErr *experiment.RequestError
+		assert.ErrorAs(t, err, &requestErr)
+		assert.Equal(t, 413, requestErr.StatusCode)
+		assert.Equal(t, "https://server.amplitude.com/sdk/v1/cohort/1234", requestErr.Endpoint)
+		assert.False(t, requestErr.Retryable)
 	})
 
 	t.Run("test_cohort_not_modified", func(t *testing.T) {
@@ -221,3 +228,61 @@ func TestCohortDownloadApi(t *testing.T) {
 		assert.NoError(t, err)
 	})
 }
+
+func TestCohortDownloadApiDelta(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	api := newDirectCohortDownloadApi("api", "secret", 15000, "https://server.amplitude.com", time.Minute, logger.Debug, logger.NewDefault())
+	cohort := &Cohort{Id: "1234", LastModified: 1000, Size: 1, MemberIds: []string{"user"}, GroupType: userGroupType}
+
+	t.Run("test_cohort_delta_download_success", func(t *testing.T) {
+		httpmock.RegisterResponder("GET", "https://server.amplitude.com/sdk/v1/cohort/1234/delta?maxCohortSize=15000&lastModified=1000",
+			httpmock.NewStringResponder(200, `{"cohortId":"1234","baseLastModified":1000,"lastModified":2000,"size":1,"addedMemberIds":["user2"],"removedMemberIds":["user"]}`),
+		)
+
+		delta, err := api.getCohortDelta("1234", cohort)
+		assert.NoError(t, err)
+		assert.Equal(t, &CohortDelta{Id: "1234", BaseLastModified: 1000, LastModified: 2000, Size: 1, GroupType: userGroupType, AddedMemberIds: []string{"user2"}, RemovedMemberIds: []string{"user"}}, delta)
+	})
+
+	t.Run("test_cohort_delta_not_modified", func(t *testing.T) {
+		httpmock.RegisterResponder("GET", api.buildCohortDeltaURL("1234", cohort),
+			httpmock.NewStringResponder(204, ""),
+		)
+
+		delta, err := api.getCohortDelta("1234", cohort)
+		assert.NoError(t, err)
+		assert.Nil(t, delta)
+	})
+
+	t.Run("test_cohort_delta_unavailable", func(t *testing.T) {
+		httpmock.RegisterResponder("GET", api.buildCohortDeltaURL("1234", cohort),
+			httpmock.NewStringResponder(404, ""),
+		)
+
+		delta, err := api.getCohortDelta("1234", cohort)
+		assert.Nil(t, delta)
+		var requestErr *experiment.RequestError
+		assert.ErrorAs(t, err, &requestErr)
+		assert.Equal(t, 404, requestErr.StatusCode)
+		assert.Equal(t, "https://server.amplitude.com/sdk/v1/cohort/1234/delta", requestErr.Endpoint)
+		assert.ErrorIs(t, err, errCohortDeltaUnavailable)
+	})
+}
+
+func TestCohortDownloadApiDeltaTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	api := newDirectCohortDownloadApi("api", "secret", 15000, server.URL, 50*time.Millisecond, logger.Disable, logger.NewDefault())
+	cohort := &Cohort{Id: "1234", LastModified: 1000, Size: 1, MemberIds: []string{"user"}, GroupType: userGroupType}
+
+	start := time.Now()
+	delta, err := api.getCohortDelta("1234", cohort)
+	assert.Nil(t, delta)
+	var requestErr *experiment.RequestError
+	assert.ErrorAs(t, err, &requestErr)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -1,6 +1,7 @@
 package local
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -12,14 +13,18 @@ import (
 type cohortLoader struct {
 	log               *logger.Logger
 	cohortDownloadApi cohortDownloadApi
-	cohortStorage     cohortStorage
+	cohortStorage     CohortStorage
 	jobs              sync.Map
 	executor          *sync.Pool
 	lockJobs          sync.Mutex
+	lockErrors        sync.Mutex
+	lastErrors        map[string]error
+	// deltaDownloads enables patching stored cohorts with delta downloads, if supported by the api.
+	deltaDownloads bool
 }
 
 func newCohortLoader(cohortDownloadApi cohortDownloadApi,
-	cohortStorage cohortStorage,
+	cohortStorage CohortStorage,
 	logLevel logger.LogLevel,
 	loggerProvider logger.LoggerProvider) *cohortLoader {
 	return &cohortLoader{
@@ -30,7 +35,8 @@ func newCohortLoader(cohortDownloadApi cohortDownloadApi,
 				return &CohortLoaderTask{}
 			},
 		},
-		log: logger.New(logLevel, loggerProvider),
+		log:        logger.New(logLevel, loggerProvider),
+		lastErrors: make(map[string]error),
 	}
 }
 
@@ -53,6 +59,24 @@ func (cl *cohortLoader) removeJob(cohortId string) {
 	cl.jobs.Delete(cohortId)
 }
 
+// setLastError records the result of the most recent download of the cohort. A nil err clears any previous error.
+func (cl *cohortLoader) setLastError(cohortId string, err error) {
+	cl.lockErrors.Lock()
+	defer cl.lockErrors.Unlock()
+	if err == nil {
+		delete(cl.lastErrors, cohortId)
+	} else {
+		cl.lastErrors[cohortId] = err
+	}
+}
+
+// lastError returns the error of the most recent download of the cohort, or nil if it succeeded.
+func (cl *cohortLoader) lastError(cohortId string) error {
+	cl.lockErrors.Lock()
+	defer cl.lockErrors.Unlock()
+	return cl.lastErrors[cohortId]
+}
+
 type CohortLoaderTask struct {
 	loader   *cohortLoader
 	cohortId string
@@ -73,13 +97,11 @@ func (task *CohortLoaderTask) run() {
 	defer task.loader.executor.Put(task)
 
 	cohort, err := task.loader.downloadCohort(task.cohortId)
-	if err != nil {
-		task.err = err
-	} else {
-		if cohort != nil {
-			task.loader.cohortStorage.putCohort(cohort)
-		}
+	if err == nil && cohort != nil {
+		err = task.loader.cohortStorage.PutCohort(cohort)
 	}
+	task.loader.setLastError(task.cohortId, err)
+	task.err = err
 
 	task.loader.removeJob(task.cohortId)
 	atomic.StoreInt32(&task.done, 1)
@@ -92,10 +114,60 @@ func (task *CohortLoaderTask) wait() error {
 }
 
 func (cl *cohortLoader) downloadCohort(cohortID string) (*Cohort, error) {
-	cohort := cl.cohortStorage.getCohort(cohortID)
+	cohort := cl.cohortStorage.GetCohort(cohortID)
+	if patched, ok := cl.downloadCohortDelta(cohortID, cohort); ok {
+		return patched, nil
+	}
 	return cl.cohortDownloadApi.getCohort(cohortID, cohort)
 }
 
+// downloadCohortDelta patches the stored cohort with a delta download. It returns false if delta
+// downloads are unavailable or the delta could not be applied, in which case the cohort should be
+// downloaded in full. The returned cohort is nil if there is nothing left to store, because the
+// cohort was not modified or the storage applied the delta itself.
+func (cl *cohortLoader) downloadCohortDelta(cohortID string, cohort *Cohort) (*Cohort, bool) {
+	deltaApi, ok := cl.cohortDownloadApi.(cohortDeltaDownloadApi)
+	if !cl.deltaDownloads || !ok || cohort == nil {
+		return nil, false
+	}
+	// Without DeltaCohortStorage, the stored members are required to apply a delta, which storages
+	// may not hold in memory.
+	deltaStorage, storageApplies := cl.cohortStorage.(DeltaCohortStorage)
+	if !storageApplies && len(cohort.MemberIds) != cohort.Size {
+		return nil, false
+	}
+	delta, err := deltaApi.getCohortDelta(cohortID, cohort)
+	if errors.Is(err, errCohortDeltaUnavailable) {
+		cl.log.Debug("Cohort %s delta unavailable, downloading in full", cohortID)
+		return nil, false
+	}
+	if err != nil {
+		cl.log.Debug("Cohort %s delta download failed, downloading in full: %v", cohortID, err)
+		return nil, false
+	}
+	if delta == nil {
+		return nil, true
+	}
+	if storageApplies {
+		applied, err := deltaStorage.ApplyCohortDelta(delta)
+		if err != nil {
+			cl.log.Error("Cohort %s delta could not be stored, downloading in full: %v", cohortID, err)
+			return nil, false
+		}
+		if !applied {
+			cl.log.Debug("Cohort %s delta does not match stored cohort, downloading in full", cohortID)
+			return nil, false
+		}
+		return nil, true
+	}
+	patched, ok := delta.apply(cohort)
+	if !ok {
+		cl.log.Debug("Cohort %s delta does not match stored cohort, downloading in full", cohortID)
+		return nil, false
+	}
+	return patched, true
+}
+
 func (cl *cohortLoader) downloadCohorts(cohortIDs map[string]struct{}) {
 	var wg sync.WaitGroup
 	errorChan := make(chan error, len(cohortIDs))
@@ -1,9 +1,11 @@
 package local
 
 import (
+	"context"
 	"errors"
 	"testing"
 
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
 	"github.com/amplitude/experiment-go-server/pkg/logger"
 
 	"github.com/stretchr/testify/mock"
@@ -28,8 +30,8 @@ func TestLoadSuccess(t *testing.T) {
 		t.Errorf("futureB.wait() returned error: %v", err)
 	}
 
-	storageDescriptionA := storage.getCohort("a")
-	storageDescriptionB := storage.getCohort("b")
+	storageDescriptionA := storage.GetCohort("a")
+	storageDescriptionB := storage.GetCohort("b")
 	expectedA := &Cohort{Id: "a", LastModified: 0, Size: 1, MemberIds: []string{"1"}, GroupType: userGroupType}
 	expectedB := &Cohort{Id: "b", LastModified: 0, Size: 2, MemberIds: []string{"1", "2"}, GroupType: userGroupType}
 
@@ -40,8 +42,8 @@ func TestLoadSuccess(t *testing.T) {
 		t.Errorf("Unexpected cohort B stored: %+v", storageDescriptionB)
 	}
 
-	storageUser1Cohorts := storage.getCohortsForUser("1", map[string]struct{}{"a": {}, "b": {}})
-	storageUser2Cohorts := storage.getCohortsForUser("2", map[string]struct{}{"a": {}, "b": {}})
+	storageUser1Cohorts, _ := storage.GetCohortsForUser(context.Background(), "1", map[string]struct{}{"a": {}, "b": {}})
+	storageUser2Cohorts, _ := storage.GetCohortsForUser(context.Background(), "2", map[string]struct{}{"a": {}, "b": {}})
 	if len(storageUser1Cohorts) != 2 || len(storageUser2Cohorts) != 1 {
 		t.Errorf("Unexpected user cohorts: User1: %+v, User2: %+v", storageUser1Cohorts, storageUser2Cohorts)
 	}
@@ -52,8 +54,8 @@ func TestFilterCohortsAlreadyComputed(t *testing.T) {
 	storage := newInMemoryCohortStorage()
 	loader := newCohortLoader(api, storage, logger.Debug, logger.NewDefault())
 
-	storage.putCohort(&Cohort{Id: "a", LastModified: 0, Size: 0, MemberIds: []string{}})
-	storage.putCohort(&Cohort{Id: "b", LastModified: 0, Size: 0, MemberIds: []string{}})
+	storage.PutCohort(&Cohort{Id: "a", LastModified: 0, Size: 0, MemberIds: []string{}})
+	storage.PutCohort(&Cohort{Id: "b", LastModified: 0, Size: 0, MemberIds: []string{}})
 
 	// Define mock behavior
 	api.On("getCohort", "a", mock.AnythingOfType("*local.Cohort")).Return(&Cohort{Id: "a", LastModified: 0, Size: 0, MemberIds: []string{}, GroupType: userGroupType}, nil)
@@ -69,8 +71,8 @@ func TestFilterCohortsAlreadyComputed(t *testing.T) {
 		t.Errorf("futureB.wait() returned error: %v", err)
 	}
 
-	storageDescriptionA := storage.getCohort("a")
-	storageDescriptionB := storage.getCohort("b")
+	storageDescriptionA := storage.GetCohort("a")
+	storageDescriptionB := storage.GetCohort("b")
 	expectedA := &Cohort{Id: "a", LastModified: 0, Size: 0, MemberIds: []string{}, GroupType: userGroupType}
 	expectedB := &Cohort{Id: "b", LastModified: 1, Size: 2, MemberIds: []string{"1", "2"}, GroupType: userGroupType}
 
@@ -81,8 +83,8 @@ func TestFilterCohortsAlreadyComputed(t *testing.T) {
 		t.Errorf("Unexpected cohort B stored: %+v", storageDescriptionB)
 	}
 
-	storageUser1Cohorts := storage.getCohortsForUser("1", map[string]struct{}{"a": {}, "b": {}})
-	storageUser2Cohorts := storage.getCohortsForUser("2", map[string]struct{}{"a": {}, "b": {}})
+	storageUser1Cohorts, _ := storage.GetCohortsForUser(context.Background(), "1", map[string]struct{}{"a": {}, "b": {}})
+	storageUser2Cohorts, _ := storage.GetCohortsForUser(context.Background(), "2", map[string]struct{}{"a": {}, "b": {}})
 	if len(storageUser1Cohorts) != 1 || len(storageUser2Cohorts) != 1 {
 		t.Errorf("Unexpected user cohorts: User1: %+v, User2: %+v", storageUser1Cohorts, storageUser2Cohorts)
 	}
@@ -115,8 +117,103 @@ func TestLoadDownloadFailureThrows(t *testing.T) {
 	}
 
 	expectedCohorts := map[string]struct{}{"a": {}, "c": {}}
-	actualCohorts := storage.getCohortsForUser("1", map[string]struct{}{"a": {}, "b": {}, "c": {}})
+	actualCohorts, _ := storage.GetCohortsForUser(context.Background(), "1", map[string]struct{}{"a": {}, "b": {}, "c": {}})
 	if len(actualCohorts) != len(expectedCohorts) {
 		t.Errorf("Expected cohorts for user '1': %+v, but got: %+v", expectedCohorts, actualCohorts)
 	}
 }
+
+type mockCohortDeltaDownloadApi struct {
+	mockCohortDownloadApi
+	getCohortDeltaFunc func(cohortID string, cohort *Cohort) (*CohortDelta, error)
+}
+
+func (m *mockCohortDeltaDownloadApi) getCohortDelta(cohortID string, cohort *Cohort) (*CohortDelta, error) {
+	return m.getCohortDeltaFunc(cohortID, cohort)
+}
+
+func TestLoadCohortDelta(t *testing.T) {
+	stored := &Cohort{Id: "a", LastModified: 1, Size: 3, MemberIds: []string{"1", "2", "3"}, GroupType: userGroupType}
+	full := &Cohort{Id: "a", LastModified: 2, Size: 3, MemberIds: []string{"1", "3", "4"}, GroupType: userGroupType}
+	tests := []struct {
+		name           string
+		deltaDownloads bool
+		delta          *CohortDelta
+		deltaErr       error
+		expectedFull   bool
+		expectedStored *Cohort
+	}{
+		{
+			name:           "delta applied",
+			deltaDownloads: true,
+			delta:          &CohortDelta{Id: "a", BaseLastModified: 1, LastModified: 2, Size: 3, GroupType: userGroupType, AddedMemberIds: []string{"4"}, RemovedMemberIds: []string{"2"}},
+			expectedStored: &Cohort{Id: "a", LastModified: 2, Size: 3, MemberIds: []string{"1", "3", "4"}, GroupType: userGroupType},
+		},
+		{
+			name:           "not modified",
+			deltaDownloads: true,
+			expectedStored: stored,
+		},
+		{
+			name:           "base mismatch falls back to full download",
+			deltaDownloads: true,
+			delta:          &CohortDelta{Id: "a", BaseLastModified: 0, LastModified: 2, Size: 3, GroupType: userGroupType, AddedMemberIds: []string{"4"}, RemovedMemberIds: []string{"2"}},
+			expectedFull:   true,
+			expectedStored: full,
+		},
+		{
+			name:           "size mismatch falls back to full download",
+			deltaDownloads: true,
+			delta:          &CohortDelta{Id: "a", BaseLastModified: 1, LastModified: 2, Size: 4, GroupType: userGroupType, AddedMemberIds: []string{"4"}, RemovedMemberIds: []string{"2"}},
+			expectedFull:   true,
+			expectedStored: full,
+		},
+		{
+			name:           "delta error falls back to full download",
+			deltaDownloads: true,
+			deltaErr:       errors.New("not found"),
+			expectedFull:   true,
+			expectedStored: full,
+		},
+		{
+			name:           "delta unavailable falls back to full download",
+			deltaDownloads: true,
+			deltaErr:       &experiment.RequestError{StatusCode: 404, Err: errCohortDeltaUnavailable},
+			expectedFull:   true,
+			expectedStored: full,
+		},
+		{
+			name:           "delta downloads disabled",
+			expectedFull:   true,
+			expectedStored: full,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fullDownloads := 0
+			api := &mockCohortDeltaDownloadApi{
+				mockCohortDownloadApi: mockCohortDownloadApi{getCohortFunc: func(cohortID string, cohort *Cohort) (*Cohort, error) {
+					fullDownloads++
+					return full, nil
+				}},
+				getCohortDeltaFunc: func(cohortID string, cohort *Cohort) (*CohortDelta, error) {
+					return tt.delta, tt.deltaErr
+				},
+			}
+			storage := newInMemoryCohortStorage()
+			_ = storage.PutCohort(stored)
+			loader := newCohortLoader(api, storage, logger.Disable, logger.NewDefault())
+			loader.deltaDownloads = tt.deltaDownloads
+
+			if err := loader.loadCohort("a").wait(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.expectedFull != (fullDownloads == 1) {
+				t.Errorf("Expected full download %v, got %d full downloads", tt.expectedFull, fullDownloads)
+			}
+			if !CohortEquals(tt.expectedStored, storage.GetCohort("a")) {
+				t.Errorf("Unexpected cohort stored: %+v", storage.GetCohort("a"))
+			}
+		})
+	}
+}
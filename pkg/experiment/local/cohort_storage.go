@@ -1,39 +1,75 @@
 package local
 
 import (
+	"context"
 	"sync"
 )
 
-type cohortStorage interface {
-	getCohort(cohortID string) *Cohort
-	getCohorts() map[string]*Cohort
-	getCohortsForUser(userID string, cohortIDs map[string]struct{}) map[string]struct{}
-	getCohortsForGroup(groupType, groupName string, cohortIDs map[string]struct{}) map[string]struct{}
-	putCohort(cohort *Cohort)
-	deleteCohort(groupType, cohortID string)
-	getCohortIds() map[string]struct{}
+// CohortStorage stores the cohorts targeted by flag configs. The cohort loader writes downloaded
+// cohorts to the storage, and the client queries cohort membership on every evaluation of a flag
+// which targets cohorts, so implementations must be safe for concurrent use.
+//
+// Cohorts passed to and returned from the storage must be treated as immutable. Membership queries
+// take a context and may fail, e.g. for storage backed by a network service; an error fails the
+// evaluation.
+//
+// Set Config.CohortStorage to use a custom implementation. Defaults to an in-memory storage.
+type CohortStorage interface {
+	// GetCohort returns the stored cohort, or nil if it is not stored or cannot be read. The cohort's
+	// LastModified is used to only download the cohort again if it has changed. Storages which do not
+	// hold members in memory may return the cohort with nil MemberIds.
+	GetCohort(cohortID string) *Cohort
+	// GetCohorts returns all stored cohorts keyed by cohort ID. As with GetCohort, MemberIds may be nil.
+	GetCohorts() map[string]*Cohort
+	// GetCohortIds returns the IDs of all stored cohorts.
+	GetCohortIds() map[string]struct{}
+	// GetCohortsForUser returns the subset of cohortIDs which contain the user ID.
+	GetCohortsForUser(ctx context.Context, userID string, cohortIDs map[string]struct{}) (map[string]struct{}, error)
+	// GetCohortsForGroup returns the subset of cohortIDs of the group type which contain the group name.
+	GetCohortsForGroup(ctx context.Context, groupType, groupName string, cohortIDs map[string]struct{}) (map[string]struct{}, error)
+	// PutCohort stores the cohort, replacing any cohort with the same ID.
+	PutCohort(cohort *Cohort) error
+	// DeleteCohort removes the cohort of the group type.
+	DeleteCohort(groupType, cohortID string) error
+}
+
+// DeltaCohortStorage is an optional extension of CohortStorage. If a storage implements it, cohort
+// deltas downloaded with CohortSyncConfig.DeltaDownloads are applied by the storage, instead of
+// being applied to the members returned by GetCohort, so storages which do not hold members in
+// memory can use delta downloads.
+type DeltaCohortStorage interface {
+	CohortStorage
+	// ApplyCohortDelta applies the delta to the stored cohort atomically. It returns false, without
+	// modifying the storage, if the delta does not apply to the stored cohort: if the cohort is not
+	// stored, its LastModified or GroupType differ from the delta's base, or the patched cohort
+	// would not have the delta's Size. The cohort is then downloaded in full.
+	ApplyCohortDelta(delta *CohortDelta) (bool, error)
 }
 
 type inMemoryCohortStorage struct {
 	lock               sync.RWMutex
 	groupToCohortStore map[string]map[string]struct{}
 	cohortStore        map[string]*Cohort
+	// memberStore is the set of member IDs of each cohort, built on put so that membership lookups
+	// are independent of cohort size.
+	memberStore map[string]map[string]struct{}
 }
 
 func newInMemoryCohortStorage() *inMemoryCohortStorage {
 	return &inMemoryCohortStorage{
 		groupToCohortStore: make(map[string]map[string]struct{}),
 		cohortStore:        make(map[string]*Cohort),
+		memberStore:        make(map[string]map[string]struct{}),
 	}
 }
 
-func (s *inMemoryCohortStorage) getCohort(cohortID string) *Cohort {
+func (s *inMemoryCohortStorage) GetCohort(cohortID string) *Cohort {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 	return s.cohortStore[cohortID]
 }
 
-func (s *inMemoryCohortStorage) getCohorts() map[string]*Cohort {
+func (s *inMemoryCohortStorage) GetCohorts() map[string]*Cohort {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 	cohorts := make(map[string]*Cohort)
@@ -43,59 +79,70 @@ func (s *inMemoryCohortStorage) getCohorts() map[string]*Cohort {
 	return cohorts
 }
 
-func (s *inMemoryCohortStorage) getCohortsForUser(userID string, cohortIDs map[string]struct{}) map[string]struct{} {
-	return s.getCohortsForGroup(userGroupType, userID, cohortIDs)
+func (s *inMemoryCohortStorage) GetCohortsForUser(ctx context.Context, userID string, cohortIDs map[string]struct{}) (map[string]struct{}, error) {
+	return s.GetCohortsForGroup(ctx, userGroupType, userID, cohortIDs)
 }
 
-func (s *inMemoryCohortStorage) getCohortsForGroup(groupType, groupName string, cohortIDs map[string]struct{}) map[string]struct{} {
+func (s *inMemoryCohortStorage) GetCohortsForGroup(_ context.Context, groupType, groupName string, cohortIDs map[string]struct{}) (map[string]struct{}, error) {
 	result := make(map[string]struct{})
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
 	groupTypeCohorts, groupExists := s.groupToCohortStore[groupType]
 	if !groupExists {
-		return result
+		return result, nil
 	}
 
 	for cohortID := range cohortIDs {
 		if _, exists := groupTypeCohorts[cohortID]; exists {
-			if cohort, found := s.cohortStore[cohortID]; found {
-				for _, memberID := range cohort.MemberIds {
-					if memberID == groupName {
-						result[cohortID] = struct{}{}
-						break
-					}
-				}
+			if _, isMember := s.memberStore[cohortID][groupName]; isMember {
+				result[cohortID] = struct{}{}
 			}
 		}
 	}
 
-	return result
+	return result, nil
 }
 
-func (s *inMemoryCohortStorage) putCohort(cohort *Cohort) {
+func (s *inMemoryCohortStorage) PutCohort(cohort *Cohort) error {
+	// Build the member set before taking the lock, so lookups are not blocked by large cohorts.
+	members := make(map[string]struct{}, len(cohort.MemberIds))
+	for _, memberID := range cohort.MemberIds {
+		members[memberID] = struct{}{}
+	}
 	s.lock.Lock()
 	defer s.lock.Unlock()
+	if existing, exists := s.cohortStore[cohort.Id]; exists && existing.GroupType != cohort.GroupType {
+		s.removeFromGroup(existing.GroupType, cohort.Id)
+	}
 	if _, exists := s.groupToCohortStore[cohort.GroupType]; !exists {
 		s.groupToCohortStore[cohort.GroupType] = make(map[string]struct{})
 	}
 	s.groupToCohortStore[cohort.GroupType][cohort.Id] = struct{}{}
 	s.cohortStore[cohort.Id] = cohort
+	s.memberStore[cohort.Id] = members
+	return nil
 }
 
-func (s *inMemoryCohortStorage) deleteCohort(groupType, cohortID string) {
+func (s *inMemoryCohortStorage) DeleteCohort(groupType, cohortID string) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
+	s.removeFromGroup(groupType, cohortID)
+	delete(s.cohortStore, cohortID)
+	delete(s.memberStore, cohortID)
+	return nil
+}
+
+func (s *inMemoryCohortStorage) removeFromGroup(groupType, cohortID string) {
 	if groupCohorts, exists := s.groupToCohortStore[groupType]; exists {
 		delete(groupCohorts, cohortID)
 		if len(groupCohorts) == 0 {
 			delete(s.groupToCohortStore, groupType)
 		}
 	}
-	delete(s.cohortStore, cohortID)
 }
 
-func (s *inMemoryCohortStorage) getCohortIds() map[string]struct{} {
+func (s *inMemoryCohortStorage) GetCohortIds() map[string]struct{} {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 	cohortIds := make(map[string]struct{})
@@ -0,0 +1,67 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemoryCohortStorageMembership(t *testing.T) {
+	storage := newInMemoryCohortStorage()
+	ctx := context.Background()
+	allCohorts := map[string]struct{}{"a": {}, "b": {}, "c": {}}
+	_ = storage.PutCohort(&Cohort{Id: "a", LastModified: 1, Size: 2, MemberIds: []string{"1", "2"}, GroupType: userGroupType})
+	_ = storage.PutCohort(&Cohort{Id: "b", LastModified: 1, Size: 1, MemberIds: []string{"2"}, GroupType: userGroupType})
+	_ = storage.PutCohort(&Cohort{Id: "c", LastModified: 1, Size: 1, MemberIds: []string{"2"}, GroupType: "org name"})
+
+	cohorts, _ := storage.GetCohortsForUser(ctx, "2", allCohorts)
+	assert.Equal(t, map[string]struct{}{"a": {}, "b": {}}, cohorts)
+	cohorts, _ = storage.GetCohortsForGroup(ctx, "org name", "2", allCohorts)
+	assert.Equal(t, map[string]struct{}{"c": {}}, cohorts)
+
+	// Replacing a cohort replaces its members.
+	_ = storage.PutCohort(&Cohort{Id: "a", LastModified: 2, Size: 1, MemberIds: []string{"3"}, GroupType: userGroupType})
+	cohorts, _ = storage.GetCohortsForUser(ctx, "1", allCohorts)
+	assert.Equal(t, map[string]struct{}{}, cohorts)
+	cohorts, _ = storage.GetCohortsForUser(ctx, "3", allCohorts)
+	assert.Equal(t, map[string]struct{}{"a": {}}, cohorts)
+
+	// Changing a cohort's group type removes it from the previous group.
+	_ = storage.PutCohort(&Cohort{Id: "b", LastModified: 2, Size: 1, MemberIds: []string{"2"}, GroupType: "org name"})
+	cohorts, _ = storage.GetCohortsForUser(ctx, "2", allCohorts)
+	assert.Equal(t, map[string]struct{}{}, cohorts)
+	cohorts, _ = storage.GetCohortsForGroup(ctx, "org name", "2", allCohorts)
+	assert.Equal(t, map[string]struct{}{"b": {}, "c": {}}, cohorts)
+
+	_ = storage.DeleteCohort("org name", "c")
+	cohorts, _ = storage.GetCohortsForGroup(ctx, "org name", "2", allCohorts)
+	assert.Equal(t, map[string]struct{}{"b": {}}, cohorts)
+	assert.Nil(t, storage.GetCohort("c"))
+}
+
+func BenchmarkInMemoryCohortStorageGetCohortsForUser(b *testing.B) {
+	for _, cohortSize := range []int{100, 10_000, 1_000_000} {
+		b.Run(fmt.Sprintf("cohortSize=%d", cohortSize), func(b *testing.B) {
+			storage := newInMemoryCohortStorage()
+			cohortIDs := make(map[string]struct{})
+			members := make([]string, cohortSize)
+			for i := range members {
+				members[i] = strconv.Itoa(i)
+			}
+			for i := 0; i < 10; i++ {
+				cohortID := strconv.Itoa(i)
+				cohortIDs[cohortID] = struct{}{}
+				_ = storage.PutCohort(&Cohort{Id: cohortID, Size: cohortSize, MemberIds: members, GroupType: userGroupType})
+			}
+			ctx := context.Background()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Worst case for a linear scan: the user is not a member of any cohort.
+				_, _ = storage.GetCohortsForUser(ctx, "not a member", cohortIDs)
+			}
+		})
+	}
+}
@@ -1,10 +1,12 @@
 package local
 
 import (
+	"io"
 	"math"
 	"time"
 
 	"github.com/amplitude/analytics-go/amplitude"
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
 	"github.com/amplitude/experiment-go-server/pkg/logger"
 )
 
@@ -33,6 +35,11 @@ type Config struct {
 	AssignmentConfig               *AssignmentConfig // Deprecated: use ExposureConfig instead
 	ExposureConfig                 *ExposureConfig
 	CohortSyncConfig               *CohortSyncConfig
+	BootstrapConfig                *BootstrapConfig
+	SnapshotConfig                 *SnapshotConfig
+	FlagConfigStorage              FlagConfigStorage
+	CohortStorage                  CohortStorage
+	Hooks                          []experiment.Hook
 }
 
 // AssignmentConfig is the configuration for assignment tracking.
@@ -53,6 +60,57 @@ type CohortSyncConfig struct {
 	MaxCohortSize         int
 	CohortPollingInterval time.Duration
 	CohortServerUrl       string
+	CohortRequestTimeout  time.Duration
+	DeltaDownloads        bool
+}
+
+// BootstrapConfig is the configuration for loading an initial set of flag configs and cohorts on
+// Initialize, so that evaluation works before, or without, a successful fetch from the flag server.
+// The data is either the JSON array of flag configs returned by the flag config api, or an object:
+//
+//	{"flags": [...], "cohorts": [{"cohortId": "...", "lastModified": 0, "size": 1, "memberIds": ["..."], "groupType": "User"}]}
+//
+// If bootstrapping succeeds, Start does not fail when the flag server is unreachable; instead the
+// flag config updater is retried in the background until it succeeds and takes over. Bootstrapped
+// flag configs are reported by Status().Bootstrapped; the client is not Ready until the first sync.
+type BootstrapConfig struct {
+	// File is the path to a bootstrap file.
+	File string
+	// Reader is read for bootstrap data if File is empty.
+	Reader io.Reader
+}
+
+// SnapshotConfig is the configuration for periodically persisting flag configs and cohorts to disk,
+// so that a restarted client starts from the last known state rather than an empty cache. The
+// snapshot is reloaded on Initialize, taking precedence over BootstrapConfig, and cohort last
+// modified timestamps are preserved so cohorts are only re-downloaded if they have changed.
+//
+// Snapshots are written atomically and checksummed; a missing or corrupt snapshot is ignored.
+type SnapshotConfig struct {
+	// Directory is the directory snapshot files are written to. It is created if it does not exist.
+	Directory string
+	// Interval is how often a snapshot is written. A final snapshot is also written on Close.
+	Interval time.Duration
+}
+
+// RedisCohortStorageConfig is the configuration for a RedisCohortStorage.
+type RedisCohortStorageConfig struct {
+	// Addr is the host:port address of the server.
+	Addr string
+	// Password is sent with AUTH on connect if set.
+	Password string
+	// DB is selected on connect if non-zero.
+	DB int
+	// KeyPrefix is prepended to every key written by the storage.
+	KeyPrefix string
+	// Timeout bounds dialing and each round trip.
+	Timeout time.Duration
+	// PoolSize is the maximum number of idle connections kept open.
+	PoolSize int
+	// LogLevel is the level at which failed reads are logged. Defaults to logger.Error.
+	LogLevel logger.LogLevel
+	// LoggerProvider receives the storage's log messages. Defaults to logger.NewDefault().
+	LoggerProvider logger.LoggerProvider
 }
 
 var DefaultAssignmentConfig = &AssignmentConfig{
@@ -67,6 +125,20 @@ var DefaultCohortSyncConfig = &CohortSyncConfig{
 	MaxCohortSize:         math.MaxInt32,
 	CohortPollingInterval: 60 * time.Second,
 	CohortServerUrl:       "https://cohort-v2.lab.amplitude.com",
+	CohortRequestTimeout:  60 * time.Second,
+}
+
+var DefaultSnapshotConfig = &SnapshotConfig{
+	Interval: 60 * time.Second,
+}
+
+var DefaultRedisCohortStorageConfig = &RedisCohortStorageConfig{
+	Addr:           "localhost:6379",
+	KeyPrefix:      "amp:exp:cohort:",
+	Timeout:        5 * time.Second,
+	PoolSize:       10,
+	LogLevel:       logger.Error,
+	LoggerProvider: logger.NewDefault(),
 }
 
 var DefaultConfig = &Config{
@@ -126,6 +198,10 @@ func fillConfigDefaults(c *Config) *Config {
 		c.CohortSyncConfig.CohortPollingInterval = DefaultCohortSyncConfig.CohortPollingInterval
 	}
 
+	if c.CohortSyncConfig != nil && c.CohortSyncConfig.CohortRequestTimeout == 0 {
+		c.CohortSyncConfig.CohortRequestTimeout = DefaultCohortSyncConfig.CohortRequestTimeout
+	}
+
 	if c.CohortSyncConfig != nil && c.CohortSyncConfig.CohortServerUrl == "" {
 		switch c.ServerZone {
 		case USServerZone:
@@ -135,6 +211,10 @@ func fillConfigDefaults(c *Config) *Config {
 		}
 	}
 
+	if c.SnapshotConfig != nil && c.SnapshotConfig.Interval == 0 {
+		c.SnapshotConfig.Interval = DefaultSnapshotConfig.Interval
+	}
+
 	if c.LogLevel == logger.Unknown {
 		c.LogLevel = logger.Error
 	}
@@ -149,3 +229,28 @@ func fillConfigDefaults(c *Config) *Config {
 
 	return c
 }
+
+func fillRedisCohortStorageConfigDefaults(c *RedisCohortStorageConfig) *RedisCohortStorageConfig {
+	if c == nil {
+		return DefaultRedisCohortStorageConfig
+	}
+	if c.Addr == "" {
+		c.Addr = DefaultRedisCohortStorageConfig.Addr
+	}
+	if c.KeyPrefix == "" {
+		c.KeyPrefix = DefaultRedisCohortStorageConfig.KeyPrefix
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultRedisCohortStorageConfig.Timeout
+	}
+	if c.PoolSize == 0 {
+		c.PoolSize = DefaultRedisCohortStorageConfig.PoolSize
+	}
+	if c.LogLevel == logger.Unknown {
+		c.LogLevel = DefaultRedisCohortStorageConfig.LogLevel
+	}
+	if c.LoggerProvider == nil {
+		c.LoggerProvider = DefaultRedisCohortStorageConfig.LoggerProvider
+	}
+	return c
+}
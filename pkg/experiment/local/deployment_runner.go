@@ -3,14 +3,25 @@ package local
 import (
 	"sync"
 	"time"
+
+	"github.com/amplitude/experiment-go-server/pkg/logger"
 )
 
 type deploymentRunner struct {
 	config            *Config
-	flagConfigStorage flagConfigStorage
+	flagConfigStorage FlagConfigStorage
+	cohortStorage     CohortStorage
 	flagConfigUpdater flagConfigUpdater
 	cohortLoader      *cohortLoader
 	poller            *poller
+	status            *statusTracker
+	index             *flagIndexCache
+	log               *logger.Logger
+	bootstrapped      bool
+	stopped           bool
+	startRetryTimer   *time.Timer
+	snapshotter       *snapshotter
+	snapshotPoller    *poller
 	lock              sync.Mutex
 }
 
@@ -21,20 +32,27 @@ func newDeploymentRunner(
 	config *Config,
 	flagConfigApi flagConfigApi,
 	flagConfigStreamApi *flagConfigStreamApiV2,
-	flagConfigStorage flagConfigStorage,
-	cohortStorage cohortStorage,
+	flagConfigStorage FlagConfigStorage,
+	cohortStorage CohortStorage,
 	cohortLoader *cohortLoader,
 ) *deploymentRunner {
-	flagConfigUpdater := newflagConfigFallbackRetryWrapper(newFlagConfigPoller(flagConfigApi, config, flagConfigStorage, cohortStorage, cohortLoader), nil, config.FlagConfigPollerInterval, updaterRetryMaxJitter, 0, 0, config.LogLevel, config.LoggerProvider)
+	status := newStatusTracker()
+	index := newFlagIndexCache()
+	flagConfigUpdater := newflagConfigFallbackRetryWrapper(newFlagConfigPoller(flagConfigApi, config, flagConfigStorage, cohortStorage, cohortLoader, status, index), nil, config.FlagConfigPollerInterval, updaterRetryMaxJitter, 0, 0, config.LogLevel, config.LoggerProvider)
 	if flagConfigStreamApi != nil {
-		flagConfigUpdater = newflagConfigFallbackRetryWrapper(newFlagConfigStreamer(flagConfigStreamApi, config, flagConfigStorage, cohortStorage, cohortLoader), flagConfigUpdater, streamUpdaterRetryDelay, updaterRetryMaxJitter, config.FlagConfigPollerInterval, 0, config.LogLevel, config.LoggerProvider)
+		flagConfigUpdater = newflagConfigFallbackRetryWrapper(newFlagConfigStreamer(flagConfigStreamApi, config, flagConfigStorage, cohortStorage, cohortLoader, status, index), flagConfigUpdater, streamUpdaterRetryDelay, updaterRetryMaxJitter, config.FlagConfigPollerInterval, 0, config.LogLevel, config.LoggerProvider)
 	}
 	dr := &deploymentRunner{
 		config:            config,
 		flagConfigStorage: flagConfigStorage,
+		cohortStorage:     cohortStorage,
 		cohortLoader:      cohortLoader,
 		flagConfigUpdater: flagConfigUpdater,
 		poller:            newPoller(),
+		snapshotPoller:    newPoller(),
+		status:            status,
+		index:             index,
+		log:               logger.New(config.LogLevel, config.LoggerProvider),
 	}
 	return dr
 }
@@ -44,14 +62,117 @@ func (dr *deploymentRunner) start() error {
 	defer dr.lock.Unlock()
 	err := dr.flagConfigUpdater.Start(nil)
 	if err != nil {
-		return err
+		if !dr.bootstrapped {
+			return err
+		}
+		dr.log.Error("Flag config updater start failed, using bootstrapped flag configs until it succeeds: %v", err)
+		dr.scheduleStartRetry()
 	}
 
 	if dr.config.CohortSyncConfig != nil {
 		dr.poller.Poll(dr.config.CohortSyncConfig.CohortPollingInterval, func() {
-			cohortIDs := getAllCohortIDsFromFlags(dr.flagConfigStorage.getFlagConfigsArray())
+			cohortIDs := getAllCohortIDsFromFlags(getFlagConfigsArray(dr.flagConfigStorage))
 			dr.cohortLoader.downloadCohorts(cohortIDs)
+			dr.status.notify()
 		})
 	}
+	if dr.snapshotter != nil {
+		dr.snapshotPoller.Poll(dr.config.SnapshotConfig.Interval, dr.writeSnapshot)
+	}
+	return nil
+}
+
+// bootstrap loads the configured bootstrap flag configs and cohorts into storage.
+func (dr *deploymentRunner) bootstrap(config *BootstrapConfig) error {
+	data, err := readBootstrap(config)
+	if err != nil {
+		dr.status.failed(err)
+		return err
+	}
+	dr.load(data)
+	dr.log.Debug("Bootstrapped %d flag configs and %d cohorts.", len(data.Flags), len(data.Cohorts))
 	return nil
 }
+
+// restoreSnapshot loads the last snapshot written by the snapshotter into storage, and enables
+// periodic snapshots once the runner is started. Snapshots are enabled even if restoring fails.
+func (dr *deploymentRunner) restoreSnapshot(snapshotter *snapshotter) error {
+	dr.lock.Lock()
+	dr.snapshotter = snapshotter
+	dr.lock.Unlock()
+	data, err := snapshotter.read()
+	if err != nil {
+		return err
+	}
+	dr.load(data)
+	dr.log.Debug("Restored %d flag configs and %d cohorts from snapshot.", len(data.Flags), len(data.Cohorts))
+	return nil
+}
+
+// load puts flag configs and cohorts into storage and marks the runner as bootstrapped.
+func (dr *deploymentRunner) load(data *bootstrapData) {
+	dr.lock.Lock()
+	defer dr.lock.Unlock()
+	for _, cohort := range data.Cohorts {
+		if err := dr.cohortStorage.PutCohort(cohort.toCohort()); err != nil {
+			dr.log.Error("Failed to put cohort %s: %v", cohort.Id, err)
+		}
+	}
+	for _, flag := range data.Flags {
+		flag.Compile()
+		dr.flagConfigStorage.PutFlagConfig(flag)
+	}
+	dr.index.refresh(dr.flagConfigStorage)
+	dr.bootstrapped = true
+	dr.status.flagsBootstrapped()
+}
+
+// writeSnapshot writes a snapshot of storage, once flag configs have been loaded at least once.
+func (dr *deploymentRunner) writeSnapshot() {
+	if status, _ := dr.status.snapshot(); status.FlagConfigVersion == 0 {
+		return
+	}
+	if err := dr.snapshotter.write(); err != nil {
+		dr.log.Error("Failed to write flag config snapshot: %v", err)
+	}
+}
+
+// scheduleStartRetry retries starting the flag config updater until it succeeds or the runner is stopped.
+// Must be called with the lock held.
+func (dr *deploymentRunner) scheduleStartRetry() {
+	dr.startRetryTimer = time.AfterFunc(randTimeDuration(dr.config.FlagConfigPollerInterval, updaterRetryMaxJitter), func() {
+		dr.lock.Lock()
+		defer dr.lock.Unlock()
+		if dr.stopped {
+			return
+		}
+		if err := dr.flagConfigUpdater.Start(nil); err != nil {
+			dr.log.Error("Flag config updater start retry failed: %v", err)
+			dr.scheduleStartRetry()
+			return
+		}
+		dr.startRetryTimer = nil
+	})
+}
+
+// stop stops the flag config updater and cohort poller, then blocks until their background goroutines have exited.
+// If snapshots are enabled, a final snapshot is written.
+func (dr *deploymentRunner) stop() {
+	dr.lock.Lock()
+	dr.stopped = true
+	if dr.startRetryTimer != nil {
+		dr.startRetryTimer.Stop()
+		dr.startRetryTimer = nil
+	}
+	dr.flagConfigUpdater.Stop()
+	dr.poller.stop()
+	dr.snapshotPoller.stop()
+	dr.lock.Unlock()
+
+	waitFor(dr.flagConfigUpdater)
+	dr.poller.wait()
+	dr.snapshotPoller.wait()
+	if dr.snapshotter != nil {
+		dr.writeSnapshot()
+	}
+}
@@ -0,0 +1,20 @@
+package local
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrCohortTooLarge is the cause of the *experiment.RequestError returned when a cohort has more
+// members than the configured maximum cohort size, in which case the cohort is not downloaded.
+var ErrCohortTooLarge = errors.New("cohort exceeds max cohort size")
+
+// errCohortDeltaUnavailable is the cause of the *experiment.RequestError returned when the server
+// cannot provide a delta for a cohort, in which case the cohort is downloaded in full.
+var errCohortDeltaUnavailable = errors.New("cohort delta unavailable")
+
+// requestEndpoint returns the URL of a request without its query.
+func requestEndpoint(url string) string {
+	endpoint, _, _ := strings.Cut(url, "?")
+	return endpoint
+}
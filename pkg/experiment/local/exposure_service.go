@@ -1,6 +1,7 @@
 package local
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/amplitude/analytics-go/amplitude"
@@ -17,7 +18,12 @@ type exposureService struct {
 	filter    *exposureFilter
 }
 
-func (s *exposureService) Track(exposure *exposure) {
+// Track tracks the exposure's events, unless the context is done or the exposure was already
+// tracked within the filter's TTL.
+func (s *exposureService) Track(ctx context.Context, exposure *exposure) {
+	if ctx.Err() != nil {
+		return
+	}
 	if s.filter.shouldTrack(exposure) {
 		events := toExposureEvents(exposure, s.filter.ttlMillis)
 		for _, event := range events {
@@ -26,6 +32,13 @@ func (s *exposureService) Track(exposure *exposure) {
 	}
 }
 
+// shutdown flushes pending exposure events and stops the underlying amplitude client.
+func (s *exposureService) shutdown() {
+	if a, ok := s.amplitude.(interface{ Shutdown() }); ok {
+		a.Shutdown()
+	}
+}
+
 func toExposureEvents(exposure *exposure, ttlMillis int64) []amplitude.Event {
 	var events []amplitude.Event
 	canonicalized := exposure.Canonicalize()
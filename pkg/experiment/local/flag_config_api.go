@@ -50,11 +50,20 @@ func (a *flagConfigApiV2) getFlagConfigs() (map[string]*evaluation.Flag, error)
 	req.Header.Set("Authorization", fmt.Sprintf("Api-Key %s", a.DeploymentKey))
 	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
 	req.Header.Set("X-Amp-Exp-Library", fmt.Sprintf("experiment-go-server/%v", experiment.VERSION))
+	endpoint.RawQuery = ""
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, &experiment.RequestError{Endpoint: endpoint.String(), Attempt: 1, Retryable: true, Err: err}
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &experiment.RequestError{
+			StatusCode: resp.StatusCode,
+			Endpoint:   endpoint.String(),
+			Attempt:    1,
+			Retryable:  experiment.IsRetryableStatus(resp.StatusCode),
+		}
+	}
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,28 @@
+package local
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlagConfigApiRequestError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	api := newFlagConfigApiV2("deployment-key", server.URL, time.Second)
+
+	flags, err := api.getFlagConfigs()
+	assert.Nil(t, flags)
+	assert.ErrorIs(t, err, experiment.ErrUnauthorized)
+	var requestErr *experiment.RequestError
+	assert.ErrorAs(t, err, &requestErr)
+	assert.Equal(t, http.StatusUnauthorized, requestErr.StatusCode)
+	assert.Equal(t, server.URL+"/sdk/v2/flags", requestErr.Endpoint)
+	assert.False(t, requestErr.Retryable)
+}
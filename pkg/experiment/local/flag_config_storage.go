@@ -6,12 +6,50 @@ import (
 	"github.com/amplitude/experiment-go-server/internal/evaluation"
 )
 
-type flagConfigStorage interface {
-	getFlagConfig(key string) *evaluation.Flag
-	getFlagConfigs() map[string]*evaluation.Flag
-	getFlagConfigsArray() []*evaluation.Flag
-	putFlagConfig(flagConfig *evaluation.Flag)
-	removeIf(condition func(*evaluation.Flag) bool)
+// FlagConfig is a flag configuration as returned by the flag config api.
+type FlagConfig = evaluation.Flag
+
+// FlagConfigStorage stores the flag configs used for local evaluation. The flag config updater writes
+// to the storage whenever flag configs are fetched or streamed, and the client reads from it on every
+// evaluation, so implementations must be safe for concurrent use and reads should be fast.
+//
+// Flag configs passed to and returned from the storage must be treated as immutable. Implementations
+// backed by a shared store may return stale data; the client evaluates whatever the storage returns.
+//
+// The client indexes the flag configs, sorting dependencies and collecting targeted cohorts, before
+// evaluating them. Since a custom storage may be updated outside of the client, its flag configs
+// are instead read on every evaluation, and only the evaluated flags are sorted, unless it
+// implements VersionedFlagConfigStorage.
+//
+// Set Config.FlagConfigStorage to use a custom implementation. Defaults to an in-memory storage.
+type FlagConfigStorage interface {
+	// GetFlagConfig returns the flag config for the flag key, or nil if it is not stored.
+	GetFlagConfig(key string) *FlagConfig
+	// GetFlagConfigs returns all stored flag configs keyed by flag key. The returned map must not be
+	// modified by the storage after it is returned.
+	GetFlagConfigs() map[string]*FlagConfig
+	// PutFlagConfig stores the flag config, replacing any flag config with the same key.
+	PutFlagConfig(flagConfig *FlagConfig)
+	// RemoveIf removes all stored flag configs for which condition returns true.
+	RemoveIf(condition func(*FlagConfig) bool)
+}
+
+// VersionedFlagConfigStorage is an optional extension of FlagConfigStorage. If a custom storage
+// implements it, the client keeps its index of the flag configs until the version changes, instead
+// of reading the flag configs and sorting the evaluated flags on every evaluation.
+type VersionedFlagConfigStorage interface {
+	FlagConfigStorage
+	// Version returns a value which changes whenever the stored flag configs change, including when
+	// they are changed outside of the client, such as by another process sharing the store.
+	Version() uint64
+}
+
+func getFlagConfigsArray(storage FlagConfigStorage) []*evaluation.Flag {
+	var flagConfigs []*evaluation.Flag
+	for _, value := range storage.GetFlagConfigs() {
+		flagConfigs = append(flagConfigs, value)
+	}
+	return flagConfigs
 }
 
 type inMemoryFlagConfigStorage struct {
@@ -25,17 +63,13 @@ func newInMemoryFlagConfigStorage() *inMemoryFlagConfigStorage {
 	}
 }
 
-func (storage *inMemoryFlagConfigStorage) GetFlagConfigs() map[string]*evaluation.Flag {
-	return storage.getFlagConfigs()
-}
-
-func (storage *inMemoryFlagConfigStorage) getFlagConfig(key string) *evaluation.Flag {
+func (storage *inMemoryFlagConfigStorage) GetFlagConfig(key string) *evaluation.Flag {
 	storage.flagConfigsLock.Lock()
 	defer storage.flagConfigsLock.Unlock()
 	return storage.flagConfigs[key]
 }
 
-func (storage *inMemoryFlagConfigStorage) getFlagConfigs() map[string]*evaluation.Flag {
+func (storage *inMemoryFlagConfigStorage) GetFlagConfigs() map[string]*evaluation.Flag {
 	storage.flagConfigsLock.Lock()
 	defer storage.flagConfigsLock.Unlock()
 	copyFlagConfigs := make(map[string]*evaluation.Flag)
@@ -45,24 +79,13 @@ func (storage *inMemoryFlagConfigStorage) getFlagConfigs() map[string]*evaluatio
 	return copyFlagConfigs
 }
 
-func (storage *inMemoryFlagConfigStorage) getFlagConfigsArray() []*evaluation.Flag {
-	storage.flagConfigsLock.Lock()
-	defer storage.flagConfigsLock.Unlock()
-
-	var copyFlagConfigs []*evaluation.Flag
-	for _, value := range storage.flagConfigs {
-		copyFlagConfigs = append(copyFlagConfigs, value)
-	}
-	return copyFlagConfigs
-}
-
-func (storage *inMemoryFlagConfigStorage) putFlagConfig(flagConfig *evaluation.Flag) {
+func (storage *inMemoryFlagConfigStorage) PutFlagConfig(flagConfig *evaluation.Flag) {
 	storage.flagConfigsLock.Lock()
 	defer storage.flagConfigsLock.Unlock()
 	storage.flagConfigs[flagConfig.Key] = flagConfig
 }
 
-func (storage *inMemoryFlagConfigStorage) removeIf(condition func(*evaluation.Flag) bool) {
+func (storage *inMemoryFlagConfigStorage) RemoveIf(condition func(*evaluation.Flag) bool) {
 	storage.flagConfigsLock.Lock()
 	defer storage.flagConfigsLock.Unlock()
 	for key, value := range storage.flagConfigs {
@@ -30,6 +30,7 @@ type flagConfigStreamApiV2 struct {
 	connectionTimeout   time.Duration
 	stopCh              chan bool
 	lock                sync.Mutex
+	wg                  sync.WaitGroup
 	newSseStreamFactory func(
 		authToken,
 		url string,
@@ -131,7 +132,9 @@ func (api *flagConfigStreamApiV2) Connect(
 	}
 
 	// Retrieve and pass on message forever until stopCh closes.
+	api.wg.Add(1)
 	go func() {
+		defer api.wg.Done()
 		for {
 			select {
 			case <-stopCh: // Channel returns immediately when closed. Note the local channel is referred here, so it's guaranteed to not be nil.
@@ -150,8 +153,12 @@ func (api *flagConfigStreamApiV2) Connect(
 				}
 				if onUpdate != nil {
 					// Deliver async. Don't care about any errors.
-					//nolint:errcheck
-					go func() { onUpdate(flags) }()
+					api.wg.Add(1)
+					go func() {
+						defer api.wg.Done()
+						//nolint:errcheck
+						onUpdate(flags)
+					}()
 				}
 			case err := <-streamErrCh:
 				// Error, close everything.
@@ -194,3 +201,8 @@ func (api *flagConfigStreamApiV2) Close() {
 
 	api.closeInternal()
 }
+
+// wait blocks until the message loop and any in-flight updates of closed connections have returned.
+func (api *flagConfigStreamApiV2) wait() {
+	api.wg.Wait()
+}
@@ -1,6 +1,8 @@
 package local
 
 import (
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -17,25 +19,45 @@ type flagConfigUpdater interface {
 	Stop()
 }
 
+// waiter is implemented by flag config updaters and apis which run background goroutines.
+// wait blocks until every goroutine started so far has exited. It must only be called after Stop,
+// and never while holding a lock the background goroutines may need.
+type waiter interface {
+	wait()
+}
+
+// waitFor calls wait on v if it implements waiter.
+func waitFor(v interface{}) {
+	if w, ok := v.(waiter); ok {
+		w.wait()
+	}
+}
+
 // The base for all flag config updaters.
 // Contains a method to properly update the flag configs into storage and download cohorts.
 type flagConfigUpdaterBase struct {
-	flagConfigStorage flagConfigStorage
-	cohortStorage     cohortStorage
+	flagConfigStorage FlagConfigStorage
+	cohortStorage     CohortStorage
 	cohortLoader      *cohortLoader
+	status            *statusTracker
+	index             *flagIndexCache
 	log               *logger.Logger
 }
 
 func newFlagConfigUpdaterBase(
-	flagConfigStorage flagConfigStorage,
-	cohortStorage cohortStorage,
+	flagConfigStorage FlagConfigStorage,
+	cohortStorage CohortStorage,
 	cohortLoader *cohortLoader,
+	status *statusTracker,
+	index *flagIndexCache,
 	config *Config,
 ) flagConfigUpdaterBase {
 	return flagConfigUpdaterBase{
 		flagConfigStorage: flagConfigStorage,
 		cohortStorage:     cohortStorage,
 		cohortLoader:      cohortLoader,
+		status:            status,
+		index:             index,
 		log:               logger.New(config.LogLevel, config.LoggerProvider),
 	}
 }
@@ -46,9 +68,10 @@ func (u *flagConfigUpdaterBase) update(flagConfigs map[string]*evaluation.Flag)
 	flagKeys := make(map[string]struct{})
 	for _, flag := range flagConfigs {
 		flagKeys[flag.Key] = struct{}{}
+		flag.Compile()
 	}
 
-	u.flagConfigStorage.removeIf(func(f *evaluation.Flag) bool {
+	u.flagConfigStorage.RemoveIf(func(f *evaluation.Flag) bool {
 		_, exists := flagKeys[f.Key]
 		return !exists
 	})
@@ -56,8 +79,10 @@ func (u *flagConfigUpdaterBase) update(flagConfigs map[string]*evaluation.Flag)
 	if u.cohortLoader == nil {
 		for _, flagConfig := range flagConfigs {
 			u.log.Debug("Putting non-cohort flag %s", flagConfig.Key)
-			u.flagConfigStorage.putFlagConfig(flagConfig)
+			u.flagConfigStorage.PutFlagConfig(flagConfig)
 		}
+		u.index.refresh(u.flagConfigStorage)
+		u.status.flagsSynced(nil)
 		return nil
 	}
 
@@ -68,47 +93,53 @@ func (u *flagConfigUpdaterBase) update(flagConfigs map[string]*evaluation.Flag)
 		}
 	}
 
-	existingCohortIDs := u.cohortStorage.getCohortIds()
+	existingCohortIDs := u.cohortStorage.GetCohortIds()
 	cohortIDsToDownload := difference(newCohortIDs, existingCohortIDs)
 
 	// Download all new cohorts
 	u.cohortLoader.downloadCohorts(cohortIDsToDownload)
 
 	// Get updated set of cohort ids
-	updatedCohortIDs := u.cohortStorage.getCohortIds()
+	updatedCohortIDs := u.cohortStorage.GetCohortIds()
 	// Iterate through new flag configs and check if their required cohorts exist
+	var cohortErrs []error
 	for _, flagConfig := range flagConfigs {
 		cohortIDs := getAllCohortIDsFromFlag(flagConfig)
 		missingCohorts := difference(cohortIDs, updatedCohortIDs)
 
-		u.flagConfigStorage.putFlagConfig(flagConfig)
+		u.flagConfigStorage.PutFlagConfig(flagConfig)
 		u.log.Debug("Putting flag %s", flagConfig.Key)
 		if len(missingCohorts) != 0 {
 			u.log.Error("Flag %s - failed to load cohorts: %v", flagConfig.Key, missingCohorts)
+			cohortErrs = append(cohortErrs, fmt.Errorf("flag %s - failed to load cohorts: %v", flagConfig.Key, missingCohorts))
 		}
 	}
 
 	// Delete unused cohorts
 	u.deleteUnusedCohorts()
+	u.index.refresh(u.flagConfigStorage)
 	u.log.Debug("Refreshed %d flag configs.", len(flagConfigs))
+	u.status.flagsSynced(errors.Join(cohortErrs...))
 
 	return nil
 }
 
 func (u *flagConfigUpdaterBase) deleteUnusedCohorts() {
 	flagCohortIDs := make(map[string]struct{})
-	for _, flag := range u.flagConfigStorage.getFlagConfigs() {
+	for _, flag := range u.flagConfigStorage.GetFlagConfigs() {
 		for cohortID := range getAllCohortIDsFromFlag(flag) {
 			flagCohortIDs[cohortID] = struct{}{}
 		}
 	}
 
-	storageCohorts := u.cohortStorage.getCohorts()
+	storageCohorts := u.cohortStorage.GetCohorts()
 	for cohortID := range storageCohorts {
 		if _, exists := flagCohortIDs[cohortID]; !exists {
 			cohort := storageCohorts[cohortID]
 			if cohort != nil {
-				u.cohortStorage.deleteCohort(cohort.GroupType, cohortID)
+				if err := u.cohortStorage.DeleteCohort(cohort.GroupType, cohortID); err != nil {
+					u.log.Error("Failed to delete unused cohort %s: %v", cohortID, err)
+				}
 			}
 		}
 	}
@@ -119,18 +150,22 @@ type flagConfigStreamer struct {
 	flagConfigUpdaterBase
 	flagConfigStreamApi flagConfigStreamApi
 	lock                sync.Mutex
+	// wg tracks the goroutines calling onError.
+	wg sync.WaitGroup
 }
 
 func newFlagConfigStreamer(
 	flagConfigStreamApi flagConfigStreamApi,
 	config *Config,
-	flagConfigStorage flagConfigStorage,
-	cohortStorage cohortStorage,
+	flagConfigStorage FlagConfigStorage,
+	cohortStorage CohortStorage,
 	cohortLoader *cohortLoader,
+	status *statusTracker,
+	index *flagIndexCache,
 ) flagConfigUpdater {
 	return &flagConfigStreamer{
 		flagConfigStreamApi:   flagConfigStreamApi,
-		flagConfigUpdaterBase: newFlagConfigUpdaterBase(flagConfigStorage, cohortStorage, cohortLoader, config),
+		flagConfigUpdaterBase: newFlagConfigUpdaterBase(flagConfigStorage, cohortStorage, cohortLoader, status, index, config),
 	}
 }
 
@@ -139,7 +174,7 @@ func (s *flagConfigStreamer) Start(onError func(error)) error {
 	defer s.lock.Unlock()
 
 	s.stopInternal()
-	return s.flagConfigStreamApi.Connect(
+	err := s.flagConfigStreamApi.Connect(
 		func(flags map[string]*evaluation.Flag) error {
 			return s.update(flags)
 		},
@@ -148,11 +183,22 @@ func (s *flagConfigStreamer) Start(onError func(error)) error {
 		},
 		func(err error) {
 			s.Stop()
+			s.status.updaterFailed(UpdaterStream, err)
 			if onError != nil {
-				go func() {onError(err)}()
+				s.wg.Add(1)
+				go func() {
+					defer s.wg.Done()
+					onError(err)
+				}()
 			}
 		},
 	)
+	if err != nil {
+		s.status.failed(err)
+		return err
+	}
+	s.status.updaterStarted(UpdaterStream)
+	return nil
 }
 
 func (s *flagConfigStreamer) stopInternal() {
@@ -165,6 +211,11 @@ func (s *flagConfigStreamer) Stop() {
 	s.stopInternal()
 }
 
+func (s *flagConfigStreamer) wait() {
+	waitFor(s.flagConfigStreamApi)
+	s.wg.Wait()
+}
+
 // The poller for flag configs. It polls every configured interval.
 // On start, it polls a set of flag configs. If failed, error is returned. If success, poller starts.
 type flagConfigPoller struct {
@@ -172,20 +223,23 @@ type flagConfigPoller struct {
 	flagConfigApi flagConfigApi
 	config        *Config
 	poller        *poller
+	pollerWg      sync.WaitGroup
 	lock          sync.Mutex
 }
 
 func newFlagConfigPoller(
 	flagConfigApi flagConfigApi,
 	config *Config,
-	flagConfigStorage flagConfigStorage,
-	cohortStorage cohortStorage,
+	flagConfigStorage FlagConfigStorage,
+	cohortStorage CohortStorage,
 	cohortLoader *cohortLoader,
+	status *statusTracker,
+	index *flagIndexCache,
 ) flagConfigUpdater {
 	return &flagConfigPoller{
 		flagConfigApi:         flagConfigApi,
 		config:                config,
-		flagConfigUpdaterBase: newFlagConfigUpdaterBase(flagConfigStorage, cohortStorage, cohortLoader, config),
+		flagConfigUpdaterBase: newFlagConfigUpdaterBase(flagConfigStorage, cohortStorage, cohortLoader, status, index, config),
 	}
 }
 
@@ -197,16 +251,23 @@ func (p *flagConfigPoller) Start(onError func(error)) error {
 
 	if err := p.updateFlagConfigs(); err != nil {
 		p.log.Error("Initial updateFlagConfigs failed: %v", err)
+		p.status.failed(err)
 		return err
 	}
+	p.status.updaterStarted(UpdaterPoll)
 
-	p.poller = newPoller()
+	p.poller = newPollerWithWaitGroup(&p.pollerWg)
 	p.poller.Poll(p.config.FlagConfigPollerInterval, func() {
 		if err := p.periodicRefresh(); err != nil {
 			p.log.Error("Periodic updateFlagConfigs failed: %v", err)
 			p.Stop()
+			p.status.updaterFailed(UpdaterPoll, err)
 			if (onError != nil) {
-				go func() {onError(err)}()
+				p.pollerWg.Add(1)
+				go func() {
+					defer p.pollerWg.Done()
+					onError(err)
+				}()
 			}
 		}
 	})
@@ -235,7 +296,7 @@ func (p *flagConfigPoller) updateFlagConfigs() error {
 
 func (p *flagConfigPoller) stopInternal() {
 	if p.poller != nil {
-		close(p.poller.shutdown)
+		p.poller.stop()
 		p.poller = nil
 	}
 }
@@ -246,6 +307,10 @@ func (p *flagConfigPoller) Stop() {
 	p.stopInternal()
 }
 
+func (p *flagConfigPoller) wait() {
+	p.pollerWg.Wait()
+}
+
 // A wrapper around flag config updaters to retry and fallback.
 // If the main updater fails, it will fallback to the fallback updater and main updater enters retry loop.
 type flagConfigFallbackRetryWrapper struct {
@@ -260,6 +325,9 @@ type flagConfigFallbackRetryWrapper struct {
 	fallbackStartRetryTimer *time.Timer
 	lock            sync.Mutex
 	isRunning       bool
+	// wg tracks the retry goroutines and pending retry timers, so that wait blocks until none can
+	// restart an updater.
+	wg              sync.WaitGroup
 }
 
 func newflagConfigFallbackRetryWrapper(
@@ -303,21 +371,16 @@ func (w *flagConfigFallbackRetryWrapper) Start(onError func(error)) error {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	if w.retryTimer != nil {
-		w.retryTimer.Stop()
-		w.retryTimer = nil
-	}
+	w.stopRetryTimer()
 
 	err := w.mainUpdater.Start(func(err error) {
 		w.log.Debug("main updater updating err, starting fallback if available. error: ", err)
-		go func() { w.scheduleRetry() }() // Don't care if poller start error or not, always retry.
-		go func() { w.fallbackStart() }()
+		w.goTracked(w.scheduleRetry) // Don't care if poller start error or not, always retry.
+		w.goTracked(w.fallbackStart)
 	})
 	if err == nil {
 		// Main start success, stop fallback.
-		if w.fallbackStartRetryTimer != nil {
-			w.fallbackStartRetryTimer.Stop()
-		}
+		w.stopFallbackStartRetryTimer()
 		if w.fallbackUpdater != nil {
 			w.fallbackUpdater.Stop()
 		}
@@ -337,7 +400,7 @@ func (w *flagConfigFallbackRetryWrapper) Start(onError func(error)) error {
 	}
 
 	w.isRunning = true
-	go func() { w.scheduleRetry() }()
+	w.goLocked(w.scheduleRetry)
 	return nil
 }
 
@@ -346,19 +409,22 @@ func (w *flagConfigFallbackRetryWrapper) Stop() {
 	defer w.lock.Unlock()
 	w.isRunning = false
 
-	if w.retryTimer != nil {
-		w.retryTimer.Stop()
-		w.retryTimer = nil
-	}
+	w.stopRetryTimer()
 	w.mainUpdater.Stop()
-	if w.fallbackStartRetryTimer != nil {
-		w.fallbackStartRetryTimer.Stop()
-	}
+	w.stopFallbackStartRetryTimer()
 	if w.fallbackUpdater != nil {
 		w.fallbackUpdater.Stop()
 	}
 }
 
+func (w *flagConfigFallbackRetryWrapper) wait() {
+	w.wg.Wait()
+	waitFor(w.mainUpdater)
+	if w.fallbackUpdater != nil {
+		waitFor(w.fallbackUpdater)
+	}
+}
+
 func (w *flagConfigFallbackRetryWrapper) scheduleRetry() {
 	w.lock.Lock()
 	defer w.lock.Unlock()
@@ -367,11 +433,10 @@ func (w *flagConfigFallbackRetryWrapper) scheduleRetry() {
 		return
 	}
 
-	if w.retryTimer != nil {
-		w.retryTimer.Stop()
-		w.retryTimer = nil
-	}
+	w.stopRetryTimer()
+	w.wg.Add(1)
 	w.retryTimer = time.AfterFunc(randTimeDuration(w.retryDelay, w.maxJitter), func() {
+		defer w.wg.Done()
 		w.lock.Lock()
 		defer w.lock.Unlock()
 
@@ -386,22 +451,20 @@ func (w *flagConfigFallbackRetryWrapper) scheduleRetry() {
 		w.log.Debug("main updater retry start")
 		err := w.mainUpdater.Start(func(err error) {
 			w.log.Debug("main updater updating err, starting fallback if available. error: ", err)
-			go func() { w.scheduleRetry() }() // Don't care if poller start error or not, always retry.
-			go func() { w.fallbackStart() }()
+			w.goTracked(w.scheduleRetry) // Don't care if poller start error or not, always retry.
+			w.goTracked(w.fallbackStart)
 		})
 		if err == nil {
 			// Main start success, stop fallback.
 			w.log.Debug("main updater retry start success")
-			if w.fallbackStartRetryTimer != nil {
-				w.fallbackStartRetryTimer.Stop()
-			}
+			w.stopFallbackStartRetryTimer()
 			if w.fallbackUpdater != nil {
 				w.fallbackUpdater.Stop()
 			}
 			return
 		}
 
-		go func() { w.scheduleRetry() }()
+		w.goLocked(w.scheduleRetry)
 	})
 }
 
@@ -419,8 +482,51 @@ func (w *flagConfigFallbackRetryWrapper) fallbackStart() {
 	err := w.fallbackUpdater.Start(nil)
 	if (err != nil) {
 		w.log.Debug("fallback updater start failed and scheduling retry")
+		w.stopFallbackStartRetryTimer()
+		w.wg.Add(1)
 		w.fallbackStartRetryTimer = time.AfterFunc(randTimeDuration(w.fallbackStartRetryDelay, w.fallbackStartRetryMaxJitter), func() {
+			defer w.wg.Done()
 			w.fallbackStart()
 		})
 	}
 }
+
+// goTracked runs fn in a goroutine which wait waits for, unless the wrapper has been stopped.
+func (w *flagConfigFallbackRetryWrapper) goTracked(fn func()) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.goLocked(fn)
+}
+
+// goLocked is goTracked for callers holding w.lock.
+func (w *flagConfigFallbackRetryWrapper) goLocked(fn func()) {
+	if !w.isRunning {
+		return
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		fn()
+	}()
+}
+
+// stopRetryTimer stops the main updater retry timer, if any. A timer which had not fired no longer
+// counts towards wait. w.lock must be held.
+func (w *flagConfigFallbackRetryWrapper) stopRetryTimer() {
+	if w.retryTimer != nil {
+		if w.retryTimer.Stop() {
+			w.wg.Done()
+		}
+		w.retryTimer = nil
+	}
+}
+
+// stopFallbackStartRetryTimer stops the fallback start retry timer, like stopRetryTimer.
+func (w *flagConfigFallbackRetryWrapper) stopFallbackStartRetryTimer() {
+	if w.fallbackStartRetryTimer != nil {
+		if w.fallbackStartRetryTimer.Stop() {
+			w.wg.Done()
+		}
+		w.fallbackStartRetryTimer = nil
+	}
+}
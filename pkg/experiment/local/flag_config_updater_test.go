@@ -2,6 +2,7 @@ package local
 
 import (
 	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -10,7 +11,7 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func createTestPollerObjs() (mockFlagConfigApi, flagConfigStorage, cohortStorage, *cohortLoader) {
+func createTestPollerObjs() (mockFlagConfigApi, FlagConfigStorage, CohortStorage, *cohortLoader) {
 	api := mockFlagConfigApi{}
 	cohortDownloadAPI := &mockCohortDownloadApi{}
 	flagConfigStorage := newInMemoryFlagConfigStorage()
@@ -23,7 +24,7 @@ func TestFlagConfigPoller(t *testing.T) {
 	api, flagConfigStorage, cohortStorage, cohortLoader := createTestPollerObjs()
 
 	config := &Config{FlagConfigPollerInterval: 1 * time.Second, LogLevel: logger.Error, LoggerProvider: logger.NewDefault()}
-	poller := newFlagConfigPoller(&api, config, flagConfigStorage, cohortStorage, cohortLoader)
+	poller := newFlagConfigPoller(&api, config, flagConfigStorage, cohortStorage, cohortLoader, nil, nil)
 	errorCh := make(chan error)
 
 	// Poller start normal.
@@ -34,14 +35,14 @@ func TestFlagConfigPoller(t *testing.T) {
 		errorCh <- e
 	}) // Start should block for first poll.
 	assert.Nil(t, err)
-	assert.Equal(t, FLAG_1, flagConfigStorage.getFlagConfigs()) // Test flags in storage.
+	assert.Equal(t, FLAG_1, flagConfigStorage.GetFlagConfigs()) // Test flags in storage.
 
 	// Change up flags to empty.
 	api.getFlagConfigsFunc = func() (map[string]*evaluation.Flag, error) {
 		return map[string]*evaluation.Flag{}, nil
 	}
 	time.Sleep(1100 * time.Millisecond)                                                // Sleep for poller to poll.
-	assert.Equal(t, map[string]*evaluation.Flag{}, flagConfigStorage.getFlagConfigs()) // Test flags empty in storage.
+	assert.Equal(t, map[string]*evaluation.Flag{}, flagConfigStorage.GetFlagConfigs()) // Test flags empty in storage.
 
 	// Stop poller, make sure there's no more poll.
 	poller.Stop()
@@ -56,7 +57,7 @@ func TestFlagConfigPollerStartFail(t *testing.T) {
 	api, flagConfigStorage, cohortStorage, cohortLoader := createTestPollerObjs()
 
 	config := &Config{FlagConfigPollerInterval: 1 * time.Second, LogLevel: logger.Error, LoggerProvider: logger.NewDefault()}
-	poller := newFlagConfigPoller(&api, config, flagConfigStorage, cohortStorage, cohortLoader)
+	poller := newFlagConfigPoller(&api, config, flagConfigStorage, cohortStorage, cohortLoader, nil, nil)
 	errorCh := make(chan error)
 
 	// Poller start normal.
@@ -73,7 +74,7 @@ func TestFlagConfigPollerPollingFail(t *testing.T) {
 	api, flagConfigStorage, cohortStorage, cohortLoader := createTestPollerObjs()
 
 	config := &Config{FlagConfigPollerInterval: 1 * time.Second, LogLevel: logger.Error, LoggerProvider: logger.NewDefault()}
-	poller := newFlagConfigPoller(&api, config, flagConfigStorage, cohortStorage, cohortLoader)
+	poller := newFlagConfigPoller(&api, config, flagConfigStorage, cohortStorage, cohortLoader, nil, nil)
 	errorCh := make(chan error)
 
 	// Poller start normal.
@@ -84,7 +85,7 @@ func TestFlagConfigPollerPollingFail(t *testing.T) {
 		errorCh <- e
 	}) // Start should block for first poll.
 	assert.Nil(t, err)
-	assert.Equal(t, FLAG_1, flagConfigStorage.getFlagConfigs()) // Test flags in storage.
+	assert.Equal(t, FLAG_1, flagConfigStorage.GetFlagConfigs()) // Test flags in storage.
 
 	// Return error on poll.
 	api.getFlagConfigsFunc = func() (map[string]*evaluation.Flag, error) {
@@ -108,7 +109,7 @@ func TestFlagConfigPollerPollingFail(t *testing.T) {
 		errorCh <- e
 	})
 	assert.Nil(t, err)
-	assert.Equal(t, map[string]*evaluation.Flag{}, flagConfigStorage.getFlagConfigs()) // Test flags in storage.
+	assert.Equal(t, map[string]*evaluation.Flag{}, flagConfigStorage.GetFlagConfigs()) // Test flags in storage.
 }
 
 type mockFlagConfigStreamApi struct {
@@ -129,7 +130,7 @@ func (api *mockFlagConfigStreamApi) Connect(
 }
 func (api *mockFlagConfigStreamApi) Close() { api.closeFunc() }
 
-func createTestStreamerObjs() (mockFlagConfigStreamApi, flagConfigStorage, cohortStorage, *cohortLoader) {
+func createTestStreamerObjs() (mockFlagConfigStreamApi, FlagConfigStorage, CohortStorage, *cohortLoader) {
 	api := mockFlagConfigStreamApi{}
 	cohortDownloadAPI := &mockCohortDownloadApi{}
 	flagConfigStorage := newInMemoryFlagConfigStorage()
@@ -142,7 +143,7 @@ func TestFlagConfigStreamer(t *testing.T) {
 	api, flagConfigStorage, cohortStorage, cohortLoader := createTestStreamerObjs()
 
 	config := &Config{FlagConfigPollerInterval: 1 * time.Second, LogLevel: logger.Debug, LoggerProvider: logger.NewDefault()}
-	streamer := newFlagConfigStreamer(&api, config, flagConfigStorage, cohortStorage, cohortLoader)
+	streamer := newFlagConfigStreamer(&api, config, flagConfigStorage, cohortStorage, cohortLoader, nil, nil)
 	errorCh := make(chan error)
 
 	var updateCb func(map[string]*evaluation.Flag) error
@@ -164,12 +165,12 @@ func TestFlagConfigStreamer(t *testing.T) {
 		errorCh <- e
 	}) // Start should block for first set of flags.
 	assert.Nil(t, err)
-	assert.Equal(t, FLAG_1, flagConfigStorage.getFlagConfigs()) // Test flags in storage.
+	assert.Equal(t, FLAG_1, flagConfigStorage.GetFlagConfigs()) // Test flags in storage.
 
 	// Update flags with empty set.
 	err = updateCb(map[string]*evaluation.Flag{})
 	assert.Nil(t, err)
-	assert.Equal(t, map[string]*evaluation.Flag{}, flagConfigStorage.getFlagConfigs()) // Empty flags are updated.
+	assert.Equal(t, map[string]*evaluation.Flag{}, flagConfigStorage.GetFlagConfigs()) // Empty flags are updated.
 
 	// Stop streamer.
 	streamer.Stop()
@@ -180,7 +181,7 @@ func TestFlagConfigStreamer(t *testing.T) {
 		errorCh <- e
 	}) // Start should block for first set of flags.
 	assert.Nil(t, err)
-	assert.Equal(t, FLAG_1, flagConfigStorage.getFlagConfigs()) // Test flags in storage.
+	assert.Equal(t, FLAG_1, flagConfigStorage.GetFlagConfigs()) // Test flags in storage.
 
 	streamer.Stop()
 }
@@ -189,7 +190,7 @@ func TestFlagConfigStreamerStartFail(t *testing.T) {
 	api, flagConfigStorage, cohortStorage, cohortLoader := createTestStreamerObjs()
 
 	config := &Config{FlagConfigPollerInterval: 1 * time.Second, LogLevel: logger.Debug, LoggerProvider: logger.NewDefault()}
-	streamer := newFlagConfigStreamer(&api, config, flagConfigStorage, cohortStorage, cohortLoader)
+	streamer := newFlagConfigStreamer(&api, config, flagConfigStorage, cohortStorage, cohortLoader, nil, nil)
 	errorCh := make(chan error)
 
 	api.connectFunc = func(
@@ -213,7 +214,7 @@ func TestFlagConfigStreamerStreamingFail(t *testing.T) {
 	api, flagConfigStorage, cohortStorage, cohortLoader := createTestStreamerObjs()
 
 	config := &Config{FlagConfigPollerInterval: 1 * time.Second, LogLevel: logger.Debug, LoggerProvider: logger.NewDefault()}
-	streamer := newFlagConfigStreamer(&api, config, flagConfigStorage, cohortStorage, cohortLoader)
+	streamer := newFlagConfigStreamer(&api, config, flagConfigStorage, cohortStorage, cohortLoader, nil, nil)
 	errorCh := make(chan error)
 
 	var updateCb func(map[string]*evaluation.Flag) error
@@ -238,7 +239,7 @@ func TestFlagConfigStreamerStreamingFail(t *testing.T) {
 		errorCh <- e
 	}) // Start should block for first set of flags.
 	assert.Nil(t, err)
-	assert.Equal(t, FLAG_1, flagConfigStorage.getFlagConfigs()) // Test flags in storage.
+	assert.Equal(t, FLAG_1, flagConfigStorage.GetFlagConfigs()) // Test flags in storage.
 
 	// Stream error.
 	go func() { errorCb(errors.New("stream error")) }()
@@ -247,12 +248,12 @@ func TestFlagConfigStreamerStreamingFail(t *testing.T) {
 	assert.Nil(t, errorCb)
 
 	// Streamer start again.
-	flagConfigStorage.removeIf(func(f *evaluation.Flag) bool { return true })
+	flagConfigStorage.RemoveIf(func(f *evaluation.Flag) bool { return true })
 	err = streamer.Start(func(e error) {
 		errorCh <- e
 	}) // Start should block for first set of flags.
 	assert.Nil(t, err)
-	assert.Equal(t, FLAG_1, flagConfigStorage.getFlagConfigs()) // Test flags in storage.
+	assert.Equal(t, FLAG_1, flagConfigStorage.GetFlagConfigs()) // Test flags in storage.
 
 	streamer.Stop()
 }
@@ -571,3 +572,37 @@ func TestFlagConfigFallbackRetryWrapperMainOnly(t *testing.T) {
 
 	w.Stop()
 }
+
+func TestFlagConfigFallbackRetryWrapperWaitAfterStop(t *testing.T) {
+	var mainStarts, fallbackStarts atomic.Int32
+	var mainOnError func(error)
+	main := mockFlagConfigUpdater{}
+	main.startFunc = func(onError func(error)) error {
+		mainOnError = onError
+		mainStarts.Add(1)
+		return nil
+	}
+	main.stopFunc = func() {}
+	fallback := mockFlagConfigUpdater{}
+	fallback.startFunc = func(onError func(error)) error {
+		fallbackStarts.Add(1)
+		return errors.New("fallback start error")
+	}
+	fallback.stopFunc = func() {}
+	w := newflagConfigFallbackRetryWrapper(&main, &fallback, 50*time.Millisecond, 0, 50*time.Millisecond, 0, logger.Error, logger.NewDefault())
+	assert.Nil(t, w.Start(nil))
+
+	// An updating error schedules a main retry and a fallback start, which fails and schedules a
+	// fallback start retry.
+	mainOnError(errors.New("main error"))
+	time.Sleep(20 * time.Millisecond)
+	w.Stop()
+	waitFor(w)
+	mainStartsAfterStop, fallbackStartsAfterStop := mainStarts.Load(), fallbackStarts.Load()
+
+	// Neither updater is started after wait returns.
+	mainOnError(errors.New("main error"))
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, mainStartsAfterStop, mainStarts.Load())
+	assert.Equal(t, fallbackStartsAfterStop, fallbackStarts.Load())
+}
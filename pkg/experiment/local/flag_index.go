@@ -0,0 +1,208 @@
+package local
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/amplitude/experiment-go-server/internal/evaluation"
+)
+
+// flagIndex is derived from the flag configs in storage each time they are updated, so that
+// evaluations do not sort flags or collect cohort IDs on every call.
+type flagIndex struct {
+	// sorted contains every flag, dependencies first, or is nil if the flags have a cycle.
+	sorted    []*evaluation.Flag
+	sortedErr error
+	// closures contains the sorted dependency closure of each flag, by flag key.
+	closures map[string]flagClosure
+	// cohortIDs contains the cohort IDs targeted by each flag, by flag key.
+	cohortIDs map[string]map[string]struct{}
+	// groupedCohortIDs contains the cohort IDs targeted by any flag, by group type.
+	groupedCohortIDs map[string]map[string]struct{}
+	// version is the VersionedFlagConfigStorage version the index was built from, if any.
+	version uint64
+	// flags contains the flag configs of an index which is not built in advance, in which case only
+	// the flags of each evaluation are sorted and their cohort IDs collected, or nil otherwise.
+	flags map[string]*evaluation.Flag
+}
+
+// flagClosure is a flag and its transitive dependencies, dependencies first.
+type flagClosure struct {
+	flags []*evaluation.Flag
+	err   error
+	// groupedCohortIDs contains the cohort IDs targeted by the flags, by group type.
+	groupedCohortIDs map[string]map[string]struct{}
+}
+
+func newFlagIndex(flags map[string]*evaluation.Flag) *flagIndex {
+	index := &flagIndex{
+		closures:  make(map[string]flagClosure, len(flags)),
+		cohortIDs: make(map[string]map[string]struct{}, len(flags)),
+	}
+	index.sorted, index.sortedErr = topologicalSort(flags, nil)
+	flagsArray := make([]*evaluation.Flag, 0, len(flags))
+	for key, flag := range flags {
+		closure, err := topologicalSort(flags, []string{key})
+		index.closures[key] = flagClosure{
+			flags:            closure,
+			err:              err,
+			groupedCohortIDs: getGroupedCohortIDsFromFlags(closure),
+		}
+		index.cohortIDs[key] = getAllCohortIDsFromFlag(flag)
+		flagsArray = append(flagsArray, flag)
+	}
+	index.groupedCohortIDs = getGroupedCohortIDsFromFlags(flagsArray)
+	return index
+}
+
+// newUnbuiltFlagIndex returns an index of the flags which is not built in advance, for flag configs
+// which are read from storage for a single evaluation.
+func newUnbuiltFlagIndex(flags map[string]*evaluation.Flag) *flagIndex {
+	return &flagIndex{flags: flags}
+}
+
+// sortedFlags returns the same flags as topologicalSort for the indexed flags and flag keys. The
+// result must not be modified.
+func (i *flagIndex) sortedFlags(flagKeys []string) ([]*evaluation.Flag, error) {
+	if i.flags != nil {
+		return topologicalSort(i.flags, flagKeys)
+	}
+	if len(flagKeys) == 0 {
+		return i.sorted, i.sortedErr
+	}
+	if len(flagKeys) == 1 {
+		closure, ok := i.closures[flagKeys[0]]
+		if !ok {
+			return []*evaluation.Flag{}, nil
+		}
+		return closure.flags, closure.err
+	}
+	result := make([]*evaluation.Flag, 0)
+	seen := make(map[string]struct{})
+	for _, flagKey := range flagKeys {
+		closure := i.closures[flagKey]
+		if closure.err != nil {
+			return nil, closure.err
+		}
+		for _, flag := range closure.flags {
+			if _, ok := seen[flag.Key]; !ok {
+				seen[flag.Key] = struct{}{}
+				result = append(result, flag)
+			}
+		}
+	}
+	return result, nil
+}
+
+// closure returns the dependency closure of the flag, or false if the flag is not indexed.
+func (i *flagIndex) closure(flagKey string) (flagClosure, bool) {
+	if i.flags == nil {
+		closure, ok := i.closures[flagKey]
+		return closure, ok
+	}
+	if _, ok := i.flags[flagKey]; !ok {
+		return flagClosure{}, false
+	}
+	flags, err := topologicalSort(i.flags, []string{flagKey})
+	return flagClosure{flags: flags, err: err, groupedCohortIDs: getGroupedCohortIDsFromFlags(flags)}, true
+}
+
+// groupedCohortIDsOf returns the cohort IDs targeted by the sorted flags, by group type. For a built
+// index, these are the cohort IDs targeted by any flag.
+func (i *flagIndex) groupedCohortIDsOf(sortedFlags []*evaluation.Flag) map[string]map[string]struct{} {
+	if i.flags != nil {
+		return getGroupedCohortIDsFromFlags(sortedFlags)
+	}
+	return i.groupedCohortIDs
+}
+
+// flagCohortIDs returns the cohort IDs targeted by the flag.
+func (i *flagIndex) flagCohortIDs(flag *evaluation.Flag) map[string]struct{} {
+	if i.flags != nil {
+		return getAllCohortIDsFromFlag(flag)
+	}
+	return i.cohortIDs[flag.Key]
+}
+
+// flagIndexCache holds the index of the flag configs in storage. All methods are safe to call on a
+// nil cache, which holds nothing.
+type flagIndexCache struct {
+	lock  sync.Mutex
+	index atomic.Pointer[flagIndex]
+}
+
+func newFlagIndexCache() *flagIndexCache {
+	return &flagIndexCache{}
+}
+
+// refresh indexes the flag configs currently in storage. It must be called after every update to
+// the storage.
+func (c *flagIndexCache) refresh(flagConfigStorage FlagConfigStorage) {
+	if c == nil || !cachesIndex(flagConfigStorage) {
+		return
+	}
+	// Hold the lock while reading storage, so that concurrent refreshes store the latest index.
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.index.Store(indexStorage(flagConfigStorage))
+}
+
+// current returns the index of the flag configs in storage. The built-in storage is only updated by
+// the client, which refreshes the index after each update, so its cached index is returned. Other
+// storages may be updated outside of the client, so a VersionedFlagConfigStorage is indexed again
+// whenever its version changes, and the flag configs of any other storage are read on every call
+// into an index which is not built in advance, so only the flags evaluated are sorted.
+func (c *flagIndexCache) current(flagConfigStorage FlagConfigStorage) *flagIndex {
+	switch storage := flagConfigStorage.(type) {
+	case *inMemoryFlagConfigStorage:
+		if index := c.get(); index != nil {
+			return index
+		}
+	case VersionedFlagConfigStorage:
+		if c == nil {
+			break
+		}
+		if index := c.get(); index != nil && index.version == storage.Version() {
+			return index
+		}
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		// Another evaluation may have indexed the new version while waiting for the lock.
+		if index := c.get(); index != nil && index.version == storage.Version() {
+			return index
+		}
+		index := indexStorage(storage)
+		c.index.Store(index)
+		return index
+	}
+	return newUnbuiltFlagIndex(flagConfigStorage.GetFlagConfigs())
+}
+
+// cachesIndex returns true if the index of the storage's flag configs is cached between evaluations.
+func cachesIndex(flagConfigStorage FlagConfigStorage) bool {
+	switch flagConfigStorage.(type) {
+	case *inMemoryFlagConfigStorage, VersionedFlagConfigStorage:
+		return true
+	}
+	return false
+}
+
+// indexStorage indexes the flag configs in storage, recording the storage's version if it has one.
+func indexStorage(flagConfigStorage FlagConfigStorage) *flagIndex {
+	if storage, ok := flagConfigStorage.(VersionedFlagConfigStorage); ok {
+		// Read the version first, so that an update made while reading is indexed again.
+		version := storage.Version()
+		index := newFlagIndex(storage.GetFlagConfigs())
+		index.version = version
+		return index
+	}
+	return newFlagIndex(flagConfigStorage.GetFlagConfigs())
+}
+
+// get returns the latest index, or nil if the storage has not been indexed.
+func (c *flagIndexCache) get() *flagIndex {
+	if c == nil {
+		return nil
+	}
+	return c.index.Load()
+}
@@ -0,0 +1,107 @@
+package local
+
+import (
+	"testing"
+	"time"
+
+	"github.com/amplitude/experiment-go-server/internal/evaluation"
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlagIndexSortedFlags(t *testing.T) {
+	flags := map[string]*evaluation.Flag{
+		"1": {Key: "1", Dependencies: []string{"2", "3"}},
+		"2": {Key: "2", Dependencies: []string{"4"}},
+		"3": {Key: "3"},
+		"4": {Key: "4"},
+		"5": {Key: "5", Dependencies: []string{"3"}},
+	}
+	index := newFlagIndex(flags)
+	for _, flagKeys := range [][]string{{"1"}, {"4"}, {"5"}, {"999"}, {"1", "5"}, {"5", "1"}, {"3", "999", "2"}} {
+		expected, err := topologicalSort(flags, flagKeys)
+		assert.NoError(t, err)
+		actual, err := index.sortedFlags(flagKeys)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual, "flag keys %v", flagKeys)
+	}
+	sorted, err := index.sortedFlags(nil)
+	assert.NoError(t, err)
+	assert.Len(t, sorted, len(flags))
+
+	// Cycles fail only the evaluations which include them.
+	flags["3"] = &evaluation.Flag{Key: "3", Dependencies: []string{"5"}}
+	index = newFlagIndex(flags)
+	_, err = index.sortedFlags(nil)
+	assert.Error(t, err)
+	_, err = index.sortedFlags([]string{"1"})
+	assert.Error(t, err)
+	_, err = index.sortedFlags([]string{"4", "5"})
+	assert.Error(t, err)
+	sorted, err = index.sortedFlags([]string{"2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []*evaluation.Flag{flags["4"], flags["2"]}, sorted)
+}
+
+func TestUnbuiltFlagIndex(t *testing.T) {
+	flags := map[string]*evaluation.Flag{
+		"1": {Key: "1", Dependencies: []string{"2"}},
+		"2": {Key: "2", Segments: []*evaluation.Segment{{Conditions: [][]*evaluation.Condition{{
+			{Selector: []string{"context", "user", "cohort_ids"}, Op: evaluation.OpSetContainsAny, Values: []string{"a"}},
+		}}}}},
+		"3": {Key: "3"},
+	}
+	index := newFlagIndex(flags)
+	unbuilt := newUnbuiltFlagIndex(flags)
+	assert.Nil(t, unbuilt.closures)
+	for _, flagKeys := range [][]string{nil, {"1"}, {"3"}, {"999"}, {"3", "1"}} {
+		expected, err := index.sortedFlags(flagKeys)
+		assert.NoError(t, err)
+		actual, err := unbuilt.sortedFlags(flagKeys)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, expected, actual, "flag keys %v", flagKeys)
+	}
+	closure, ok := unbuilt.closure("1")
+	assert.True(t, ok)
+	assert.Equal(t, index.closures["1"], closure)
+	_, ok = unbuilt.closure("999")
+	assert.False(t, ok)
+	sorted, _ := unbuilt.sortedFlags([]string{"3"})
+	assert.Empty(t, unbuilt.groupedCohortIDsOf(sorted))
+	assert.Equal(t, map[string]struct{}{"a": {}}, unbuilt.flagCohortIDs(flags["2"]))
+}
+
+func TestFlagIndexGroupedCohortIDs(t *testing.T) {
+	flags := map[string]*evaluation.Flag{
+		"user": {Key: "user", Segments: []*evaluation.Segment{{Conditions: [][]*evaluation.Condition{{
+			{Selector: []string{"context", "user", "cohort_ids"}, Op: evaluation.OpSetContainsAny, Values: []string{"a", "b"}},
+		}}}}},
+		"group": {Key: "group", Segments: []*evaluation.Segment{{Conditions: [][]*evaluation.Condition{{
+			{Selector: []string{"context", "groups", "org name", "cohort_ids"}, Op: evaluation.OpSetContainsAny, Values: []string{"c"}},
+		}}}}},
+	}
+	index := newFlagIndex(flags)
+	assert.Equal(t, map[string]map[string]struct{}{
+		userGroupType: {"a": {}, "b": {}},
+		"org name":    {"c": {}},
+	}, index.groupedCohortIDs)
+	assert.Equal(t, map[string]struct{}{"c": {}}, index.cohortIDs["group"])
+	assert.Equal(t, map[string]map[string]struct{}{"org name": {"c": {}}}, index.closures["group"].groupedCohortIDs)
+}
+
+func TestFlagConfigUpdaterRefreshesIndex(t *testing.T) {
+	api, flagConfigStorage, cohortStorage, cohortLoader := createTestPollerObjs()
+	config := &Config{FlagConfigPollerInterval: time.Hour, LogLevel: logger.Error, LoggerProvider: logger.NewDefault()}
+	index := newFlagIndexCache()
+	poller := newFlagConfigPoller(&api, config, flagConfigStorage, cohortStorage, cohortLoader, nil, index)
+	api.getFlagConfigsFunc = func() (map[string]*evaluation.Flag, error) {
+		return map[string]*evaluation.Flag{"flag": {Key: "flag"}}, nil
+	}
+	assert.Nil(t, index.get())
+	assert.NoError(t, poller.Start(nil))
+	defer poller.Stop()
+	sorted, err := index.get().sortedFlags(nil)
+	assert.NoError(t, err)
+	assert.Len(t, sorted, 1)
+	assert.Equal(t, "flag", sorted[0].Key)
+}
@@ -0,0 +1,288 @@
+package local
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/amplitude/experiment-go-server/internal/evaluation"
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+)
+
+// OverrideMatcher selects the users a variant override applies to. Create one with UserIdMatcher,
+// DeviceIdMatcher or PredicateMatcher.
+type OverrideMatcher struct {
+	userId    string
+	deviceId  string
+	predicate func(user *experiment.User) bool
+}
+
+// UserIdMatcher matches users with the user ID.
+func UserIdMatcher(userId string) OverrideMatcher {
+	return OverrideMatcher{userId: userId}
+}
+
+// DeviceIdMatcher matches users with the device ID.
+func DeviceIdMatcher(deviceId string) OverrideMatcher {
+	return OverrideMatcher{deviceId: deviceId}
+}
+
+// PredicateMatcher matches users for which the predicate returns true. The predicate is called
+// during evaluation, possibly concurrently, and must be fast and safe for concurrent use.
+func PredicateMatcher(predicate func(user *experiment.User) bool) OverrideMatcher {
+	return OverrideMatcher{predicate: predicate}
+}
+
+// SetOverride forces the variant of the flag for the users selected by the matcher, without
+// changing the flag's config. Overrides are consulted before the engine: an overridden flag is
+// assigned the variant by a single segment, so flags which depend on it see the overridden variant,
+// and the variant's metadata is merged with the flag's metadata as usual, with "overridden" set to
+// true. Overridden variants are not tracked as exposures or assignments.
+//
+// Setting an override for a user ID or device ID which already has one for the flag replaces it.
+// User ID overrides take precedence over device ID overrides, which take precedence over predicate
+// overrides, which are consulted in the order they were set. An override for a variant the flag
+// does not have is ignored.
+func (c *Client) SetOverride(flagKey string, matcher OverrideMatcher, variantKey string) error {
+	return c.overrides.update(func(flags map[string]*flagOverrides) error {
+		return setOverride(flags, flagKey, matcher, variantKey)
+	})
+}
+
+// RemoveOverrides removes all overrides of the flag.
+func (c *Client) RemoveOverrides(flagKey string) {
+	_ = c.overrides.update(func(flags map[string]*flagOverrides) error {
+		delete(flags, flagKey)
+		return nil
+	})
+}
+
+// ClearOverrides removes all overrides.
+func (c *Client) ClearOverrides() {
+	_ = c.overrides.update(func(flags map[string]*flagOverrides) error {
+		clear(flags)
+		return nil
+	})
+}
+
+// serializedOverride is an entry of an overrides file.
+type serializedOverride struct {
+	FlagKey   string   `json:"flagKey"`
+	Variant   string   `json:"variant"`
+	UserIds   []string `json:"userIds,omitempty"`
+	DeviceIds []string `json:"deviceIds,omitempty"`
+}
+
+// LoadOverrides sets the overrides read from r, a JSON array of entries like:
+//
+//	[{"flagKey": "checkout", "variant": "treatment", "userIds": ["qa-user"], "deviceIds": ["qa-device"]}]
+//
+// The overrides are added to the existing overrides, as if set with SetOverride. If any entry is
+// invalid, an error is returned and no overrides are set.
+func (c *Client) LoadOverrides(r io.Reader) error {
+	var entries []*serializedOverride
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return err
+	}
+	return c.overrides.update(func(flags map[string]*flagOverrides) error {
+		for i, entry := range entries {
+			if entry == nil {
+				return fmt.Errorf("override %d is null", i)
+			}
+			for _, userId := range entry.UserIds {
+				if err := setOverride(flags, entry.FlagKey, UserIdMatcher(userId), entry.Variant); err != nil {
+					return fmt.Errorf("override %d: %w", i, err)
+				}
+			}
+			for _, deviceId := range entry.DeviceIds {
+				if err := setOverride(flags, entry.FlagKey, DeviceIdMatcher(deviceId), entry.Variant); err != nil {
+					return fmt.Errorf("override %d: %w", i, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// LoadOverridesFile sets the overrides read from the JSON file, like LoadOverrides.
+func (c *Client) LoadOverridesFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return c.LoadOverrides(file)
+}
+
+// flagOverrides are the overrides of a flag, by matcher type.
+type flagOverrides struct {
+	userIds    map[string]string
+	deviceIds  map[string]string
+	predicates []predicateOverride
+}
+
+type predicateOverride struct {
+	predicate  func(user *experiment.User) bool
+	variantKey string
+}
+
+func (o *flagOverrides) clone() *flagOverrides {
+	clone := &flagOverrides{
+		userIds:    make(map[string]string, len(o.userIds)),
+		deviceIds:  make(map[string]string, len(o.deviceIds)),
+		predicates: append([]predicateOverride(nil), o.predicates...),
+	}
+	for userId, variantKey := range o.userIds {
+		clone.userIds[userId] = variantKey
+	}
+	for deviceId, variantKey := range o.deviceIds {
+		clone.deviceIds[deviceId] = variantKey
+	}
+	return clone
+}
+
+// match returns the variant key the user is overridden to, if any.
+func (o *flagOverrides) match(user *experiment.User) (string, bool) {
+	if user.UserId != "" {
+		if variantKey, ok := o.userIds[user.UserId]; ok {
+			return variantKey, true
+		}
+	}
+	if user.DeviceId != "" {
+		if variantKey, ok := o.deviceIds[user.DeviceId]; ok {
+			return variantKey, true
+		}
+	}
+	for _, override := range o.predicates {
+		if override.predicate(user) {
+			return override.variantKey, true
+		}
+	}
+	return "", false
+}
+
+// setOverride sets the override in flags, which is being updated by overrideStore.update, copying
+// the overrides of the flag before modifying them.
+func setOverride(flags map[string]*flagOverrides, flagKey string, matcher OverrideMatcher, variantKey string) error {
+	if flagKey == "" {
+		return errors.New("override flag key must be set")
+	}
+	if variantKey == "" {
+		return errors.New("override variant key must be set")
+	}
+	var override *flagOverrides
+	if existing, ok := flags[flagKey]; ok {
+		override = existing.clone()
+	} else {
+		override = &flagOverrides{userIds: make(map[string]string), deviceIds: make(map[string]string)}
+	}
+	switch {
+	case matcher.userId != "":
+		override.userIds[matcher.userId] = variantKey
+	case matcher.deviceId != "":
+		override.deviceIds[matcher.deviceId] = variantKey
+	case matcher.predicate != nil:
+		override.predicates = append(override.predicates, predicateOverride{matcher.predicate, variantKey})
+	default:
+		return errors.New("override matcher must have a user id, device id or predicate")
+	}
+	flags[flagKey] = override
+	return nil
+}
+
+// overrideStore holds the overrides of the client. Overrides are replaced rather than modified, so
+// that evaluations read them without locking. The zero value holds no overrides.
+type overrideStore struct {
+	lock  sync.Mutex
+	flags atomic.Pointer[map[string]*flagOverrides]
+}
+
+// update calls fn with a copy of the overrides by flag key, and stores the copy if fn succeeds.
+func (s *overrideStore) update(fn func(flags map[string]*flagOverrides) error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	flags := make(map[string]*flagOverrides)
+	if current := s.flags.Load(); current != nil {
+		for flagKey, override := range *current {
+			flags[flagKey] = override
+		}
+	}
+	if err := fn(flags); err != nil {
+		return err
+	}
+	s.flags.Store(&flags)
+	return nil
+}
+
+// apply returns the sorted flags with each flag overridden for the user replaced by a flag which
+// assigns the overridden variant. The flags are returned as is if none are overridden.
+func (s *overrideStore) apply(user *experiment.User, sortedFlags []*evaluation.Flag) []*evaluation.Flag {
+	current := s.flags.Load()
+	if current == nil || len(*current) == 0 || user == nil {
+		return sortedFlags
+	}
+	var result []*evaluation.Flag
+	for i, flag := range sortedFlags {
+		override, ok := (*current)[flag.Key]
+		if !ok {
+			continue
+		}
+		variantKey, ok := override.match(user)
+		if !ok || flag.Variants[variantKey] == nil {
+			continue
+		}
+		if result == nil {
+			result = append(make([]*evaluation.Flag, 0, len(sortedFlags)), sortedFlags...)
+		}
+		result[i] = overriddenFlag(flag, variantKey)
+	}
+	if result == nil {
+		return sortedFlags
+	}
+	return result
+}
+
+// overriddenFlag returns a flag like the given flag which assigns the variant to every user.
+func overriddenFlag(flag *evaluation.Flag, variantKey string) *evaluation.Flag {
+	return &evaluation.Flag{
+		Key:          flag.Key,
+		Variants:     flag.Variants,
+		Dependencies: flag.Dependencies,
+		Metadata:     flag.Metadata,
+		Segments: []*evaluation.Segment{{
+			Variant:  variantKey,
+			Metadata: map[string]interface{}{"overridden": true},
+		}},
+	}
+}
+
+// isOverridden reports whether the variant was assigned by an override.
+func isOverridden(variant experiment.Variant) bool {
+	overridden, _ := variant.Metadata["overridden"].(bool)
+	return overridden
+}
+
+// withoutOverrides returns the variants without the overridden variants, or the variants themselves
+// if none are overridden.
+func withoutOverrides(variants map[string]experiment.Variant) map[string]experiment.Variant {
+	var result map[string]experiment.Variant
+	for key, variant := range variants {
+		if isOverridden(variant) {
+			if result == nil {
+				result = make(map[string]experiment.Variant, len(variants))
+				for key, variant := range variants {
+					result[key] = variant
+				}
+			}
+			delete(result, key)
+		}
+	}
+	if result == nil {
+		return variants
+	}
+	return result
+}
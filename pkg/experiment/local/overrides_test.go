@@ -0,0 +1,110 @@
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testOverrideFlagsStr = []byte(`[
+  {"key": "flag", "metadata": {"flagVersion": 3}, "variants": {"on": {"key": "on", "value": "on"}, "treatment": {"key": "treatment", "value": "treatment", "payload": {"limit": 2}}, "off": {"key": "off", "metadata": {"default": true}}},
+   "segments": [{"variant": "on"}]},
+  {"key": "dependent", "dependencies": ["flag"], "variants": {"on": {"key": "on", "value": "on"}, "off": {"key": "off", "metadata": {"default": true}}},
+   "segments": [{"conditions": [[{"selector": ["result", "flag", "key"], "op": "is", "values": ["treatment"]}]], "variant": "on"}, {"variant": "off"}]}
+]`)
+
+func TestSetOverride(t *testing.T) {
+	client, trackedEvents := newTestClient(t, testOverrideFlagsStr, nil)
+	require.Nil(t, client.SetOverride("flag", UserIdMatcher("qa_user"), "treatment"))
+	require.Nil(t, client.SetOverride("flag", DeviceIdMatcher("qa_device"), "off"))
+	require.Nil(t, client.SetOverride("flag", PredicateMatcher(func(user *experiment.User) bool {
+		return strings.HasSuffix(user.UserId, "@example.com")
+	}), "off"))
+	require.Error(t, client.SetOverride("flag", OverrideMatcher{}, "on"))
+	options := &EvaluateOptions{TracksExposure: true}
+
+	variants, err := client.EvaluateV2WithOptions(&experiment.User{UserId: "qa_user", DeviceId: "qa_device"}, options)
+	require.Nil(t, err)
+	assert.Equal(t, experiment.Variant{
+		Key:      "treatment",
+		Value:    "treatment",
+		Payload:  map[string]interface{}{"limit": float64(2)},
+		Metadata: map[string]interface{}{"flagVersion": float64(3), "overridden": true},
+	}, variants["flag"])
+	assert.Equal(t, "on", variants["dependent"].Key)
+	require.Equal(t, 1, len(*trackedEvents))
+	assert.Equal(t, "dependent", (*trackedEvents)[0].EventProperties["[Experiment] Flag Key"])
+
+	variants, err = client.EvaluateV2(&experiment.User{DeviceId: "qa_device"}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, "off", variants["flag"].Key)
+	variants, err = client.EvaluateV2(&experiment.User{UserId: "someone@example.com"}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, "off", variants["flag"].Key)
+	variant, err := client.EvaluateFlag(&experiment.User{UserId: "user_id"}, "flag")
+	require.Nil(t, err)
+	assert.Equal(t, "on", variant.Key)
+	assert.Nil(t, variant.Metadata["overridden"])
+
+	// Overrides of unknown variants are ignored.
+	require.Nil(t, client.SetOverride("flag", UserIdMatcher("qa_user"), "missing"))
+	variant, err = client.EvaluateFlag(&experiment.User{UserId: "qa_user"}, "flag")
+	require.Nil(t, err)
+	assert.Equal(t, "on", variant.Key)
+
+	client.RemoveOverrides("flag")
+	variant, err = client.EvaluateFlag(&experiment.User{DeviceId: "qa_device"}, "flag")
+	require.Nil(t, err)
+	assert.Equal(t, "on", variant.Key)
+}
+
+func TestExplainOverride(t *testing.T) {
+	client, _ := newTestClient(t, testOverrideFlagsStr, nil)
+	require.Nil(t, client.SetOverride("flag", UserIdMatcher("qa_user"), "treatment"))
+
+	trace, err := client.Explain(&experiment.User{UserId: "qa_user"}, "dependent")
+	require.Nil(t, err)
+	assert.Equal(t, "on", trace.Variant.Key)
+	require.Equal(t, 1, len(trace.Dependencies))
+	assert.Equal(t, "treatment", trace.Dependencies[0].Variant.Key)
+
+	trace, err = client.Explain(&experiment.User{UserId: "qa_user"}, "flag")
+	require.Nil(t, err)
+	assert.Equal(t, "treatment", trace.Variant.Key)
+	require.Equal(t, 1, len(trace.Segments))
+	assert.Equal(t, true, trace.Segments[0].Metadata["overridden"])
+	variant, err := client.EvaluateFlag(&experiment.User{UserId: "qa_user"}, "flag")
+	require.Nil(t, err)
+	assert.Equal(t, variant.Key, trace.Variant.Key)
+}
+
+func TestLoadOverrides(t *testing.T) {
+	client, _ := newTestClient(t, testOverrideFlagsStr, nil)
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	require.Nil(t, os.WriteFile(path, []byte(`[
+		{"flagKey": "flag", "variant": "treatment", "userIds": ["qa_user"], "deviceIds": ["qa_device"]},
+		{"flagKey": "dependent", "variant": "off", "userIds": ["qa_user"]}
+	]`), 0o600))
+	require.Nil(t, client.LoadOverridesFile(path))
+
+	variants, err := client.EvaluateV2(&experiment.User{UserId: "qa_user"}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, "treatment", variants["flag"].Key)
+	assert.Equal(t, "off", variants["dependent"].Key)
+	variant, err := client.EvaluateFlag(&experiment.User{DeviceId: "qa_device"}, "flag")
+	require.Nil(t, err)
+	assert.Equal(t, "treatment", variant.Key)
+
+	// An invalid file sets no overrides.
+	client.ClearOverrides()
+	err = client.LoadOverrides(strings.NewReader(`[{"flagKey": "flag", "variant": "off", "userIds": ["user_id"]}, {"flagKey": "flag", "userIds": ["qa_user"]}]`))
+	assert.EqualError(t, err, "override 1: override variant key must be set")
+	variant, err = client.EvaluateFlag(&experiment.User{UserId: "user_id"}, "flag")
+	require.Nil(t, err)
+	assert.Equal(t, "on", variant.Key)
+}
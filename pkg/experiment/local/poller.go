@@ -1,28 +1,61 @@
 package local
 
-import "time"
+import (
+	"sync"
+	"time"
+)
 
 type poller struct {
-	shutdown chan bool
+	shutdown     chan bool
+	shutdownOnce sync.Once
+	wg           *sync.WaitGroup
 }
 
 func newPoller() *poller {
+	return newPollerWithWaitGroup(&sync.WaitGroup{})
+}
+
+// newPollerWithWaitGroup creates a poller which registers its goroutines with
+// the given wait group, so that an owner which replaces its poller on restart
+// can wait for all of them at once.
+func newPollerWithWaitGroup(wg *sync.WaitGroup) *poller {
 	return &poller{
 		shutdown: make(chan bool),
+		wg:       wg,
 	}
 }
 
 func (p *poller) Poll(interval time.Duration, function func()) {
 	ticker := time.NewTicker(interval)
+	p.wg.Add(1)
 	go func() {
+		defer p.wg.Done()
 		for {
 			select {
 			case <-p.shutdown:
 				ticker.Stop()
 				return
 			case <-ticker.C:
-				go function()
+				p.wg.Add(1)
+				go func() {
+					defer p.wg.Done()
+					function()
+				}()
 			}
 		}
 	}()
 }
+
+// stop signals the polling goroutine to exit. It does not wait for in-flight
+// calls to the polled function; use wait for that. Safe to call multiple times.
+func (p *poller) stop() {
+	p.shutdownOnce.Do(func() {
+		close(p.shutdown)
+	})
+}
+
+// wait blocks until the polling goroutine and all in-flight calls to the
+// polled function have returned.
+func (p *poller) wait() {
+	p.wg.Wait()
+}
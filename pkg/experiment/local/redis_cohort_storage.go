@@ -0,0 +1,417 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+)
+
+const redisCohortStorageBatchSize = 1000
+
+// RedisCohortStorage is a CohortStorage backed by a server which speaks the Redis protocol. Each
+// cohort's members are stored in a set, and membership is queried with pipelined SISMEMBER commands,
+// so cohort members are not held in process memory.
+//
+// A fleet of clients may share one store: configure a single client with CohortSyncConfig to
+// download cohorts into the store, and configure the other clients with the same CohortStorage and
+// no CohortSyncConfig, so they only read from it.
+//
+// GetCohort and GetCohorts return cohort metadata without MemberIds. If the server cannot be read,
+// the error is logged and GetCohort, GetCohorts and GetCohortIds return the last state read from or
+// written to the server, so that a transient outage does not appear as cohorts being unloaded.
+type RedisCohortStorage struct {
+	client *redisClient
+	prefix string
+	log    *logger.Logger
+
+	// lock guards the last known cohort IDs and metadata.
+	lock      sync.Mutex
+	cohortIDs map[string]struct{}
+	cohorts   map[string]*Cohort
+}
+
+// NewRedisCohortStorage creates a cohort storage for the configured server. Connections are opened
+// on demand.
+func NewRedisCohortStorage(config *RedisCohortStorageConfig) *RedisCohortStorage {
+	config = fillRedisCohortStorageConfigDefaults(config)
+	return &RedisCohortStorage{
+		client:    newRedisClient(config.Addr, config.Password, config.DB, config.Timeout, config.PoolSize),
+		prefix:    config.KeyPrefix,
+		log:       logger.New(config.LogLevel, config.LoggerProvider),
+		cohortIDs: make(map[string]struct{}),
+		cohorts:   make(map[string]*Cohort),
+	}
+}
+
+// Close closes all pooled connections.
+func (s *RedisCohortStorage) Close() error {
+	return s.client.close()
+}
+
+func (s *RedisCohortStorage) idsKey() string {
+	return s.prefix + "ids"
+}
+
+func (s *RedisCohortStorage) metadataKey(cohortID string) string {
+	return s.prefix + "cohort:" + cohortID
+}
+
+func (s *RedisCohortStorage) membersKey(groupType, cohortID string) string {
+	return s.prefix + "members:" + groupType + ":" + cohortID
+}
+
+func (s *RedisCohortStorage) GetCohort(cohortID string) *Cohort {
+	reply, err := s.client.do(context.Background(), "GET", s.metadataKey(cohortID))
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err != nil {
+		s.log.Error("Failed to get cohort %s, using last known state: %v", cohortID, err)
+		return s.cohorts[cohortID]
+	}
+	cohort := parseRedisCohortMetadata(reply)
+	if cohort != nil {
+		s.cohorts[cohortID] = cohort
+	} else {
+		delete(s.cohorts, cohortID)
+	}
+	return cohort
+}
+
+func (s *RedisCohortStorage) GetCohorts() map[string]*Cohort {
+	cohorts, err := s.getCohorts(context.Background())
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err != nil {
+		s.log.Error("Failed to get cohorts, using last known state: %v", err)
+		cohorts = make(map[string]*Cohort, len(s.cohorts))
+		for id, cohort := range s.cohorts {
+			cohorts[id] = cohort
+		}
+		return cohorts
+	}
+	s.cohortIDs = make(map[string]struct{}, len(cohorts))
+	s.cohorts = make(map[string]*Cohort, len(cohorts))
+	for id, cohort := range cohorts {
+		s.cohortIDs[id] = struct{}{}
+		s.cohorts[id] = cohort
+	}
+	return cohorts
+}
+
+func (s *RedisCohortStorage) getCohorts(ctx context.Context) (map[string]*Cohort, error) {
+	cohorts := make(map[string]*Cohort)
+	ids, err := s.getCohortIdsArray(ctx)
+	if err != nil || len(ids) == 0 {
+		return cohorts, err
+	}
+	cmds := make([][]string, len(ids))
+	for i, id := range ids {
+		cmds[i] = []string{"GET", s.metadataKey(id)}
+	}
+	replies, err := s.client.pipeline(ctx, cmds)
+	if err != nil {
+		return nil, err
+	}
+	for _, reply := range replies {
+		if replyErr, ok := reply.(redisError); ok {
+			return nil, replyErr
+		}
+		if cohort := parseRedisCohortMetadata(reply); cohort != nil {
+			cohorts[cohort.Id] = cohort
+		}
+	}
+	return cohorts, nil
+}
+
+func (s *RedisCohortStorage) GetCohortIds() map[string]struct{} {
+	ids, err := s.getCohortIdsArray(context.Background())
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err != nil {
+		s.log.Error("Failed to get cohort IDs, using last known state: %v", err)
+	} else {
+		s.cohortIDs = make(map[string]struct{}, len(ids))
+		for _, id := range ids {
+			s.cohortIDs[id] = struct{}{}
+		}
+	}
+	cohortIds := make(map[string]struct{}, len(s.cohortIDs))
+	for id := range s.cohortIDs {
+		cohortIds[id] = struct{}{}
+	}
+	return cohortIds
+}
+
+func (s *RedisCohortStorage) getCohortIdsArray(ctx context.Context) ([]string, error) {
+	reply, err := s.client.do(ctx, "SMEMBERS", s.idsKey())
+	if err != nil {
+		return nil, err
+	}
+	return redisStrings(reply), nil
+}
+
+func (s *RedisCohortStorage) GetCohortsForUser(ctx context.Context, userID string, cohortIDs map[string]struct{}) (map[string]struct{}, error) {
+	return s.GetCohortsForGroup(ctx, userGroupType, userID, cohortIDs)
+}
+
+func (s *RedisCohortStorage) GetCohortsForGroup(ctx context.Context, groupType, groupName string, cohortIDs map[string]struct{}) (map[string]struct{}, error) {
+	result := make(map[string]struct{})
+	if len(cohortIDs) == 0 {
+		return result, nil
+	}
+	ids := make([]string, 0, len(cohortIDs))
+	cmds := make([][]string, 0, len(cohortIDs))
+	for cohortID := range cohortIDs {
+		ids = append(ids, cohortID)
+		cmds = append(cmds, []string{"SISMEMBER", s.membersKey(groupType, cohortID), groupName})
+	}
+	replies, err := s.client.pipeline(ctx, cmds)
+	if err != nil {
+		return nil, err
+	}
+	for i, reply := range replies {
+		switch reply := reply.(type) {
+		case redisError:
+			return nil, reply
+		case int64:
+			if reply == 1 {
+				result[ids[i]] = struct{}{}
+			}
+		}
+	}
+	return result, nil
+}
+
+// PutCohort replaces the cohort's members by writing them to a temporary set which is renamed over
+// the current set, in a single transaction, so concurrent lookups never observe a partially written
+// cohort. The temporary set's key is unique to the write, so that clients sharing the server do not
+// overwrite each other's temporary sets.
+func (s *RedisCohortStorage) PutCohort(cohort *Cohort) error {
+	ctx := context.Background()
+	membersKey := s.membersKey(cohort.GroupType, cohort.Id)
+	tmpKey := membersKey + ":tmp:" + strconv.FormatUint(rand.Uint64(), 36)
+	metadata, err := json.Marshal(&serializedCohort{
+		Id:           cohort.Id,
+		LastModified: cohort.LastModified,
+		Size:         cohort.Size,
+		GroupType:    cohort.GroupType,
+	})
+	if err != nil {
+		return err
+	}
+
+	cmds := batchedRedisCommands("SADD", tmpKey, cohort.MemberIds)
+	if len(cohort.MemberIds) > 0 {
+		cmds = append(cmds, []string{"RENAME", tmpKey, membersKey})
+	} else {
+		cmds = append(cmds, []string{"DEL", membersKey})
+	}
+	// Remove members stored under a previous group type.
+	if existing := s.GetCohort(cohort.Id); existing != nil && existing.GroupType != cohort.GroupType {
+		cmds = append(cmds, []string{"DEL", s.membersKey(existing.GroupType, cohort.Id)})
+	}
+	cmds = append(cmds,
+		[]string{"SET", s.metadataKey(cohort.Id), string(metadata)},
+		[]string{"SADD", s.idsKey(), cohort.Id},
+	)
+	if err := s.transaction(ctx, cmds); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cohortIDs[cohort.Id] = struct{}{}
+	s.cohorts[cohort.Id] = &Cohort{
+		Id:           cohort.Id,
+		LastModified: cohort.LastModified,
+		Size:         cohort.Size,
+		GroupType:    cohort.GroupType,
+	}
+	return nil
+}
+
+// ApplyCohortDelta removes and adds the delta's members with SREM and SADD commands, and updates
+// the cohort's metadata, in a single transaction. The stored metadata and the membership of the
+// delta's members are read first to check that the delta applies, so the store must only be written
+// by one client.
+func (s *RedisCohortStorage) ApplyCohortDelta(delta *CohortDelta) (bool, error) {
+	ctx := context.Background()
+	reply, err := s.client.do(ctx, "GET", s.metadataKey(delta.Id))
+	if err != nil {
+		return false, err
+	}
+	stored := parseRedisCohortMetadata(reply)
+	if stored == nil || stored.LastModified != delta.BaseLastModified || stored.GroupType != delta.GroupType {
+		return false, nil
+	}
+	membersKey := s.membersKey(delta.GroupType, delta.Id)
+	size, err := s.patchedSize(ctx, membersKey, stored.Size, delta)
+	if err != nil {
+		return false, err
+	}
+	if size != delta.Size {
+		return false, nil
+	}
+	metadata, err := json.Marshal(&serializedCohort{
+		Id:           delta.Id,
+		LastModified: delta.LastModified,
+		Size:         delta.Size,
+		GroupType:    delta.GroupType,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	cmds := batchedRedisCommands("SREM", membersKey, delta.RemovedMemberIds)
+	cmds = append(cmds, batchedRedisCommands("SADD", membersKey, delta.AddedMemberIds)...)
+	cmds = append(cmds,
+		[]string{"SET", s.metadataKey(delta.Id), string(metadata)},
+		[]string{"SADD", s.idsKey(), delta.Id},
+	)
+	if err := s.transaction(ctx, cmds); err != nil {
+		return false, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cohortIDs[delta.Id] = struct{}{}
+	s.cohorts[delta.Id] = &Cohort{
+		Id:           delta.Id,
+		LastModified: delta.LastModified,
+		Size:         delta.Size,
+		GroupType:    delta.GroupType,
+	}
+	return true, nil
+}
+
+// patchedSize returns the size of the members set after the delta is applied, by checking which of
+// the delta's members are currently in the set of the given size.
+func (s *RedisCohortStorage) patchedSize(ctx context.Context, membersKey string, size int, delta *CohortDelta) (int, error) {
+	// Members which are both removed and added are added, as in CohortDelta.apply.
+	patched := make(map[string]bool, len(delta.RemovedMemberIds)+len(delta.AddedMemberIds))
+	for _, memberID := range delta.RemovedMemberIds {
+		patched[memberID] = false
+	}
+	for _, memberID := range delta.AddedMemberIds {
+		patched[memberID] = true
+	}
+	if len(patched) == 0 {
+		return size, nil
+	}
+	memberIDs := make([]string, 0, len(patched))
+	cmds := make([][]string, 0, len(patched))
+	for memberID := range patched {
+		memberIDs = append(memberIDs, memberID)
+		cmds = append(cmds, []string{"SISMEMBER", membersKey, memberID})
+	}
+	replies, err := s.client.pipeline(ctx, cmds)
+	if err != nil {
+		return 0, err
+	}
+	for i, reply := range replies {
+		switch reply := reply.(type) {
+		case redisError:
+			return 0, reply
+		case int64:
+			isMember := reply == 1
+			if isMember && !patched[memberIDs[i]] {
+				size--
+			} else if !isMember && patched[memberIDs[i]] {
+				size++
+			}
+		}
+	}
+	return size, nil
+}
+
+func (s *RedisCohortStorage) DeleteCohort(groupType, cohortID string) error {
+	err := s.transaction(context.Background(), [][]string{
+		{"SREM", s.idsKey(), cohortID},
+		{"DEL", s.metadataKey(cohortID), s.membersKey(groupType, cohortID)},
+	})
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.cohortIDs, cohortID)
+	delete(s.cohorts, cohortID)
+	return nil
+}
+
+// transaction pipelines the commands in a MULTI/EXEC transaction, so that they are applied
+// atomically, and returns the first error reply.
+func (s *RedisCohortStorage) transaction(ctx context.Context, cmds [][]string) error {
+	pipelined := make([][]string, 0, len(cmds)+2)
+	pipelined = append(pipelined, []string{"MULTI"})
+	pipelined = append(pipelined, cmds...)
+	pipelined = append(pipelined, []string{"EXEC"})
+	replies, err := s.client.pipeline(ctx, pipelined)
+	if err != nil {
+		return err
+	}
+	// Commands are rejected before EXEC if they are invalid, in which case the transaction aborts.
+	for i, reply := range replies {
+		if replyErr, ok := reply.(redisError); ok {
+			return fmt.Errorf("%s: %w", pipelined[i][0], replyErr)
+		}
+	}
+	results, ok := replies[len(replies)-1].([]interface{})
+	if !ok {
+		return errors.New("EXEC: transaction aborted")
+	}
+	for i, result := range results {
+		if replyErr, ok := result.(redisError); ok {
+			return fmt.Errorf("%s: %w", cmds[i][0], replyErr)
+		}
+	}
+	return nil
+}
+
+// batchedRedisCommands returns the commands which pass the members to the command for the key, in
+// batches of redisCohortStorageBatchSize members.
+func batchedRedisCommands(name, key string, members []string) [][]string {
+	var cmds [][]string
+	for start := 0; start < len(members); start += redisCohortStorageBatchSize {
+		end := start + redisCohortStorageBatchSize
+		if end > len(members) {
+			end = len(members)
+		}
+		cmds = append(cmds, append([]string{name, key}, members[start:end]...))
+	}
+	return cmds
+}
+
+func parseRedisCohortMetadata(reply interface{}) *Cohort {
+	value, ok := reply.(string)
+	if !ok {
+		return nil
+	}
+	metadata := &serializedCohort{}
+	if err := json.Unmarshal([]byte(value), metadata); err != nil {
+		return nil
+	}
+	return &Cohort{
+		Id:           metadata.Id,
+		LastModified: metadata.LastModified,
+		Size:         metadata.Size,
+		GroupType:    metadata.GroupType,
+	}
+}
+
+func redisStrings(reply interface{}) []string {
+	array, _ := reply.([]interface{})
+	result := make([]string, 0, len(array))
+	for _, value := range array {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,473 @@
+package local
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amplitude/experiment-go-server/internal/evaluation"
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedisServer is an in-process stand-in for a Redis server which supports the commands used by
+// RedisCohortStorage.
+type fakeRedisServer struct {
+	listener net.Listener
+	password string
+	lock     sync.Mutex
+	strings  map[string]string
+	sets     map[string]map[string]struct{}
+	commands map[string]int
+}
+
+func newFakeRedisServer(t *testing.T, password string) *fakeRedisServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	server := &fakeRedisServer{
+		listener: listener,
+		password: password,
+		strings:  make(map[string]string),
+		sets:     make(map[string]map[string]struct{}),
+		commands: make(map[string]int),
+	}
+	go server.serve()
+	t.Cleanup(func() { _ = listener.Close() })
+	return server
+}
+
+func (s *fakeRedisServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeRedisServer) commandCount(name string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.commands[name]
+}
+
+func (s *fakeRedisServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRedisServer) handle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	authenticated := s.password == ""
+	// queued holds the commands of an open MULTI transaction.
+	var queued [][]string
+	for {
+		args, err := readFakeRedisCommand(r)
+		if err != nil {
+			return
+		}
+		name := strings.ToUpper(args[0])
+		var reply string
+		if name == "AUTH" {
+			if args[1] == s.password {
+				authenticated = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		} else if !authenticated {
+			reply = "-NOAUTH Authentication required.\r\n"
+		} else if name == "MULTI" {
+			queued = [][]string{}
+			reply = "+OK\r\n"
+		} else if name == "EXEC" {
+			reply = s.execTransaction(queued)
+			queued = nil
+		} else if queued != nil {
+			queued = append(queued, args)
+			reply = "+QUEUED\r\n"
+		} else {
+			reply = s.exec(name, args[1:])
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// execTransaction executes the commands atomically and returns the array of their replies.
+func (s *fakeRedisServer) execTransaction(cmds [][]string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(cmds))
+	for _, cmd := range cmds {
+		b.WriteString(s.execLocked(strings.ToUpper(cmd[0]), cmd[1:]))
+	}
+	return b.String()
+}
+
+func (s *fakeRedisServer) exec(name string, args []string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.execLocked(name, args)
+}
+
+func (s *fakeRedisServer) execLocked(name string, args []string) string {
+	s.commands[name]++
+	switch name {
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		value, ok := s.strings[args[0]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		s.strings[args[0]] = args[1]
+		return "+OK\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args {
+			_, isString := s.strings[key]
+			_, isSet := s.sets[key]
+			if isString || isSet {
+				deleted++
+			}
+			delete(s.strings, key)
+			delete(s.sets, key)
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "SADD":
+		set, ok := s.sets[args[0]]
+		if !ok {
+			set = make(map[string]struct{})
+			s.sets[args[0]] = set
+		}
+		for _, member := range args[1:] {
+			set[member] = struct{}{}
+		}
+		return fmt.Sprintf(":%d\r\n", len(args)-1)
+	case "SREM":
+		for _, member := range args[1:] {
+			delete(s.sets[args[0]], member)
+		}
+		return fmt.Sprintf(":%d\r\n", len(args)-1)
+	case "SISMEMBER":
+		if _, ok := s.sets[args[0]][args[1]]; ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "SMEMBERS":
+		var b strings.Builder
+		fmt.Fprintf(&b, "*%d\r\n", len(s.sets[args[0]]))
+		for member := range s.sets[args[0]] {
+			fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(member), member)
+		}
+		return b.String()
+	case "RENAME":
+		set, ok := s.sets[args[0]]
+		if !ok {
+			return "-ERR no such key\r\n"
+		}
+		delete(s.sets, args[0])
+		s.sets[args[1]] = set
+		return "+OK\r\n"
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", name)
+	}
+}
+
+func readFakeRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func newTestRedisCohortStorage(t *testing.T, server *fakeRedisServer, password string) *RedisCohortStorage {
+	storage := NewRedisCohortStorage(&RedisCohortStorageConfig{
+		Addr:     server.addr(),
+		Password: password,
+		DB:       1,
+		LogLevel: logger.Disable,
+	})
+	t.Cleanup(func() { _ = storage.Close() })
+	return storage
+}
+
+func TestRedisCohortStorage(t *testing.T) {
+	server := newFakeRedisServer(t, "secret")
+	storage := newTestRedisCohortStorage(t, server, "secret")
+	ctx := context.Background()
+
+	assert.Nil(t, storage.GetCohort("a"))
+	assert.Equal(t, map[string]struct{}{}, storage.GetCohortIds())
+
+	require.Nil(t, storage.PutCohort(&Cohort{Id: "a", LastModified: 1, Size: 2, MemberIds: []string{"1", "2"}, GroupType: userGroupType}))
+	require.Nil(t, storage.PutCohort(&Cohort{Id: "b", LastModified: 2, Size: 1, MemberIds: []string{"2"}, GroupType: userGroupType}))
+	require.Nil(t, storage.PutCohort(&Cohort{Id: "c", LastModified: 3, Size: 1, MemberIds: []string{"org"}, GroupType: "org name"}))
+
+	assert.Equal(t, &Cohort{Id: "a", LastModified: 1, Size: 2, GroupType: userGroupType}, storage.GetCohort("a"))
+	assert.Equal(t, map[string]struct{}{"a": {}, "b": {}, "c": {}}, storage.GetCohortIds())
+	assert.Equal(t, 3, len(storage.GetCohorts()))
+
+	allCohorts := map[string]struct{}{"a": {}, "b": {}, "c": {}}
+	cohorts, err := storage.GetCohortsForUser(ctx, "1", allCohorts)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{"a": {}}, cohorts)
+	cohorts, err = storage.GetCohortsForUser(ctx, "2", allCohorts)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{"a": {}, "b": {}}, cohorts)
+	cohorts, err = storage.GetCohortsForGroup(ctx, "org name", "org", allCohorts)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{"c": {}}, cohorts)
+
+	// Replacing a cohort replaces its members.
+	require.Nil(t, storage.PutCohort(&Cohort{Id: "a", LastModified: 4, Size: 1, MemberIds: []string{"3"}, GroupType: userGroupType}))
+	cohorts, err = storage.GetCohortsForUser(ctx, "1", allCohorts)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{}, cohorts)
+	cohorts, err = storage.GetCohortsForUser(ctx, "3", allCohorts)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{"a": {}}, cohorts)
+	assert.Equal(t, int64(4), storage.GetCohort("a").LastModified)
+
+	// Cohorts may become empty.
+	require.Nil(t, storage.PutCohort(&Cohort{Id: "b", LastModified: 5, Size: 0, MemberIds: []string{}, GroupType: userGroupType}))
+	cohorts, err = storage.GetCohortsForUser(ctx, "2", allCohorts)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{}, cohorts)
+
+	require.Nil(t, storage.DeleteCohort("org name", "c"))
+	assert.Nil(t, storage.GetCohort("c"))
+	assert.Equal(t, map[string]struct{}{"a": {}, "b": {}}, storage.GetCohortIds())
+	cohorts, err = storage.GetCohortsForGroup(ctx, "org name", "org", allCohorts)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{}, cohorts)
+}
+
+func TestRedisCohortStorageApplyCohortDelta(t *testing.T) {
+	server := newFakeRedisServer(t, "")
+	storage := newTestRedisCohortStorage(t, server, "")
+	ctx := context.Background()
+	require.Nil(t, storage.PutCohort(&Cohort{Id: "a", LastModified: 1, Size: 3, MemberIds: []string{"1", "2", "3"}, GroupType: userGroupType}))
+
+	applied, err := storage.ApplyCohortDelta(&CohortDelta{Id: "a", BaseLastModified: 1, LastModified: 2, Size: 3, GroupType: userGroupType, AddedMemberIds: []string{"4"}, RemovedMemberIds: []string{"2"}})
+	assert.Nil(t, err)
+	assert.True(t, applied)
+	assert.Equal(t, &Cohort{Id: "a", LastModified: 2, Size: 3, GroupType: userGroupType}, storage.GetCohort("a"))
+	for userID, expected := range map[string]map[string]struct{}{"1": {"a": {}}, "2": {}, "4": {"a": {}}} {
+		cohorts, err := storage.GetCohortsForUser(ctx, userID, map[string]struct{}{"a": {}})
+		assert.Nil(t, err)
+		assert.Equal(t, expected, cohorts, "user %s", userID)
+	}
+	assert.Equal(t, 1, server.commandCount("RENAME"))
+
+	// Deltas which do not apply leave the cohort unchanged.
+	for _, delta := range []*CohortDelta{
+		{Id: "a", BaseLastModified: 1, LastModified: 3, Size: 3, GroupType: userGroupType, AddedMemberIds: []string{"5"}, RemovedMemberIds: []string{"4"}},
+		{Id: "a", BaseLastModified: 2, LastModified: 3, Size: 3, GroupType: "org name", AddedMemberIds: []string{"5"}, RemovedMemberIds: []string{"4"}},
+		{Id: "a", BaseLastModified: 2, LastModified: 3, Size: 4, GroupType: userGroupType, AddedMemberIds: []string{"5"}, RemovedMemberIds: []string{"4"}},
+		{Id: "b", BaseLastModified: 2, LastModified: 3, Size: 1, GroupType: userGroupType, AddedMemberIds: []string{"5"}},
+	} {
+		applied, err = storage.ApplyCohortDelta(delta)
+		assert.Nil(t, err)
+		assert.False(t, applied, "delta %+v", delta)
+	}
+	assert.Equal(t, int64(2), storage.GetCohort("a").LastModified)
+	cohorts, err := storage.GetCohortsForUser(ctx, "4", map[string]struct{}{"a": {}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{"a": {}}, cohorts)
+
+	// Members which are both removed and added remain members.
+	applied, err = storage.ApplyCohortDelta(&CohortDelta{Id: "a", BaseLastModified: 2, LastModified: 3, Size: 2, GroupType: userGroupType, AddedMemberIds: []string{"4"}, RemovedMemberIds: []string{"4", "3"}})
+	assert.Nil(t, err)
+	assert.True(t, applied)
+	cohorts, err = storage.GetCohortsForUser(ctx, "4", map[string]struct{}{"a": {}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{"a": {}}, cohorts)
+	cohorts, err = storage.GetCohortsForUser(ctx, "3", map[string]struct{}{"a": {}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{}, cohorts)
+}
+
+func TestRedisCohortStorageDeltaDownloads(t *testing.T) {
+	server := newFakeRedisServer(t, "")
+	storage := newTestRedisCohortStorage(t, server, "")
+	require.Nil(t, storage.PutCohort(&Cohort{Id: "a", LastModified: 1, Size: 3, MemberIds: []string{"1", "2", "3"}, GroupType: userGroupType}))
+	fullDownloads := 0
+	delta := &CohortDelta{Id: "a", BaseLastModified: 1, LastModified: 2, Size: 3, GroupType: userGroupType, AddedMemberIds: []string{"4"}, RemovedMemberIds: []string{"2"}}
+	api := &mockCohortDeltaDownloadApi{
+		mockCohortDownloadApi: mockCohortDownloadApi{getCohortFunc: func(cohortID string, cohort *Cohort) (*Cohort, error) {
+			fullDownloads++
+			return &Cohort{Id: "a", LastModified: 3, Size: 1, MemberIds: []string{"5"}, GroupType: userGroupType}, nil
+		}},
+		getCohortDeltaFunc: func(cohortID string, cohort *Cohort) (*CohortDelta, error) {
+			return delta, nil
+		},
+	}
+	loader := newCohortLoader(api, storage, logger.Disable, logger.NewDefault())
+	loader.deltaDownloads = true
+
+	// The stored cohort has no members in memory, so the storage applies the delta.
+	require.Nil(t, loader.loadCohort("a").wait())
+	assert.Equal(t, 0, fullDownloads)
+	assert.Equal(t, &Cohort{Id: "a", LastModified: 2, Size: 3, GroupType: userGroupType}, storage.GetCohort("a"))
+	cohorts, err := storage.GetCohortsForUser(context.Background(), "4", map[string]struct{}{"a": {}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{"a": {}}, cohorts)
+
+	// A delta which does not apply falls back to a full download.
+	delta = &CohortDelta{Id: "a", BaseLastModified: 2, LastModified: 3, Size: 5, GroupType: userGroupType, AddedMemberIds: []string{"5"}}
+	require.Nil(t, loader.loadCohort("a").wait())
+	assert.Equal(t, 1, fullDownloads)
+	assert.Equal(t, &Cohort{Id: "a", LastModified: 3, Size: 1, GroupType: userGroupType}, storage.GetCohort("a"))
+}
+
+func TestRedisCohortStorageLargeCohortPipelined(t *testing.T) {
+	server := newFakeRedisServer(t, "")
+	storage := newTestRedisCohortStorage(t, server, "")
+	members := make([]string, 2500)
+	for i := range members {
+		members[i] = strconv.Itoa(i)
+	}
+	require.Nil(t, storage.PutCohort(&Cohort{Id: "a", LastModified: 1, Size: len(members), MemberIds: members, GroupType: userGroupType}))
+	assert.Equal(t, 3, server.commandCount("SADD")-1) // Excluding the cohort ID set.
+
+	cohortIDs := make(map[string]struct{})
+	for i := 0; i < 50; i++ {
+		cohortIDs[fmt.Sprintf("cohort-%d", i)] = struct{}{}
+	}
+	cohortIDs["a"] = struct{}{}
+	cohorts, err := storage.GetCohortsForUser(context.Background(), "2499", cohortIDs)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{"a": {}}, cohorts)
+	assert.Equal(t, 51, server.commandCount("SISMEMBER"))
+}
+
+func TestRedisCohortStorageErrors(t *testing.T) {
+	server := newFakeRedisServer(t, "secret")
+	storage := newTestRedisCohortStorage(t, server, "wrong")
+	_, err := storage.GetCohortsForUser(context.Background(), "1", map[string]struct{}{"a": {}})
+	assert.EqualError(t, err, "WRONGPASS invalid password")
+	assert.NotNil(t, storage.PutCohort(&Cohort{Id: "a", MemberIds: []string{"1"}, GroupType: userGroupType}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = storage.GetCohortsForUser(ctx, "1", map[string]struct{}{"a": {}})
+	assert.Equal(t, context.Canceled, err)
+
+	_ = server.listener.Close()
+	storage = newTestRedisCohortStorage(t, server, "secret")
+	_, err = storage.GetCohortsForUser(context.Background(), "1", map[string]struct{}{"a": {}})
+	assert.NotNil(t, err)
+}
+
+func TestClientSharedRedisCohortStorage(t *testing.T) {
+	server := newFakeRedisServer(t, "")
+	// Populated by a single syncing process.
+	require.Nil(t, newTestRedisCohortStorage(t, server, "").PutCohort(&Cohort{Id: CohortId, LastModified: 1, Size: 1, MemberIds: []string{"user"}, GroupType: userGroupType}))
+
+	flagConfigStorage := newReadOnlyFlagConfigStorage(t, []byte(`[]`))
+	flag := createTestFlag()
+	flag.Variants = map[string]*evaluation.Variant{"on": {Key: "on", Value: "on"}}
+	flag.Segments[0].Variant = "on"
+	flagConfigStorage.inMemoryFlagConfigStorage.PutFlagConfig(flag)
+	client, _ := newTestClient(t, []byte(`[]`), &Config{
+		FlagConfigStorage: flagConfigStorage,
+		CohortStorage:     newTestRedisCohortStorage(t, server, ""),
+	})
+
+	variants, err := client.EvaluateV2(&experiment.User{UserId: "user"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "on", variants["flag"].Key)
+	variants, err = client.EvaluateV2(&experiment.User{UserId: "other"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "", variants["flag"].Key)
+}
+
+func TestRedisCohortStorageConcurrentPuts(t *testing.T) {
+	server := newFakeRedisServer(t, "")
+	first := newTestRedisCohortStorage(t, server, "")
+	second := newTestRedisCohortStorage(t, server, "")
+	firstMembers := make([]string, 2500)
+	secondMembers := make([]string, 2500)
+	for i := range firstMembers {
+		firstMembers[i] = "first-" + strconv.Itoa(i)
+		secondMembers[i] = "second-" + strconv.Itoa(i)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, first.PutCohort(&Cohort{Id: "a", Size: len(firstMembers), MemberIds: firstMembers, GroupType: userGroupType}))
+		}()
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, second.PutCohort(&Cohort{Id: "a", Size: len(secondMembers), MemberIds: secondMembers, GroupType: userGroupType}))
+		}()
+	}
+	wg.Wait()
+
+	// The members are those of one write, and no temporary sets are left behind.
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	assert.Equal(t, 2, len(server.sets))
+	members := server.sets[first.membersKey(userGroupType, "a")]
+	assert.Equal(t, 2500, len(members))
+	_, fromFirst := members["first-0"]
+	for member := range members {
+		assert.Equal(t, fromFirst, strings.HasPrefix(member, "first-"))
+	}
+}
+
+func TestRedisCohortStorageLastKnownState(t *testing.T) {
+	server := newFakeRedisServer(t, "")
+	storage := newTestRedisCohortStorage(t, server, "")
+	require.Nil(t, storage.PutCohort(&Cohort{Id: "a", LastModified: 1, Size: 1, MemberIds: []string{"1"}, GroupType: userGroupType}))
+	require.Nil(t, newTestRedisCohortStorage(t, server, "").PutCohort(&Cohort{Id: "b", LastModified: 2, Size: 1, MemberIds: []string{"2"}, GroupType: userGroupType}))
+	assert.Equal(t, 2, len(storage.GetCohorts()))
+
+	// Reads fail once the server is unavailable, but return the last known state.
+	_ = server.listener.Close()
+	_ = storage.client.close()
+	storage.client = newRedisClient(server.addr(), "", 0, time.Second, 1)
+	assert.Equal(t, &Cohort{Id: "a", LastModified: 1, Size: 1, GroupType: userGroupType}, storage.GetCohort("a"))
+	assert.Equal(t, map[string]struct{}{"a": {}, "b": {}}, storage.GetCohortIds())
+	assert.Equal(t, 2, len(storage.GetCohorts()))
+	assert.Nil(t, storage.GetCohort("c"))
+}
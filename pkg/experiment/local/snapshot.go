@@ -0,0 +1,157 @@
+package local
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/amplitude/experiment-go-server/internal/evaluation"
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+)
+
+// snapshotFile is the on-disk format of a snapshot. The checksum is the hex encoded sha256 of data.
+type snapshotFile struct {
+	Checksum string          `json:"checksum"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// snapshotter persists the contents of flag config and cohort storage to a file, and reads it back.
+type snapshotter struct {
+	path              string
+	flagConfigStorage FlagConfigStorage
+	cohortStorage     CohortStorage
+	log               *logger.Logger
+	lastChecksum      string
+	lock              sync.Mutex
+}
+
+func newSnapshotter(
+	deploymentKey string,
+	config *SnapshotConfig,
+	flagConfigStorage FlagConfigStorage,
+	cohortStorage CohortStorage,
+	logLevel logger.LogLevel,
+	loggerProvider logger.LoggerProvider,
+) *snapshotter {
+	// Key the file by a hash of the deployment key so clients for different deployments can share a directory.
+	keyHash := sha256.Sum256([]byte(deploymentKey))
+	fileName := fmt.Sprintf("experiment-snapshot-%s.json", hex.EncodeToString(keyHash[:8]))
+	return &snapshotter{
+		path:              filepath.Join(config.Directory, fileName),
+		flagConfigStorage: flagConfigStorage,
+		cohortStorage:     cohortStorage,
+		log:               logger.New(logLevel, loggerProvider),
+	}
+}
+
+// read reads and verifies the snapshot file.
+func (s *snapshotter) read() (*bootstrapData, error) {
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	file := &snapshotFile{}
+	if err := json.Unmarshal(raw, file); err != nil {
+		return nil, err
+	}
+	if checksum(file.Data) != file.Checksum {
+		return nil, errors.New("snapshot checksum mismatch")
+	}
+	data, err := readBootstrap(&BootstrapConfig{Reader: bytes.NewReader(file.Data)})
+	if err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	s.lastChecksum = file.Checksum
+	s.lock.Unlock()
+	return data, nil
+}
+
+// write atomically writes the current contents of storage to the snapshot file. The file is not
+// rewritten if the contents have not changed since the last read or write.
+func (s *snapshotter) write() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	data := &bootstrapData{
+		Flags:   getFlagConfigsArray(s.flagConfigStorage),
+		Cohorts: make([]*serializedCohort, 0),
+	}
+	if data.Flags == nil {
+		data.Flags = make([]*evaluation.Flag, 0)
+	}
+	sort.Slice(data.Flags, func(i, j int) bool { return data.Flags[i].Key < data.Flags[j].Key })
+	for _, cohort := range s.cohortStorage.GetCohorts() {
+		if cohort.MemberIds == nil && cohort.Size > 0 {
+			// The storage does not hold members in memory, so there is nothing to snapshot.
+			continue
+		}
+		data.Cohorts = append(data.Cohorts, &serializedCohort{
+			Id:           cohort.Id,
+			LastModified: cohort.LastModified,
+			Size:         cohort.Size,
+			MemberIds:    cohort.MemberIds,
+			GroupType:    cohort.GroupType,
+		})
+	}
+	sort.Slice(data.Cohorts, func(i, j int) bool { return data.Cohorts[i].Id < data.Cohorts[j].Id })
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	sum := checksum(rawData)
+	if sum == s.lastChecksum {
+		s.log.Debug("Snapshot unchanged, skipping write.")
+		return nil
+	}
+	raw, err := json.Marshal(&snapshotFile{Checksum: sum, Data: rawData})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, raw); err != nil {
+		return err
+	}
+	s.lastChecksum = sum
+	s.log.Debug("Wrote snapshot of %d flag configs and %d cohorts.", len(data.Flags), len(data.Cohorts))
+	return nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and renames it over path,
+// so readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+package local
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amplitude/experiment-go-server/internal/evaluation"
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotWriteAndRead(t *testing.T) {
+	dir := t.TempDir()
+	config := &SnapshotConfig{Directory: dir}
+	flagConfigStorage := newInMemoryFlagConfigStorage()
+	flagConfigStorage.PutFlagConfig(createTestFlag())
+	cohortStorage := newInMemoryCohortStorage()
+	cohortStorage.PutCohort(&Cohort{Id: CohortId, LastModified: 100, Size: 1, MemberIds: []string{"user"}, GroupType: userGroupType})
+	s := newSnapshotter("server-snapshot-test", config, flagConfigStorage, cohortStorage, logger.Disable, logger.NewDefault())
+
+	require.Nil(t, s.write())
+	info, err := os.Stat(s.path)
+	require.Nil(t, err)
+
+	// Unchanged storage is not rewritten.
+	require.Nil(t, s.write())
+	info2, err := os.Stat(s.path)
+	require.Nil(t, err)
+	assert.Equal(t, info.ModTime(), info2.ModTime())
+
+	restored := newSnapshotter("server-snapshot-test", config, newInMemoryFlagConfigStorage(), newInMemoryCohortStorage(), logger.Disable, logger.NewDefault())
+	data, err := restored.read()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(data.Flags))
+	assert.Equal(t, createTestFlag().Key, data.Flags[0].Key)
+	assert.Equal(t, createTestFlag().Segments, data.Flags[0].Segments)
+	assert.Equal(t, []*serializedCohort{{Id: CohortId, LastModified: 100, Size: 1, MemberIds: []string{"user"}, GroupType: userGroupType}}, data.Cohorts)
+
+	// Snapshots for other deployments are kept separately.
+	other := newSnapshotter("server-snapshot-other", config, newInMemoryFlagConfigStorage(), newInMemoryCohortStorage(), logger.Disable, logger.NewDefault())
+	assert.NotEqual(t, s.path, other.path)
+	_, err = other.read()
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSnapshotReadChecksumMismatch(t *testing.T) {
+	config := &SnapshotConfig{Directory: t.TempDir()}
+	s := newSnapshotter("server-snapshot-corrupt", config, newInMemoryFlagConfigStorage(), newInMemoryCohortStorage(), logger.Disable, logger.NewDefault())
+	err := os.WriteFile(s.path, []byte(`{"checksum":"abc","data":{"flags":[]}}`), 0644)
+	require.Nil(t, err)
+	_, err = s.read()
+	assert.EqualError(t, err, "snapshot checksum mismatch")
+}
+
+func TestClientRestoresSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	apiKey := "server-snapshot-restore-test"
+	server := newTestFlagServer(FLAG_1_STR, nil)
+	client := Initialize(apiKey, &Config{
+		ServerUrl:      server.URL,
+		LogLevel:       logger.Error,
+		SnapshotConfig: &SnapshotConfig{Directory: dir, Interval: time.Hour},
+	})
+	require.Nil(t, client.Start())
+	// Close writes a final snapshot.
+	require.Nil(t, client.Close(context.Background()))
+	server.Close()
+
+	// The flag server is now unavailable, but the client starts from the snapshot.
+	client = Initialize(apiKey, &Config{
+		ServerUrl:                server.URL,
+		FlagConfigPollerInterval: time.Hour,
+		LogLevel:                 logger.Disable,
+		SnapshotConfig:           &SnapshotConfig{Directory: dir, Interval: time.Hour},
+	})
+	defer func() { _ = client.Close(context.Background()) }()
+	assert.True(t, client.Status().Bootstrapped)
+	assert.False(t, client.Ready())
+	assert.Nil(t, client.Start())
+	assert.NotNil(t, client.flagConfigStorage.GetFlagConfig("flagkey"))
+}
+
+func TestDeploymentRunnerRestoredSnapshotPreservesCohortLastModified(t *testing.T) {
+	dir := t.TempDir()
+	snapshotConfig := &SnapshotConfig{Directory: dir, Interval: time.Hour}
+	flagConfigStorage := newInMemoryFlagConfigStorage()
+	flagConfigStorage.PutFlagConfig(createTestFlag())
+	cohortStorage := newInMemoryCohortStorage()
+	cohortStorage.PutCohort(&Cohort{Id: CohortId, LastModified: 100, Size: 1, MemberIds: []string{"user"}, GroupType: userGroupType})
+	require.Nil(t, newSnapshotter("server-snapshot-cohort-test", snapshotConfig, flagConfigStorage, cohortStorage, logger.Disable, logger.NewDefault()).write())
+
+	var requests, notModified int32
+	flagAPI := &mockFlagConfigApi{getFlagConfigsFunc: func() (map[string]*evaluation.Flag, error) {
+		return map[string]*evaluation.Flag{"flag": createTestFlag()}, nil
+	}}
+	cohortDownloadAPI := &mockCohortDownloadApi{getCohortFunc: func(cohortID string, cohort *Cohort) (*Cohort, error) {
+		atomic.AddInt32(&requests, 1)
+		if cohort != nil && cohort.LastModified == 100 {
+			atomic.AddInt32(&notModified, 1)
+			return nil, nil
+		}
+		return &Cohort{Id: CohortId, LastModified: 200, Size: 0, MemberIds: []string{}, GroupType: userGroupType}, nil
+	}}
+	config := &Config{
+		FlagConfigPollerInterval: time.Hour,
+		CohortSyncConfig:         &CohortSyncConfig{CohortPollingInterval: 50 * time.Millisecond},
+		SnapshotConfig:           snapshotConfig,
+		LogLevel:                 logger.Disable,
+		LoggerProvider:           logger.NewDefault(),
+	}
+	flagConfigStorage = newInMemoryFlagConfigStorage()
+	cohortStorage = newInMemoryCohortStorage()
+	cohortLoader := newCohortLoader(cohortDownloadAPI, cohortStorage, logger.Disable, logger.NewDefault())
+	runner := newDeploymentRunner(config, flagAPI, nil, flagConfigStorage, cohortStorage, cohortLoader)
+	err := runner.restoreSnapshot(newSnapshotter("server-snapshot-cohort-test", snapshotConfig, flagConfigStorage, cohortStorage, logger.Disable, logger.NewDefault()))
+	require.Nil(t, err)
+	assert.Equal(t, int64(100), cohortStorage.GetCohort(CohortId).LastModified)
+
+	require.Nil(t, runner.start())
+	defer runner.stop()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&requests) > 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, atomic.LoadInt32(&requests), atomic.LoadInt32(&notModified))
+	assert.Equal(t, int64(100), cohortStorage.GetCohort(CohortId).LastModified)
+}
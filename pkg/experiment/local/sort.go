@@ -7,23 +7,20 @@ import (
 
 func topologicalSort(flags map[string]*evaluation.Flag, flagKeys []string) ([]*evaluation.Flag, error) {
 	result := make([]*evaluation.Flag, 0)
-	// Extract keys and copy flags map
-	keys := make([]string, 0)
-	available := make(map[string]*evaluation.Flag)
-	for k, v := range flags {
-		keys = append(keys, k)
-		available[k] = v
-	}
 	// Get the starting keys
 	var startingKeys []string
 	if len(flagKeys) > 0 {
 		startingKeys = flagKeys
 	} else {
-		startingKeys = keys
+		startingKeys = make([]string, 0, len(flags))
+		for k := range flags {
+			startingKeys = append(startingKeys, k)
+		}
 	}
 	// Sort into result
+	sorted := make(map[string]struct{})
 	for _, flagKey := range startingKeys {
-		traversal, err := parentTraversal(flagKey, available, []string{})
+		traversal, err := parentTraversal(flagKey, flags, sorted, []string{})
 		if err != nil {
 			return nil, err
 		}
@@ -34,14 +31,19 @@ func topologicalSort(flags map[string]*evaluation.Flag, flagKeys []string) ([]*e
 	return result, nil
 }
 
-func parentTraversal(flagKey string, available map[string]*evaluation.Flag, path []string) ([]*evaluation.Flag, error) {
-	flag := available[flagKey]
+// parentTraversal returns the flag and its dependencies which are not yet sorted, dependencies first,
+// and adds them to sorted.
+func parentTraversal(flagKey string, flags map[string]*evaluation.Flag, sorted map[string]struct{}, path []string) ([]*evaluation.Flag, error) {
+	flag := flags[flagKey]
 	if flag == nil {
 		return nil, nil
 	}
+	if _, ok := sorted[flagKey]; ok {
+		return nil, nil
+	}
 	dependencies := flag.Dependencies
 	if len(dependencies) == 0 {
-		delete(available, flagKey)
+		sorted[flagKey] = struct{}{}
 		return []*evaluation.Flag{flag}, nil
 	}
 	path = append(path, flagKey)
@@ -50,7 +52,7 @@ func parentTraversal(flagKey string, available map[string]*evaluation.Flag, path
 		if contains(path, parentKey) {
 			return nil, fmt.Errorf("detected a cycle between flags %v", path)
 		}
-		traversal, err := parentTraversal(parentKey, available, path)
+		traversal, err := parentTraversal(parentKey, flags, sorted, path)
 		if err != nil {
 			return nil, err
 		}
@@ -59,6 +61,6 @@ func parentTraversal(flagKey string, available map[string]*evaluation.Flag, path
 		}
 	}
 	result = append(result, flag)
-	delete(available, flagKey)
+	sorted[flagKey] = struct{}{}
 	return result, nil
 }
@@ -0,0 +1,160 @@
+package local
+
+import (
+	"sync"
+	"time"
+)
+
+// UpdaterType identifies the flag config updater currently delivering flag configs to the client.
+type UpdaterType string
+
+const (
+	// UpdaterNone means no updater is currently running successfully.
+	UpdaterNone UpdaterType = ""
+	// UpdaterStream means flag configs are received through the streaming connection.
+	UpdaterStream UpdaterType = "stream"
+	// UpdaterPoll means flag configs are polled from the flag server.
+	UpdaterPoll UpdaterType = "poll"
+)
+
+// CohortStatus is the load state of a cohort required by the current flag configs.
+type CohortStatus struct {
+	// Loaded is true if the cohort is in cohort storage.
+	Loaded bool
+	// LastModified is the last modified timestamp of the stored cohort, or 0 if not loaded.
+	LastModified int64
+	// LastError is the error of the most recent failed download, or nil if the last download succeeded.
+	LastError error
+}
+
+// Status is a point in time snapshot of the local evaluation client's readiness.
+type Status struct {
+	// Ready is true once flag configs have been synced from the server and, if cohort sync is
+	// configured, all cohorts required by the flag configs are loaded.
+	Ready bool
+	// Bootstrapped is true if flag configs were loaded from the BootstrapConfig or a snapshot. Such
+	// flag configs may be evaluated before the first sync, but do not make the client Ready.
+	Bootstrapped bool
+	// ActiveUpdater is the updater currently delivering flag configs.
+	ActiveUpdater UpdaterType
+	// LastFlagSync is the time of the last successful flag config sync, or the zero time if
+	// flag configs have never been synced.
+	LastFlagSync time.Time
+	// FlagConfigVersion is incremented on every successful flag config sync. It is 0 until the
+	// first sync.
+	FlagConfigVersion uint64
+	// FlagCount is the number of flag configs in storage.
+	FlagCount int
+	// Cohorts is the load state of each cohort required by the flag configs in storage.
+	Cohorts map[string]CohortStatus
+	// LastError is the most recent error encountered while updating flag configs or cohorts,
+	// or nil if the most recent update succeeded.
+	LastError error
+}
+
+// statusTracker records the progress of flag config updaters. All methods are safe to call on a nil
+// tracker, which records nothing.
+type statusTracker struct {
+	lock              sync.Mutex
+	activeUpdater     UpdaterType
+	lastFlagSync      time.Time
+	flagConfigVersion uint64
+	bootstrapped      bool
+	lastError         error
+	changed           chan struct{}
+}
+
+func newStatusTracker() *statusTracker {
+	return &statusTracker{
+		changed: make(chan struct{}),
+	}
+}
+
+// updaterStarted records that the given updater started successfully.
+func (t *statusTracker) updaterStarted(updater UpdaterType) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.activeUpdater = updater
+	t.notifyInternal()
+}
+
+// updaterFailed records that the given updater stopped due to err.
+func (t *statusTracker) updaterFailed(updater UpdaterType, err error) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.activeUpdater == updater {
+		t.activeUpdater = UpdaterNone
+	}
+	t.lastError = err
+	t.notifyInternal()
+}
+
+// flagsSynced records a successful flag config sync. err is any non-fatal error encountered
+// during the sync, e.g. cohorts which failed to load.
+func (t *statusTracker) flagsSynced(err error) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.lastFlagSync = time.Now()
+	t.flagConfigVersion++
+	t.lastError = err
+	t.notifyInternal()
+}
+
+// flagsBootstrapped records that flag configs were loaded from bootstrap data or a snapshot.
+func (t *statusTracker) flagsBootstrapped() {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.bootstrapped = true
+	t.notifyInternal()
+}
+
+// failed records an error which did not stop the active updater.
+func (t *statusTracker) failed(err error) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.lastError = err
+	t.notifyInternal()
+}
+
+// notify wakes up all waiters, e.g. after cohorts have been refreshed.
+func (t *statusTracker) notify() {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.notifyInternal()
+}
+
+func (t *statusTracker) notifyInternal() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// snapshot returns the recorded status and a channel which is closed on the next change.
+func (t *statusTracker) snapshot() (Status, <-chan struct{}) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return Status{
+		ActiveUpdater:     t.activeUpdater,
+		LastFlagSync:      t.lastFlagSync,
+		FlagConfigVersion: t.flagConfigVersion,
+		Bootstrapped:      t.bootstrapped,
+		LastError:         t.lastError,
+	}, t.changed
+}
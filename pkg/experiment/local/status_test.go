@@ -0,0 +1,127 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amplitude/experiment-go-server/internal/evaluation"
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusTracker(t *testing.T) {
+	tracker := newStatusTracker()
+	status, changed := tracker.snapshot()
+	assert.Equal(t, UpdaterNone, status.ActiveUpdater)
+	assert.Equal(t, uint64(0), status.FlagConfigVersion)
+	assert.True(t, status.LastFlagSync.IsZero())
+
+	tracker.updaterStarted(UpdaterStream)
+	select {
+	case <-changed:
+	default:
+		assert.Fail(t, "Expected change to be signalled")
+	}
+	tracker.flagsSynced(nil)
+	tracker.flagsSynced(nil)
+	status, _ = tracker.snapshot()
+	assert.Equal(t, UpdaterStream, status.ActiveUpdater)
+	assert.Equal(t, uint64(2), status.FlagConfigVersion)
+	assert.False(t, status.LastFlagSync.IsZero())
+
+	// Failure of an inactive updater does not change the active updater.
+	pollErr := errors.New("poll error")
+	tracker.updaterFailed(UpdaterPoll, pollErr)
+	status, _ = tracker.snapshot()
+	assert.Equal(t, UpdaterStream, status.ActiveUpdater)
+	assert.Equal(t, pollErr, status.LastError)
+
+	streamErr := errors.New("stream error")
+	tracker.updaterFailed(UpdaterStream, streamErr)
+	status, _ = tracker.snapshot()
+	assert.Equal(t, UpdaterNone, status.ActiveUpdater)
+	assert.Equal(t, streamErr, status.LastError)
+
+	// Nil tracker records nothing.
+	var nilTracker *statusTracker
+	nilTracker.updaterStarted(UpdaterPoll)
+	nilTracker.flagsSynced(nil)
+	nilTracker.notify()
+}
+
+func TestClientStatusReadyAfterFlagSync(t *testing.T) {
+	server := newTestFlagServer(FLAG_1_STR, nil)
+	defer server.Close()
+	client := Initialize("server-status-test", &Config{ServerUrl: server.URL, LogLevel: logger.Error})
+	defer func() { _ = client.Close(context.Background()) }()
+
+	status := client.Status()
+	assert.False(t, status.Ready)
+	assert.False(t, client.Ready())
+	assert.Equal(t, uint64(0), status.FlagConfigVersion)
+
+	err := client.Start()
+	assert.Nil(t, err)
+	status = client.Status()
+	assert.True(t, status.Ready)
+	assert.Equal(t, UpdaterPoll, status.ActiveUpdater)
+	assert.Equal(t, uint64(1), status.FlagConfigVersion)
+	assert.Equal(t, 1, status.FlagCount)
+	assert.Nil(t, status.LastError)
+	assert.Nil(t, client.WaitUntilReady(context.Background()))
+}
+
+func TestClientWaitUntilReadyWaitsForCohorts(t *testing.T) {
+	var cohortAvailable int32
+	flagAPI := &mockFlagConfigApi{getFlagConfigsFunc: func() (map[string]*evaluation.Flag, error) {
+		return map[string]*evaluation.Flag{"flag": createTestFlag()}, nil
+	}}
+	cohortDownloadAPI := &mockCohortDownloadApi{getCohortFunc: func(cohortID string, cohort *Cohort) (*Cohort, error) {
+		if atomic.LoadInt32(&cohortAvailable) == 0 {
+			return nil, errors.New("cohort error")
+		}
+		return &Cohort{Id: CohortId, LastModified: 100, Size: 1, MemberIds: []string{"user"}, GroupType: userGroupType}, nil
+	}}
+	config := &Config{
+		FlagConfigPollerInterval: time.Hour,
+		CohortSyncConfig:         &CohortSyncConfig{CohortPollingInterval: 50 * time.Millisecond},
+		LogLevel:                 logger.Disable,
+		LoggerProvider:           logger.NewDefault(),
+	}
+	flagConfigStorage := newInMemoryFlagConfigStorage()
+	cohortStorage := newInMemoryCohortStorage()
+	cohortLoader := newCohortLoader(cohortDownloadAPI, cohortStorage, logger.Disable, logger.NewDefault())
+	client := &Client{
+		config:            config,
+		flagConfigStorage: flagConfigStorage,
+		cohortStorage:     cohortStorage,
+		cohortLoader:      cohortLoader,
+		deploymentRunner:  newDeploymentRunner(config, flagAPI, nil, flagConfigStorage, cohortStorage, cohortLoader),
+		closed:            make(chan struct{}),
+	}
+	defer func() { _ = client.Close(context.Background()) }()
+	err := client.Start()
+	assert.Nil(t, err)
+
+	status := client.Status()
+	assert.False(t, status.Ready)
+	assert.Equal(t, uint64(1), status.FlagConfigVersion)
+	assert.NotNil(t, status.LastError)
+	assert.False(t, status.Cohorts[CohortId].Loaded)
+	assert.Equal(t, errors.New("cohort error"), status.Cohorts[CohortId].LastError)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, client.WaitUntilReady(ctx))
+
+	atomic.StoreInt32(&cohortAvailable, 1)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, client.WaitUntilReady(ctx))
+	status = client.Status()
+	assert.True(t, status.Ready)
+	assert.Equal(t, CohortStatus{Loaded: true, LastModified: 100}, status.Cohorts[CohortId])
+}
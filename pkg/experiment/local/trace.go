@@ -0,0 +1,18 @@
+package local
+
+import "github.com/amplitude/experiment-go-server/internal/evaluation"
+
+// EvaluationTrace explains how a flag was evaluated for a user. See Client.Explain.
+type EvaluationTrace = evaluation.Trace
+
+// DependencyTrace is the result of a dependency flag consulted during evaluation.
+type DependencyTrace = evaluation.DependencyTrace
+
+// SegmentTrace explains the evaluation of a segment of a flag.
+type SegmentTrace = evaluation.SegmentTrace
+
+// ConditionTrace explains the evaluation of a segment condition.
+type ConditionTrace = evaluation.ConditionTrace
+
+// BucketTrace explains the bucketing of a user into a variant.
+type BucketTrace = evaluation.BucketTrace
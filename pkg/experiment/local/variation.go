@@ -0,0 +1,66 @@
+package local
+
+import (
+	"github.com/amplitude/experiment-go-server/internal/variation"
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+)
+
+// The typed variation methods evaluate a single flag for the user, without tracking an exposure,
+// and decode the variant's payload, or its value if it has no payload, into the requested type. If
+// the flag is not found, is off, or its variant does not decode, the default value is returned with
+// an *experiment.VariationError. If evaluation fails, the default value is returned with the
+// evaluation error.
+
+// BoolVariation returns the flag's variant for the user as a bool.
+func (c *Client) BoolVariation(flagKey string, user *experiment.User, defaultValue bool) (bool, error) {
+	variants, err := c.variationVariants(flagKey, user)
+	if err != nil {
+		return defaultValue, err
+	}
+	return variation.Bool(variants, flagKey, defaultValue)
+}
+
+// StringVariation returns the flag's variant for the user as a string.
+func (c *Client) StringVariation(flagKey string, user *experiment.User, defaultValue string) (string, error) {
+	variants, err := c.variationVariants(flagKey, user)
+	if err != nil {
+		return defaultValue, err
+	}
+	return variation.String(variants, flagKey, defaultValue)
+}
+
+// IntVariation returns the flag's variant for the user as an int.
+func (c *Client) IntVariation(flagKey string, user *experiment.User, defaultValue int) (int, error) {
+	variants, err := c.variationVariants(flagKey, user)
+	if err != nil {
+		return defaultValue, err
+	}
+	return variation.Int(variants, flagKey, defaultValue)
+}
+
+// FloatVariation returns the flag's variant for the user as a float64.
+func (c *Client) FloatVariation(flagKey string, user *experiment.User, defaultValue float64) (float64, error) {
+	variants, err := c.variationVariants(flagKey, user)
+	if err != nil {
+		return defaultValue, err
+	}
+	return variation.Float(variants, flagKey, defaultValue)
+}
+
+// JSONVariation decodes the flag's variant for the user into target, which must be a non-nil
+// pointer. If an error is returned, defaultValue, if non-nil, is decoded into target instead.
+func (c *Client) JSONVariation(flagKey string, user *experiment.User, defaultValue interface{}, target interface{}) error {
+	variants, err := c.variationVariants(flagKey, user)
+	if err != nil {
+		return variation.JSONDefault(err, defaultValue, target)
+	}
+	return variation.JSON(variants, flagKey, defaultValue, target)
+}
+
+func (c *Client) variationVariants(flagKey string, user *experiment.User) (map[string]experiment.Variant, error) {
+	variant, err := c.EvaluateFlag(user, flagKey)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]experiment.Variant{flagKey: variant}, nil
+}
@@ -0,0 +1,49 @@
+package local
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/stretchr/testify/assert"
+)
+
+var variationFlagsStr = []byte(`[
+  {"key": "enabled", "variants": {"on": {"key": "on", "value": true}}, "segments": [{"variant": "on"}]},
+  {"key": "limit", "variants": {"on": {"key": "on", "value": "on", "payload": 25}}, "segments": [{"variant": "on"}]},
+  {"key": "ratio", "variants": {"on": {"key": "on", "value": 0.5}}, "segments": [{"variant": "on"}]},
+  {"key": "config", "variants": {"on": {"key": "on", "value": "on", "payload": {"color": "blue"}}}, "segments": [{"variant": "on"}]},
+  {"key": "off", "variants": {"off": {"key": "off", "metadata": {"default": true}}}, "segments": [{"variant": "off"}]}
+]`)
+
+func TestClientVariations(t *testing.T) {
+	client, _ := newTestClient(t, variationFlagsStr, nil)
+	user := &experiment.User{UserId: "user_id"}
+
+	enabled, err := client.BoolVariation("enabled", user, false)
+	assert.NoError(t, err)
+	assert.True(t, enabled)
+	limit, err := client.IntVariation("limit", user, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 25, limit)
+	ratio, err := client.FloatVariation("ratio", user, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, ratio)
+	var config struct{ Color string }
+	assert.NoError(t, client.JSONVariation("config", user, nil, &config))
+	assert.Equal(t, "blue", config.Color)
+
+	var variationErr *experiment.VariationError
+	value, err := client.StringVariation("off", user, "default")
+	assert.Equal(t, "default", value)
+	assert.True(t, errors.As(err, &variationErr))
+	assert.Equal(t, experiment.VariationFlagOff, variationErr.Reason)
+	value, err = client.StringVariation("missing", user, "default")
+	assert.Equal(t, "default", value)
+	assert.True(t, errors.As(err, &variationErr))
+	assert.Equal(t, experiment.VariationFlagNotFound, variationErr.Reason)
+	enabled, err = client.BoolVariation("ratio", user, true)
+	assert.True(t, enabled)
+	assert.True(t, errors.As(err, &variationErr))
+	assert.Equal(t, experiment.VariationTypeMismatch, variationErr.Reason)
+}
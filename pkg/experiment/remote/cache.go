@@ -0,0 +1,172 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amplitude/experiment-go-server/internal/cache"
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+)
+
+// variantCache caches fetched variants by user and flag keys, as configured by CacheConfig. It is
+// safe for concurrent use.
+type variantCache struct {
+	lock   sync.Mutex
+	cache  *cache.Cache
+	config CacheConfig
+	// revalidating contains the keys being fetched again in the background.
+	revalidating map[string]struct{}
+}
+
+type variantCacheEntry struct {
+	variants  map[string]experiment.Variant
+	fetchedAt time.Time
+}
+
+func newVariantCache(config *CacheConfig) *variantCache {
+	maxAge := config.TTL + max(config.StaleWhileRevalidate, config.StaleIfError)
+	return &variantCache{
+		// The cache's TTL is in milliseconds.
+		cache:        cache.NewCache(config.Capacity, time.Duration(maxAge.Milliseconds())),
+		config:       *config,
+		revalidating: make(map[string]struct{}),
+	}
+}
+
+// get returns the cached entry for the key, if any.
+func (c *variantCache) get(key string) (*variantCacheEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	value, ok := c.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return value.(*variantCacheEntry), true
+}
+
+// set caches a copy of the variants for the key.
+func (c *variantCache) set(key string, variants map[string]experiment.Variant) {
+	entry := &variantCacheEntry{variants: copyVariants(variants), fetchedAt: time.Now()}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cache.Set(key, entry)
+}
+
+// startRevalidating returns true if the key is not already being fetched again in the background,
+// in which case the caller must call doneRevalidating when done.
+func (c *variantCache) startRevalidating(key string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.revalidating[key]; ok {
+		return false
+	}
+	c.revalidating[key] = struct{}{}
+	return true
+}
+
+func (c *variantCache) doneRevalidating(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.revalidating, key)
+}
+
+// variantCacheKey returns the key of the user, given by its canonical JSON encoding, which is also
+// the encoding sent to the remote evaluation service, and the fetched flag keys.
+func variantCacheKey(userBytes []byte, fetchOptions *FetchOptions) string {
+	var sb strings.Builder
+	sb.Write(userBytes)
+	if fetchOptions != nil && len(fetchOptions.FlagKeys) > 0 {
+		flagKeys := append([]string(nil), fetchOptions.FlagKeys...)
+		sort.Strings(flagKeys)
+		for _, flagKey := range flagKeys {
+			sb.WriteString("\n")
+			sb.WriteString(flagKey)
+		}
+	}
+	return sb.String()
+}
+
+// cachedFetch fetches variants like fetch, using the cache if it is configured.
+func (c *Client) cachedFetch(ctx context.Context, user *experiment.User, fetchOptions *FetchOptions) (map[string]experiment.Variant, error) {
+	if c.cache == nil {
+		return c.fetch(ctx, user, fetchOptions)
+	}
+	addLibraryContext(user)
+	userBytes, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+	key := variantCacheKey(userBytes, fetchOptions)
+	entry, cached := c.cache.get(key)
+	var age time.Duration
+	if cached {
+		age = time.Since(entry.fetchedAt)
+	}
+	config := c.cache.config
+	if cached && (config.CacheTrackedFetches || !tracksEvents(fetchOptions)) {
+		if age < config.TTL {
+			return copyVariants(entry.variants), nil
+		}
+		if age < config.TTL+config.StaleWhileRevalidate {
+			c.revalidate(key, userBytes, fetchOptions)
+			return copyVariants(entry.variants), nil
+		}
+	}
+	variants, err := c.fetch(ctx, user, fetchOptions)
+	if err != nil {
+		if cached && age < config.TTL+config.StaleIfError {
+			c.log.Debug("serving stale variants after fetch error: %v", err)
+			return copyVariants(entry.variants), nil
+		}
+		return nil, err
+	}
+	c.cache.set(key, variants)
+	return variants, nil
+}
+
+// tracksEvents reports whether the fetch tracks assignments or exposures on the server, which would
+// be lost if the fetch were served from the cache. Fetches without options track assignments.
+func tracksEvents(fetchOptions *FetchOptions) bool {
+	return fetchOptions == nil || fetchOptions.TracksAssignment || fetchOptions.TracksExposure
+}
+
+// revalidate fetches the variants for the key again in the background, unless they are already
+// being fetched.
+func (c *Client) revalidate(key string, userBytes []byte, fetchOptions *FetchOptions) {
+	if !c.cache.startRevalidating(key) {
+		return
+	}
+	// Copy the user and options, which the caller may modify once the stale variants are returned.
+	user := &experiment.User{}
+	if err := json.Unmarshal(userBytes, user); err != nil {
+		c.cache.doneRevalidating(key)
+		return
+	}
+	var optionsCopy *FetchOptions
+	if fetchOptions != nil {
+		options := *fetchOptions
+		options.FlagKeys = append([]string(nil), fetchOptions.FlagKeys...)
+		optionsCopy = &options
+	}
+	go func() {
+		defer c.cache.doneRevalidating(key)
+		variants, err := c.fetch(context.Background(), user, optionsCopy)
+		if err != nil {
+			c.log.Debug("background fetch of stale variants failed: %v", err)
+			return
+		}
+		c.cache.set(key, variants)
+	}()
+}
+
+func copyVariants(variants map[string]experiment.Variant) map[string]experiment.Variant {
+	result := make(map[string]experiment.Variant, len(variants))
+	for key, variant := range variants {
+		result[key] = variant
+	}
+	return result
+}
@@ -0,0 +1,135 @@
+package remote
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCacheHandler responds with the variant key "v<n>" for its n-th request, or fails if failing
+// is set.
+func newTestCacheHandler(failing *atomic.Bool) http.HandlerFunc {
+	var requests int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"flag": {"key": "v` + strconv.Itoa(int(n)) + `"}}`))
+	}
+}
+
+// untrackedFetchOptions track neither assignments nor exposures, so that fetches use the cache.
+var untrackedFetchOptions = &FetchOptions{}
+
+func TestCacheFresh(t *testing.T) {
+	client, requests := newTestClient(t, &Config{CacheConfig: &CacheConfig{}}, newTestCacheHandler(&atomic.Bool{}))
+	user := &experiment.User{UserId: "user_id"}
+
+	variants, err := client.FetchV2WithOptions(user, untrackedFetchOptions)
+	require.NoError(t, err)
+	require.Equal(t, "v1", variants["flag"].Key)
+	variants["flag"] = experiment.Variant{Key: "modified"}
+	variants, err = client.FetchV2WithOptions(&experiment.User{UserId: "user_id"}, untrackedFetchOptions)
+	require.NoError(t, err)
+	require.Equal(t, "v1", variants["flag"].Key)
+	require.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+	// Other users, flag keys, and fetches which track exposures are fetched.
+	_, err = client.FetchV2WithOptions(&experiment.User{UserId: "other_user_id"}, untrackedFetchOptions)
+	require.NoError(t, err)
+	_, err = client.FetchV2WithOptions(user, &FetchOptions{FlagKeys: []string{"flag"}})
+	require.NoError(t, err)
+	_, err = client.FetchV2WithOptions(user, &FetchOptions{FlagKeys: []string{"flag"}})
+	require.NoError(t, err)
+	require.Equal(t, int32(3), atomic.LoadInt32(requests))
+	variants, err = client.FetchV2WithOptions(user, &FetchOptions{TracksExposure: true})
+	require.NoError(t, err)
+	require.Equal(t, "v4", variants["flag"].Key)
+	variants, err = client.FetchV2WithOptions(user, untrackedFetchOptions)
+	require.NoError(t, err)
+	require.Equal(t, "v4", variants["flag"].Key)
+
+	// Fetches which track assignments, as by default, are fetched.
+	variants, err = client.FetchV2(user)
+	require.NoError(t, err)
+	require.Equal(t, "v5", variants["flag"].Key)
+	variants, err = client.FetchV2WithOptions(user, &FetchOptions{TracksAssignment: true})
+	require.NoError(t, err)
+	require.Equal(t, "v6", variants["flag"].Key)
+}
+
+func TestCacheTrackedFetches(t *testing.T) {
+	client, requests := newTestClient(t, &Config{CacheConfig: &CacheConfig{CacheTrackedFetches: true}}, newTestCacheHandler(&atomic.Bool{}))
+	user := &experiment.User{UserId: "user_id"}
+
+	for i := 0; i < 3; i++ {
+		variants, err := client.FetchV2(user)
+		require.NoError(t, err)
+		require.Equal(t, "v1", variants["flag"].Key)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(requests))
+	variants, err := client.FetchV2WithOptions(user, &FetchOptions{TracksAssignment: true, TracksExposure: true})
+	require.NoError(t, err)
+	require.Equal(t, "v1", variants["flag"].Key)
+	require.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+	// The variation helpers fetch a single flag, which is cached separately.
+	for i := 0; i < 3; i++ {
+		_, _ = client.StringVariation("flag", user, "")
+	}
+	require.Equal(t, int32(2), atomic.LoadInt32(requests))
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	client, requests := newTestClient(t, &Config{
+		CacheConfig: &CacheConfig{TTL: 20 * time.Millisecond, StaleWhileRevalidate: time.Minute},
+	}, newTestCacheHandler(&atomic.Bool{}))
+	user := &experiment.User{UserId: "user_id"}
+	_, err := client.FetchV2WithOptions(user, untrackedFetchOptions)
+	require.NoError(t, err)
+	time.Sleep(30 * time.Millisecond)
+
+	variants, err := client.FetchV2WithOptions(user, untrackedFetchOptions)
+	require.NoError(t, err)
+	require.Equal(t, "v1", variants["flag"].Key)
+	require.Eventually(t, func() bool {
+		variants, err := client.FetchV2WithOptions(user, untrackedFetchOptions)
+		return err == nil && variants["flag"].Key == "v2"
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, int32(2), atomic.LoadInt32(requests))
+}
+
+func TestCacheStaleIfError(t *testing.T) {
+	var failing atomic.Bool
+	client, _ := newTestClient(t, &Config{
+		CacheConfig: &CacheConfig{TTL: 10 * time.Millisecond, StaleIfError: time.Minute},
+	}, newTestCacheHandler(&failing))
+	user := &experiment.User{UserId: "user_id"}
+	_, err := client.FetchV2WithOptions(user, untrackedFetchOptions)
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+
+	failing.Store(true)
+	variants, err := client.FetchV2WithOptions(user, untrackedFetchOptions)
+	require.NoError(t, err)
+	require.Equal(t, "v1", variants["flag"].Key)
+	_, err = client.FetchV2WithOptions(&experiment.User{UserId: "other_user_id"}, untrackedFetchOptions)
+	require.Error(t, err)
+
+	failing.Store(false)
+	client, _ = newTestClient(t, &Config{CacheConfig: &CacheConfig{TTL: 10 * time.Millisecond}}, newTestCacheHandler(&failing))
+	_, err = client.FetchV2WithOptions(user, untrackedFetchOptions)
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	failing.Store(true)
+	_, err = client.FetchV2WithOptions(user, untrackedFetchOptions)
+	require.Error(t, err)
+}
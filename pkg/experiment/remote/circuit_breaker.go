@@ -0,0 +1,176 @@
+package remote
+
+import (
+	"sync"
+	"time"
+
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreakerBuckets is the number of buckets the failure rate window is divided into. Requests
+// leave the window one bucket at a time.
+const circuitBreakerBuckets = 10
+
+type circuitBreakerBucket struct {
+	// index is the number of bucket widths since the epoch at which the bucket starts.
+	index    int64
+	requests int
+	failures int
+}
+
+// circuitBreaker implements CircuitBreakerConfig. It is safe for concurrent use.
+type circuitBreaker struct {
+	lock   sync.Mutex
+	config CircuitBreakerConfig
+	log    *logger.Logger
+	now    func() time.Time
+
+	state    circuitState
+	openedAt time.Time
+	// generation is incremented on each state change, so that requests allowed in a previous state
+	// are not counted in the current state.
+	generation          uint64
+	consecutiveFailures int
+	buckets             [circuitBreakerBuckets]circuitBreakerBucket
+	// probes is the number of probes in flight, and probeSuccesses the number which have succeeded,
+	// while the circuit is half-open.
+	probes         int
+	probeSuccesses int
+}
+
+func newCircuitBreaker(config *CircuitBreakerConfig, log *logger.Logger) *circuitBreaker {
+	return &circuitBreaker{config: *config, log: log, now: time.Now}
+}
+
+// allow returns true if a request may be sent, in which case the caller must call done with the
+// returned generation once the request completes.
+func (b *circuitBreaker) allow() (uint64, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if b.now().Sub(b.openedAt) < b.config.OpenDuration {
+			return 0, false
+		}
+		b.setState(circuitHalfOpen)
+		b.probes = 0
+		b.probeSuccesses = 0
+		fallthrough
+	case circuitHalfOpen:
+		if b.probes+b.probeSuccesses >= b.config.HalfOpenProbes {
+			return 0, false
+		}
+		b.probes++
+	}
+	return b.generation, true
+}
+
+// done records the outcome of a request allowed in the generation. Requests which were canceled by
+// the caller are neither successes nor failures.
+func (b *circuitBreaker) done(generation uint64, failed bool, canceled bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if generation != b.generation {
+		return
+	}
+	switch b.state {
+	case circuitClosed:
+		if canceled {
+			return
+		}
+		b.count(failed)
+		if failed {
+			b.consecutiveFailures++
+		} else {
+			b.consecutiveFailures = 0
+		}
+		if b.consecutiveFailures >= b.config.ConsecutiveFailures {
+			b.log.Warn("circuit breaker opened after %v consecutive failed fetches", b.consecutiveFailures)
+			b.open()
+		} else if requests, failures := b.window(); requests >= b.config.MinimumRequests &&
+			float64(failures) >= b.config.FailureRate*float64(requests) {
+			b.log.Warn("circuit breaker opened after %v of %v fetches failed", failures, requests)
+			b.open()
+		}
+	case circuitHalfOpen:
+		b.probes--
+		switch {
+		case canceled:
+		case failed:
+			b.log.Warn("circuit breaker opened again after a failed probe")
+			b.open()
+		default:
+			b.probeSuccesses++
+			if b.probeSuccesses >= b.config.HalfOpenProbes {
+				b.log.Info("circuit breaker closed after %v successful probes", b.probeSuccesses)
+				b.setState(circuitClosed)
+				b.consecutiveFailures = 0
+				b.buckets = [circuitBreakerBuckets]circuitBreakerBucket{}
+			}
+		}
+	}
+}
+
+func (b *circuitBreaker) open() {
+	b.setState(circuitOpen)
+	b.openedAt = b.now()
+}
+
+func (b *circuitBreaker) setState(state circuitState) {
+	b.log.Debug("circuit breaker state: %v -> %v", b.state, state)
+	b.state = state
+	b.generation++
+}
+
+// bucketIndex returns the index of the current bucket.
+func (b *circuitBreaker) bucketIndex() int64 {
+	width := int64(b.config.Window / circuitBreakerBuckets)
+	if width <= 0 {
+		width = 1
+	}
+	return b.now().UnixNano() / width
+}
+
+// count adds a request to the current bucket, resetting it if it was last used in a previous window.
+func (b *circuitBreaker) count(failed bool) {
+	index := b.bucketIndex()
+	bucket := &b.buckets[index%circuitBreakerBuckets]
+	if bucket.index != index {
+		*bucket = circuitBreakerBucket{index: index}
+	}
+	bucket.requests++
+	if failed {
+		bucket.failures++
+	}
+}
+
+// window returns the number of requests and failures in the current window.
+func (b *circuitBreaker) window() (requests int, failures int) {
+	index := b.bucketIndex()
+	for _, bucket := range b.buckets {
+		if bucket.index > index-circuitBreakerBuckets {
+			requests += bucket.requests
+			failures += bucket.failures
+		}
+	}
+	return requests, failures
+}
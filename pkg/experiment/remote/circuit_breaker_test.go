@@ -0,0 +1,178 @@
+package remote
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/amplitude/experiment-go-server/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func newTestCircuitBreaker(config *CircuitBreakerConfig) (*circuitBreaker, *testClock) {
+	clock := &testClock{now: time.Unix(1700000000, 0)}
+	breaker := newCircuitBreaker(fillCircuitBreakerConfigDefaults(config), logger.New(logger.Disable, logger.NewDefault()))
+	breaker.now = clock.Now
+	return breaker, clock
+}
+
+// request sends a request through the breaker which fails if failed is set, and returns false if
+// the request was not allowed.
+func request(breaker *circuitBreaker, failed bool) bool {
+	generation, ok := breaker.allow()
+	if !ok {
+		return false
+	}
+	breaker.done(generation, failed, false)
+	return true
+}
+
+func TestCircuitBreakerConsecutiveFailures(t *testing.T) {
+	breaker, clock := newTestCircuitBreaker(&CircuitBreakerConfig{ConsecutiveFailures: 3, OpenDuration: time.Second})
+	require.True(t, request(breaker, true))
+	require.True(t, request(breaker, true))
+	require.True(t, request(breaker, false))
+	require.True(t, request(breaker, true))
+	require.True(t, request(breaker, true))
+	require.Equal(t, circuitClosed, breaker.state)
+	require.True(t, request(breaker, true))
+	require.Equal(t, circuitOpen, breaker.state)
+	require.False(t, request(breaker, false))
+
+	clock.now = clock.now.Add(time.Second)
+	require.True(t, request(breaker, false))
+	require.Equal(t, circuitClosed, breaker.state)
+	require.True(t, request(breaker, true))
+	require.Equal(t, circuitClosed, breaker.state)
+}
+
+func TestCircuitBreakerFailureRate(t *testing.T) {
+	breaker, clock := newTestCircuitBreaker(&CircuitBreakerConfig{
+		ConsecutiveFailures: 100,
+		FailureRate:         0.5,
+		MinimumRequests:     10,
+		Window:              10 * time.Second,
+	})
+	// Failures which have left the window are not counted.
+	for i := 0; i < 5; i++ {
+		require.True(t, request(breaker, true))
+	}
+	clock.now = clock.now.Add(10 * time.Second)
+	for i := 0; i < 5; i++ {
+		require.True(t, request(breaker, true))
+		require.True(t, request(breaker, false))
+		require.True(t, request(breaker, false))
+	}
+	require.Equal(t, circuitClosed, breaker.state)
+	// Below the minimum number of requests, the failure rate is not considered.
+	clock.now = clock.now.Add(10 * time.Second)
+	for i := 0; i < 4; i++ {
+		require.True(t, request(breaker, true))
+		require.True(t, request(breaker, false))
+	}
+	require.Equal(t, circuitClosed, breaker.state)
+	clock.now = clock.now.Add(time.Second)
+	require.True(t, request(breaker, false))
+	require.True(t, request(breaker, true))
+	require.Equal(t, circuitOpen, breaker.state)
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	breaker, clock := newTestCircuitBreaker(&CircuitBreakerConfig{
+		ConsecutiveFailures: 1,
+		OpenDuration:        time.Second,
+		HalfOpenProbes:      2,
+	})
+	require.True(t, request(breaker, true))
+	clock.now = clock.now.Add(time.Second)
+
+	// Up to HalfOpenProbes probes are sent concurrently.
+	first, ok := breaker.allow()
+	require.True(t, ok)
+	second, ok := breaker.allow()
+	require.True(t, ok)
+	_, ok = breaker.allow()
+	require.False(t, ok)
+	require.Equal(t, circuitHalfOpen, breaker.state)
+
+	// A canceled probe frees its place, and a failed probe opens the circuit again.
+	breaker.done(first, false, true)
+	third, ok := breaker.allow()
+	require.True(t, ok)
+	breaker.done(second, false, false)
+	breaker.done(third, true, false)
+	require.Equal(t, circuitOpen, breaker.state)
+	_, ok = breaker.allow()
+	require.False(t, ok)
+
+	clock.now = clock.now.Add(time.Second)
+	require.True(t, request(breaker, false))
+	require.Equal(t, circuitHalfOpen, breaker.state)
+	require.True(t, request(breaker, false))
+	require.Equal(t, circuitClosed, breaker.state)
+}
+
+func TestCircuitBreakerStaleGeneration(t *testing.T) {
+	breaker, clock := newTestCircuitBreaker(&CircuitBreakerConfig{ConsecutiveFailures: 1, OpenDuration: time.Second})
+	slow, ok := breaker.allow()
+	require.True(t, ok)
+	require.True(t, request(breaker, true))
+	clock.now = clock.now.Add(time.Second)
+	probe, ok := breaker.allow()
+	require.True(t, ok)
+	// A request allowed before the circuit opened does not count as a probe.
+	breaker.done(slow, false, false)
+	require.Equal(t, circuitHalfOpen, breaker.state)
+	breaker.done(probe, false, false)
+	require.Equal(t, circuitClosed, breaker.state)
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	client, requests := newTestClient(t, &Config{
+		RetryBackoff:         &RetryBackoff{FetchRetries: 5, FetchRetryTimeout: time.Second},
+		CircuitBreakerConfig: &CircuitBreakerConfig{ConsecutiveFailures: 3, OpenDuration: 50 * time.Millisecond},
+	}, func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"flag": {"key": "on"}}`))
+	})
+	user := &experiment.User{UserId: "user_id"}
+
+	// Retries stop once the circuit opens.
+	_, err := client.FetchV2(user)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.Equal(t, int32(3), atomic.LoadInt32(requests))
+	_, err = client.FetchV2(user)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.Equal(t, int32(3), atomic.LoadInt32(requests))
+
+	// Fetches canceled by the caller are not failures.
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.FetchV2WithContext(user, ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, circuitHalfOpen, client.breaker.state)
+
+	failing.Store(false)
+	variants, err := client.FetchV2(user)
+	require.NoError(t, err)
+	require.Equal(t, "on", variants["flag"].Key)
+	require.Equal(t, circuitClosed, client.breaker.state)
+}
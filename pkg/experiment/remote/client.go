@@ -4,8 +4,8 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
 	"math/rand"
 	"net/http"
 	"net/url"
@@ -13,6 +13,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/amplitude/experiment-go-server/internal/hook"
 	"github.com/amplitude/experiment-go-server/pkg/experiment"
 
 	"github.com/amplitude/experiment-go-server/pkg/logger"
@@ -22,10 +23,12 @@ var clients = map[string]*Client{}
 var initMutex = sync.Mutex{}
 
 type Client struct {
-	log    *logger.Logger
-	apiKey string
-	config *Config
-	client *http.Client
+	log     *logger.Logger
+	apiKey  string
+	config  *Config
+	client  *http.Client
+	cache   *variantCache
+	breaker *circuitBreaker
 }
 
 func Initialize(apiKey string, config *Config) *Client {
@@ -35,20 +38,32 @@ func Initialize(apiKey string, config *Config) *Client {
 		if apiKey == "" {
 			panic("api key must be set")
 		}
-		config = fillConfigDefaults(config)
-		client = &Client{
-			log:    logger.New(config.LogLevel, config.LoggerProvider),
-			apiKey: apiKey,
-			config: config,
-			client: &http.Client{},
-		}
-		client.log.Debug("config: %v", *config)
+		client = newClient(apiKey, config, &http.Client{})
+		client.log.Debug("config: %v", *client.config)
 		clients[apiKey] = client
 	}
 	initMutex.Unlock()
 	return client
 }
 
+// newClient returns a client with the config, which sends requests with the http client.
+func newClient(apiKey string, config *Config, httpClient *http.Client) *Client {
+	config = fillConfigDefaults(config)
+	client := &Client{
+		log:    logger.New(config.LogLevel, config.LoggerProvider),
+		apiKey: apiKey,
+		config: config,
+		client: httpClient,
+	}
+	if config.CacheConfig != nil {
+		client.cache = newVariantCache(config.CacheConfig)
+	}
+	if config.CircuitBreakerConfig != nil {
+		client.breaker = newCircuitBreaker(config.CircuitBreakerConfig, client.log)
+	}
+	return client
+}
+
 // Deprecated: Use FetchV2
 func (c *Client) Fetch(user *experiment.User) (map[string]experiment.Variant, error) {
 	variants, err := c.FetchV2(user)
@@ -77,17 +92,66 @@ func (c *Client) FetchV2WithOptions(user *experiment.User, fetchOptions *FetchOp
 	return c.FetchV2WithContextAndOptions(user, ctx, fetchOptions)
 }
 
+// EvaluateWithContext fetches variants for a user from the remote evaluation service, implementing
+// experiment.Evaluator. Assignments are tracked as with DefaultFetchOptions, and exposures are
+// tracked if options.TracksExposure is set.
+func (c *Client) EvaluateWithContext(ctx context.Context, user *experiment.User, options *experiment.EvaluateOptions) (map[string]experiment.Variant, error) {
+	if options == nil {
+		options = &experiment.EvaluateOptions{}
+	}
+	return c.FetchV2WithContextAndOptions(user, ctx, &FetchOptions{
+		TracksAssignment: DefaultFetchOptions.TracksAssignment,
+		TracksExposure:   options.TracksExposure,
+		FlagKeys:         options.FlagKeys,
+	})
+}
+
 // FetchV2WithContextAndOptions fetches variants for a user from the remote evaluation service with a context and options.
 func (c *Client) FetchV2WithContextAndOptions(user *experiment.User, ctx context.Context, fetchOptions *FetchOptions) (map[string]experiment.Variant, error) {
-	variants, err := c.doFetch(ctx, user, c.config.FetchTimeout, fetchOptions)
+	user = hook.Before(ctx, c.log, c.config.Hooks, user)
+	variants, err := c.cachedFetch(ctx, user, fetchOptions)
+	hook.After(ctx, c.log, c.config.Hooks, user, variants, err)
 	if err != nil {
-		c.log.Error("fetch error: %v", err)
-		if c.config.RetryBackoff.FetchRetries > 0 && shouldRetryFetch(err) {
-			return c.retryFetch(ctx, user, fetchOptions)
-		} else {
-			return nil, err
+		return nil, err
+	}
+	return variants, nil
+}
+
+func (c *Client) fetch(ctx context.Context, user *experiment.User, fetchOptions *FetchOptions) (map[string]experiment.Variant, error) {
+	variants, err := c.attemptFetch(ctx, user, c.config.FetchTimeout, fetchOptions, 1)
+	if err == nil {
+		return variants, nil
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		c.log.Debug("fetch error: %v", err)
+		return nil, err
+	}
+	c.log.Error("fetch error: %v", err)
+	if c.config.RetryBackoff.FetchRetries > 0 && shouldRetryFetch(ctx, err) {
+		return c.retryFetch(ctx, user, fetchOptions, err)
+	}
+	return nil, err
+}
+
+// attemptFetch sends a fetch request through the circuit breaker, if it is configured. The attempt
+// is the number of the request, starting at 1, which is set on the returned
+// *experiment.RequestError.
+func (c *Client) attemptFetch(ctx context.Context, user *experiment.User, timeout time.Duration, fetchOptions *FetchOptions, attempt int) (map[string]experiment.Variant, error) {
+	var generation uint64
+	if c.breaker != nil {
+		var ok bool
+		if generation, ok = c.breaker.allow(); !ok {
+			return nil, ErrCircuitOpen
 		}
 	}
+	variants, err := c.doFetch(ctx, user, timeout, fetchOptions)
+	var requestErr *experiment.RequestError
+	if errors.As(err, &requestErr) {
+		requestErr.Attempt = attempt
+	}
+	if c.breaker != nil {
+		c.breaker.done(generation, err != nil && shouldRetryFetch(ctx, err), ctx.Err() != nil)
+	}
 	return variants, err
 }
 
@@ -98,6 +162,7 @@ func (c *Client) doFetch(ctx context.Context, user *experiment.User, timeout tim
 		return nil, err
 	}
 	endpoint.Path = path.Join(endpoint.Path, "sdk/v2/vardata")
+	endpointUrl := endpoint.String()
 	if c.config.Debug {
 		endpoint.RawQuery = fmt.Sprintf("d=%s", randStringRunes(5))
 	}
@@ -106,9 +171,9 @@ func (c *Client) doFetch(ctx context.Context, user *experiment.User, timeout tim
 		return nil, err
 	}
 	c.log.Debug("fetch variants for user %s", string(jsonBytes))
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	requestCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, "GET", endpoint.String(), nil)
+	req, err := http.NewRequestWithContext(requestCtx, "GET", endpoint.String(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -126,42 +191,36 @@ func (c *Client) doFetch(ctx context.Context, user *experiment.User, timeout tim
 		} else {
 			req.Header.Set("X-Amp-Exp-Exposure-Track", "no-track")
 		}
+		if len(fetchOptions.FlagKeys) > 0 {
+			flagKeysBytes, err := json.Marshal(fetchOptions.FlagKeys)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("X-Amp-Exp-Flag-Keys", base64.StdEncoding.EncodeToString(flagKeysBytes))
+		}
 	}
 	c.log.Debug("fetch request: %v", req)
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return nil, err
+		// Requests which fail because the caller's context is done are not retried, but requests
+		// which time out are.
+		return nil, &experiment.RequestError{Endpoint: endpointUrl, Retryable: ctx.Err() == nil, Err: err}
 	}
 	defer resp.Body.Close()
 	c.log.Debug("fetch response: %v", *resp)
 	if resp.StatusCode != http.StatusOK {
-		return nil, &fetchError{StatusCode: resp.StatusCode, Message: resp.Status}
-	}
-	return c.parseResponse(resp)
-}
-
-func (c *Client) retryFetch(ctx context.Context, user *experiment.User, fetchOptions *FetchOptions) (map[string]experiment.Variant, error) {
-	var err error
-	var variants map[string]experiment.Variant
-	var timer *time.Timer
-	delay := c.config.RetryBackoff.FetchRetryBackoffMin
-	for i := 0; i < c.config.RetryBackoff.FetchRetries; i++ {
-		c.log.Debug("retry attempt %v", i)
-		timer = time.NewTimer(delay)
-		<-timer.C
-		variants, err = c.doFetch(ctx, user, c.config.RetryBackoff.FetchRetryTimeout, fetchOptions)
-		if err == nil && variants != nil {
-			c.log.Debug("retry attempt %v success", i)
-			return variants, nil
+		return nil, &experiment.RequestError{
+			StatusCode: resp.StatusCode,
+			Endpoint:   endpointUrl,
+			Retryable:  experiment.IsRetryableStatus(resp.StatusCode),
+			RetryAfter: retryAfter(resp),
 		}
-		c.log.Debug("retry attempt %v error: %v", i, err)
-		delay = time.Duration(math.Min(
-			float64(delay)*c.config.RetryBackoff.FetchRetryBackoffScalar,
-			float64(c.config.RetryBackoff.FetchRetryBackoffMax)),
-		)
 	}
-	c.log.Error("fetch retries failed after %v attempts: %v", c.config.RetryBackoff.FetchRetries, err)
-	return nil, err
+	variants, err := c.parseResponse(resp)
+	if err != nil {
+		return nil, &experiment.RequestError{StatusCode: resp.StatusCode, Endpoint: endpointUrl, Retryable: ctx.Err() == nil, Err: err}
+	}
+	return variants, nil
 }
 
 func (c *Client) parseResponse(resp *http.Response) (map[string]experiment.Variant, error) {
@@ -192,13 +251,6 @@ func randStringRunes(n int) string {
 	return string(b)
 }
 
-func shouldRetryFetch(err error) bool {
-	if err, ok := err.(*fetchError); ok {
-		return err.StatusCode < 400 || err.StatusCode >= 500 || err.StatusCode == 429
-	}
-	return true
-}
-
 func filterDefaultVariants(variants map[string]experiment.Variant) map[string]experiment.Variant {
 	results := make(map[string]experiment.Variant)
 	for key, variant := range variants {
@@ -0,0 +1,60 @@
+package remote
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/stretchr/testify/require"
+)
+
+// testFetchHook sets the country of each user and records the fetched variants.
+type testFetchHook struct {
+	variants []map[string]experiment.Variant
+	errors   []error
+}
+
+func (h *testFetchHook) BeforeEvaluate(user *experiment.User) *experiment.User {
+	user.Country = "US"
+	return user
+}
+
+func (h *testFetchHook) AfterEvaluate(_ *experiment.User, variants map[string]experiment.Variant, err error) {
+	h.variants = append(h.variants, variants)
+	h.errors = append(h.errors, err)
+	if variants != nil {
+		variants["override"] = experiment.Variant{Key: "on", Value: "on"}
+	}
+}
+
+func TestClientHooks(t *testing.T) {
+	hook := &testFetchHook{}
+	var failing atomic.Bool
+	client, _ := newTestClient(t, &Config{Hooks: []experiment.Hook{hook}}, func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		userJson, _ := base64.StdEncoding.DecodeString(r.Header.Get("X-Amp-Exp-User"))
+		var user experiment.User
+		_ = json.Unmarshal(userJson, &user)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"country": {"key": "` + user.Country + `"}}`))
+	})
+
+	variants, err := client.FetchV2(&experiment.User{UserId: "user_id"})
+	require.NoError(t, err)
+	require.Equal(t, "US", variants["country"].Key)
+	require.Equal(t, "on", variants["override"].Key)
+
+	failing.Store(true)
+	variants, err = client.FetchV2(&experiment.User{UserId: "user_id"})
+	require.Error(t, err)
+	require.Nil(t, variants)
+	require.Equal(t, 2, len(hook.errors))
+	require.NoError(t, hook.errors[0])
+	require.Equal(t, err, hook.errors[1])
+}
@@ -1,9 +1,12 @@
 package remote
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -12,6 +15,32 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// newTestClient returns a client with the config for a server which responds to each request with
+// the handler, and counts the requests to it. Retries are disabled unless the config sets a
+// RetryBackoff.
+func newTestClient(t *testing.T, config *Config, handler http.HandlerFunc) (*Client, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	if config == nil {
+		config = &Config{}
+	}
+	config.ServerUrl = server.URL
+	if config.LogLevel == logger.Unknown {
+		config.LogLevel = logger.Disable
+	}
+	if config.LoggerProvider == nil {
+		config.LoggerProvider = logger.NewDefault()
+	}
+	if config.RetryBackoff == nil {
+		config.RetryBackoff = &RetryBackoff{}
+	}
+	return newClient("apiKey", config, server.Client()), &requests
+}
+
 func TestClient_Fetch_DoesNotReturnDefaultVariants(t *testing.T) {
 	client := Initialize("server-qz35UwzJ5akieoAdIgzM4m9MIiOLXLoz", nil)
 	user := &experiment.User{}
@@ -155,3 +184,23 @@ func TestClient_FetchV2WithOptions(t *testing.T) {
 		server.Close()
 	}
 }
+
+func TestClient_EvaluateWithContext(t *testing.T) {
+	client, _ := newTestClient(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "track", r.Header.Get("X-Amp-Exp-Track"))
+		require.Equal(t, "track", r.Header.Get("X-Amp-Exp-Exposure-Track"))
+		flagKeys, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Amp-Exp-Flag-Keys"))
+		require.NoError(t, err)
+		require.Equal(t, `["flag-1","flag-2"]`, string(flagKeys))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"flag-1": {"key": "on", "value": "on"}}`))
+	})
+
+	var evaluator experiment.Evaluator = client
+	variants, err := evaluator.EvaluateWithContext(context.Background(), &experiment.User{UserId: "test_user"}, &experiment.EvaluateOptions{
+		FlagKeys:       []string{"flag-1", "flag-2"},
+		TracksExposure: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]experiment.Variant{"flag-1": {Key: "on", Value: "on"}}, variants)
+}
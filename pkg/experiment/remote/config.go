@@ -3,6 +3,7 @@ package remote
 import (
 	"time"
 
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
 	"github.com/amplitude/experiment-go-server/pkg/logger"
 )
 
@@ -13,6 +14,9 @@ type Config struct {
 	ServerUrl    		string
 	FetchTimeout 		time.Duration
 	RetryBackoff 		*RetryBackoff
+	Hooks        		[]experiment.Hook
+	CacheConfig  		*CacheConfig
+	CircuitBreakerConfig	*CircuitBreakerConfig
 }
 
 var DefaultConfig = &Config{
@@ -30,6 +34,7 @@ type RetryBackoff struct {
 	FetchRetryBackoffMax    time.Duration
 	FetchRetryBackoffScalar float64
 	FetchRetryTimeout       time.Duration
+	FetchRetryJitter        RetryJitter
 }
 
 var DefaultRetryBackoff = &RetryBackoff{
@@ -40,6 +45,88 @@ var DefaultRetryBackoff = &RetryBackoff{
 	FetchRetryTimeout:       500 * time.Millisecond,
 }
 
+// RetryJitter is how the delays between fetch retries are randomized, which spreads out the retries
+// of clients whose fetches failed at the same time.
+type RetryJitter int
+
+const (
+	// NoJitter waits FetchRetryBackoffMin before the first retry, multiplied by
+	// FetchRetryBackoffScalar after each retry, up to FetchRetryBackoffMax.
+	NoJitter RetryJitter = iota
+	// FullJitter waits a random delay between zero and the delay NoJitter would wait.
+	FullJitter
+	// DecorrelatedJitter waits a random delay between FetchRetryBackoffMin and three times the
+	// previous delay, up to FetchRetryBackoffMax. FetchRetryBackoffMin must be positive.
+	DecorrelatedJitter
+)
+
+// CacheConfig is the configuration of the remote client's cache of fetched variants, keyed by the
+// user and the fetched flag keys, so that repeated fetches for the same user within a short time
+// do not each call the remote evaluation service.
+//
+// Fetches which track assignments or exposures are sent to the service, so that the events are
+// tracked, and their variants are cached. This includes fetches without options or with
+// DefaultFetchOptions, which track assignments; set FetchOptions.TracksAssignment to false, or set
+// CacheTrackedFetches, for fetches to be served from the cache.
+// Cached variants are returned in a new map on each fetch, but their Payload and Metadata are shared
+// and must not be modified.
+type CacheConfig struct {
+	// Capacity is the maximum number of cached users. The least recently used are evicted first.
+	Capacity int
+	// TTL is how long fetched variants are fresh and returned without a fetch.
+	TTL time.Duration
+	// StaleWhileRevalidate is how long after the TTL has passed stale variants are still returned,
+	// while they are fetched again in the background. Zero disables revalidation in the background.
+	StaleWhileRevalidate time.Duration
+	// StaleIfError is how long after the TTL has passed stale variants are returned if a fetch
+	// fails. Zero disables serving stale variants on error.
+	StaleIfError time.Duration
+	// CacheTrackedFetches serves fetches which track assignments or exposures from the cache as
+	// well. Their assignments and exposures are then only tracked when the variants are fetched
+	// from the service, not for fetches served from the cache.
+	CacheTrackedFetches bool
+}
+
+var DefaultCacheConfig = &CacheConfig{
+	Capacity: 10000,
+	TTL:      time.Minute,
+}
+
+// CircuitBreakerConfig is the configuration of the remote client's circuit breaker, which stops
+// fetching from the remote evaluation service while it is failing, so that fetches fail fast with
+// ErrCircuitOpen instead of waiting for timeouts and retries.
+//
+// Each request to the service, including each retry, counts towards the thresholds. Requests fail
+// if they time out, cannot be sent, or receive a 429 or 5xx response; requests canceled by the
+// caller's context are not counted. Once either threshold is reached the circuit opens, and after
+// OpenDuration it lets probe requests through to decide whether to close again.
+type CircuitBreakerConfig struct {
+	// ConsecutiveFailures is the number of consecutive failed requests which opens the circuit.
+	ConsecutiveFailures int
+	// FailureRate is the ratio of failed requests, between 0 and 1, over the last Window which
+	// opens the circuit, once at least MinimumRequests have been sent in the window.
+	FailureRate float64
+	// MinimumRequests is the number of requests in the window below which the failure rate is not
+	// considered.
+	MinimumRequests int
+	// Window is the period over which the failure rate is measured.
+	Window time.Duration
+	// OpenDuration is how long the circuit stays open before probe requests are sent.
+	OpenDuration time.Duration
+	// HalfOpenProbes is the number of probe requests which must succeed to close the circuit. Up to
+	// this many probes are sent concurrently, and any failed probe opens the circuit again.
+	HalfOpenProbes int
+}
+
+var DefaultCircuitBreakerConfig = &CircuitBreakerConfig{
+	ConsecutiveFailures: 5,
+	FailureRate:         0.5,
+	MinimumRequests:     20,
+	Window:              10 * time.Second,
+	OpenDuration:        10 * time.Second,
+	HalfOpenProbes:      1,
+}
+
 func fillConfigDefaults(c *Config) *Config {
 	if c == nil {
 		return DefaultConfig
@@ -53,6 +140,12 @@ func fillConfigDefaults(c *Config) *Config {
 	if c.RetryBackoff == nil {
 		c.RetryBackoff = DefaultConfig.RetryBackoff
 	}
+	if c.CacheConfig != nil {
+		c.CacheConfig = fillCacheConfigDefaults(c.CacheConfig)
+	}
+	if c.CircuitBreakerConfig != nil {
+		c.CircuitBreakerConfig = fillCircuitBreakerConfigDefaults(c.CircuitBreakerConfig)
+	}
 	if c.LogLevel == logger.Unknown {
 		if c.Debug {
 			c.LogLevel = logger.Debug
@@ -62,3 +155,35 @@ func fillConfigDefaults(c *Config) *Config {
 	}
 	return c
 }
+
+func fillCacheConfigDefaults(c *CacheConfig) *CacheConfig {
+	if c.Capacity <= 0 {
+		c.Capacity = DefaultCacheConfig.Capacity
+	}
+	if c.TTL <= 0 {
+		c.TTL = DefaultCacheConfig.TTL
+	}
+	return c
+}
+
+func fillCircuitBreakerConfigDefaults(c *CircuitBreakerConfig) *CircuitBreakerConfig {
+	if c.ConsecutiveFailures <= 0 {
+		c.ConsecutiveFailures = DefaultCircuitBreakerConfig.ConsecutiveFailures
+	}
+	if c.FailureRate <= 0 || c.FailureRate > 1 {
+		c.FailureRate = DefaultCircuitBreakerConfig.FailureRate
+	}
+	if c.MinimumRequests <= 0 {
+		c.MinimumRequests = DefaultCircuitBreakerConfig.MinimumRequests
+	}
+	if c.Window <= 0 {
+		c.Window = DefaultCircuitBreakerConfig.Window
+	}
+	if c.OpenDuration <= 0 {
+		c.OpenDuration = DefaultCircuitBreakerConfig.OpenDuration
+	}
+	if c.HalfOpenProbes <= 0 {
+		c.HalfOpenProbes = DefaultCircuitBreakerConfig.HalfOpenProbes
+	}
+	return c
+}
@@ -1,12 +1,7 @@
 package remote
 
-import "fmt"
+import "errors"
 
-type fetchError struct {
-	StatusCode int
-	Message    string
-}
-
-func (e *fetchError) Error() string {
-	return fmt.Sprintf("message: %s", e.Message)
-}
+// ErrCircuitOpen is returned by fetches while the circuit breaker configured by
+// CircuitBreakerConfig is open, without a request being sent.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
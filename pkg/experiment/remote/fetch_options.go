@@ -7,6 +7,8 @@ type FetchOptions struct {
 	// TracksExposure indicates whether to track exposure event for the fetch.
 	// Default is false, which means the exposure event will not be tracked.
 	TracksExposure   bool
+	// FlagKeys are the flags to fetch variants for. If nil or empty, all flags are fetched.
+	FlagKeys         []string
 }
 
 var DefaultFetchOptions = &FetchOptions{
@@ -0,0 +1,159 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+)
+
+// retryFetch retries a fetch which failed with the error, as configured by RetryBackoff. Retries
+// stop as soon as the context is done, if its deadline would pass before the next retry, or if a
+// Retry-After header requests a longer delay than FetchRetryBackoffMax. The returned error is the
+// *experiment.RequestError of the last request sent, whose Attempt is the number of requests.
+func (c *Client) retryFetch(ctx context.Context, user *experiment.User, fetchOptions *FetchOptions, err error) (map[string]experiment.Variant, error) {
+	backoff := c.config.RetryBackoff
+	attempts := 1
+	delay := backoff.FetchRetryBackoffMin
+	sleep := delay
+	for i := 0; i < backoff.FetchRetries; i++ {
+		sleep = backoff.retryDelay(delay, sleep)
+		var requestErr *experiment.RequestError
+		if errors.As(err, &requestErr) && requestErr.RetryAfter > 0 {
+			if requestErr.RetryAfter > backoff.FetchRetryBackoffMax {
+				c.log.Debug("retry after %v exceeds the maximum backoff", requestErr.RetryAfter)
+				break
+			}
+			sleep = time.Duration(math.Max(float64(sleep), float64(requestErr.RetryAfter)))
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < sleep {
+			c.log.Debug("retry attempt %v would exceed the context deadline", i)
+			break
+		}
+		c.log.Debug("retry attempt %v in %v", i, sleep)
+		if ctxErr := sleepContext(ctx, sleep); ctxErr != nil {
+			err = stoppedRetrying(err, ctxErr)
+			break
+		}
+		variants, fetchErr := c.attemptFetch(ctx, user, backoff.FetchRetryTimeout, fetchOptions, attempts+1)
+		if errors.Is(fetchErr, ErrCircuitOpen) {
+			err = stoppedRetrying(err, fetchErr)
+			break
+		}
+		err = fetchErr
+		attempts++
+		if err == nil {
+			c.log.Debug("retry attempt %v success", i)
+			return variants, nil
+		}
+		c.log.Debug("retry attempt %v error: %v", i, err)
+		if !shouldRetryFetch(ctx, err) {
+			break
+		}
+		delay = time.Duration(math.Min(
+			float64(delay)*backoff.FetchRetryBackoffScalar,
+			float64(backoff.FetchRetryBackoffMax)),
+		)
+	}
+	c.log.Error("fetch failed after %v attempts: %v", attempts, err)
+	return nil, err
+}
+
+// stoppedRetrying returns the error of the last request, with the cause of retries stopping before
+// the next request was sent, such as the context being done.
+func stoppedRetrying(err error, cause error) error {
+	var requestErr *experiment.RequestError
+	if !errors.As(err, &requestErr) {
+		return cause
+	}
+	stopped := *requestErr
+	stopped.Err = cause
+	return &stopped
+}
+
+// retryDelay returns the delay before a retry, given the exponential backoff delay of the retry
+// and the delay before the previous retry, which is FetchRetryBackoffMin before the first retry.
+func (b *RetryBackoff) retryDelay(delay time.Duration, previous time.Duration) time.Duration {
+	switch b.FetchRetryJitter {
+	case FullJitter:
+		return randomDuration(0, delay)
+	case DecorrelatedJitter:
+		upper := time.Duration(math.Min(float64(previous)*3, float64(b.FetchRetryBackoffMax)))
+		return randomDuration(b.FetchRetryBackoffMin, upper)
+	default:
+		return delay
+	}
+}
+
+// randomDuration returns a random duration between min and max, or min if max is not greater.
+func randomDuration(min time.Duration, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(rand.Int63n(int64(max-min)+1))
+}
+
+// retryAfter returns the delay requested by the Retry-After header of a 429 or 503 response, given
+// as a number of seconds or an HTTP date.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// sleepContext waits for the delay, and returns the context's error if it is done first.
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shouldRetryFetch returns true if the fetch which failed with the error should be retried. Fetches
+// are not retried once the caller's context is done, but are if only the fetch timeout has passed.
+// Besides retryable errors, fetches which received an unexpected status which is not an error are
+// retried.
+func shouldRetryFetch(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var requestErr *experiment.RequestError
+	if !errors.As(err, &requestErr) {
+		return false
+	}
+	return requestErr.Retryable || (requestErr.Err == nil && isNonErrorStatus(requestErr.StatusCode))
+}
+
+// isNonErrorStatus returns true if the response status is not an error, such as a redirect which
+// was not followed.
+func isNonErrorStatus(statusCode int) bool {
+	return statusCode > 0 && statusCode < 400
+}
@@ -0,0 +1,216 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryDelay(t *testing.T) {
+	backoff := &RetryBackoff{
+		FetchRetryBackoffMin: 100 * time.Millisecond,
+		FetchRetryBackoffMax: time.Second,
+	}
+	require.Equal(t, 400*time.Millisecond, backoff.retryDelay(400*time.Millisecond, 200*time.Millisecond))
+	backoff.FetchRetryJitter = FullJitter
+	for i := 0; i < 100; i++ {
+		delay := backoff.retryDelay(400*time.Millisecond, 200*time.Millisecond)
+		require.GreaterOrEqual(t, delay, time.Duration(0))
+		require.LessOrEqual(t, delay, 400*time.Millisecond)
+	}
+	require.Equal(t, time.Duration(0), backoff.retryDelay(0, 0))
+	backoff.FetchRetryJitter = DecorrelatedJitter
+	for i := 0; i < 100; i++ {
+		delay := backoff.retryDelay(400*time.Millisecond, 200*time.Millisecond)
+		require.GreaterOrEqual(t, delay, 100*time.Millisecond)
+		require.LessOrEqual(t, delay, 600*time.Millisecond)
+		delay = backoff.retryDelay(400*time.Millisecond, 900*time.Millisecond)
+		require.LessOrEqual(t, delay, time.Second)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	response := func(statusCode int, value string) *http.Response {
+		resp := &http.Response{StatusCode: statusCode, Header: http.Header{}}
+		resp.Header.Set("Retry-After", value)
+		return resp
+	}
+	require.Equal(t, 2*time.Second, retryAfter(response(http.StatusTooManyRequests, "2")))
+	require.Equal(t, 2*time.Second, retryAfter(response(http.StatusServiceUnavailable, "2")))
+	require.Equal(t, time.Duration(0), retryAfter(response(http.StatusInternalServerError, "2")))
+	require.Equal(t, time.Duration(0), retryAfter(response(http.StatusTooManyRequests, "-1")))
+	require.Equal(t, time.Duration(0), retryAfter(response(http.StatusTooManyRequests, "soon")))
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	delay := retryAfter(response(http.StatusTooManyRequests, date))
+	require.Greater(t, delay, 58*time.Second)
+	require.LessOrEqual(t, delay, time.Minute)
+}
+
+func TestClientRetryAttempts(t *testing.T) {
+	client, requests := newTestClient(t, &Config{RetryBackoff: &RetryBackoff{FetchRetries: 2, FetchRetryTimeout: time.Second}},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+	_, err := client.FetchV2(&experiment.User{UserId: "user_id"})
+	var requestErr *experiment.RequestError
+	require.True(t, errors.As(err, &requestErr))
+	require.Equal(t, 3, requestErr.Attempt)
+	require.Equal(t, http.StatusInternalServerError, requestErr.StatusCode)
+	require.Equal(t, client.config.ServerUrl+"/sdk/v2/vardata", requestErr.Endpoint)
+	require.True(t, requestErr.Retryable)
+	require.Equal(t, int32(3), atomic.LoadInt32(requests))
+
+	// Retries stop at the first error which should not be retried.
+	client, requests = newTestClient(t, &Config{RetryBackoff: &RetryBackoff{FetchRetries: 2, FetchRetryTimeout: time.Second}},
+		func(w http.ResponseWriter, r *http.Request) {
+			if atomic.LoadInt32(requests) == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+		})
+	_, err = client.FetchV2(&experiment.User{UserId: "user_id"})
+	require.True(t, errors.As(err, &requestErr))
+	require.Equal(t, 2, requestErr.Attempt)
+	require.Equal(t, http.StatusBadRequest, requestErr.StatusCode)
+	require.False(t, requestErr.Retryable)
+	require.Equal(t, int32(2), atomic.LoadInt32(requests))
+}
+
+func TestClientRetryContextCanceled(t *testing.T) {
+	client, requests := newTestClient(t, &Config{RetryBackoff: &RetryBackoff{
+		FetchRetries:         5,
+		FetchRetryBackoffMin: 10 * time.Second,
+		FetchRetryBackoffMax: 10 * time.Second,
+		FetchRetryTimeout:    time.Second,
+	}}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := client.FetchV2WithContext(&experiment.User{UserId: "user_id"}, ctx)
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.ErrorIs(t, err, context.Canceled)
+	var requestErr *experiment.RequestError
+	require.True(t, errors.As(err, &requestErr))
+	require.Equal(t, 1, requestErr.Attempt)
+	require.Equal(t, http.StatusInternalServerError, requestErr.StatusCode)
+	require.Equal(t, int32(1), atomic.LoadInt32(requests))
+}
+
+func TestClientRetryContextDeadline(t *testing.T) {
+	// A retry which would start after the context's deadline is not waited for.
+	client, requests := newTestClient(t, &Config{RetryBackoff: &RetryBackoff{
+		FetchRetries:         5,
+		FetchRetryBackoffMin: 10 * time.Second,
+		FetchRetryBackoffMax: 10 * time.Second,
+		FetchRetryTimeout:    time.Second,
+	}}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := client.FetchV2WithContext(&experiment.User{UserId: "user_id"}, ctx)
+	require.Less(t, time.Since(start), time.Second)
+	var requestErr *experiment.RequestError
+	require.True(t, errors.As(err, &requestErr))
+	require.Equal(t, http.StatusInternalServerError, requestErr.StatusCode)
+	require.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+	// A fetch which fails because the context's deadline has passed is not retried.
+	client, requests = newTestClient(t, &Config{RetryBackoff: &RetryBackoff{FetchRetries: 5, FetchRetryTimeout: time.Second}},
+		func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client.config.FetchTimeout = time.Second
+	_, err = client.FetchV2WithContext(&experiment.User{UserId: "user_id"}, ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.True(t, errors.As(err, &requestErr))
+	require.False(t, requestErr.Retryable)
+	require.Equal(t, int32(1), atomic.LoadInt32(requests))
+}
+
+func TestClientRetryAfter(t *testing.T) {
+	handler := func(value string) http.HandlerFunc {
+		var requests int32
+		return func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) == 1 {
+				w.Header().Set("Retry-After", value)
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"flag": {"key": "on"}}`))
+		}
+	}
+	backoff := &RetryBackoff{
+		FetchRetries:         1,
+		FetchRetryBackoffMax: 2 * time.Second,
+		FetchRetryTimeout:    time.Second,
+	}
+	client, _ := newTestClient(t, &Config{RetryBackoff: backoff}, handler("1"))
+	start := time.Now()
+	variants, err := client.FetchV2(&experiment.User{UserId: "user_id"})
+	require.NoError(t, err)
+	require.Equal(t, "on", variants["flag"].Key)
+	require.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	// A delay longer than the maximum backoff is not waited for.
+	client, requests := newTestClient(t, &Config{RetryBackoff: backoff}, handler("60"))
+	_, err = client.FetchV2(&experiment.User{UserId: "user_id"})
+	require.ErrorIs(t, err, experiment.ErrRateLimited)
+	var requestErr *experiment.RequestError
+	require.True(t, errors.As(err, &requestErr))
+	require.Equal(t, http.StatusTooManyRequests, requestErr.StatusCode)
+	require.Equal(t, 60*time.Second, requestErr.RetryAfter)
+	require.Equal(t, int32(1), atomic.LoadInt32(requests))
+}
+
+func TestClientRequestError(t *testing.T) {
+	client, requests := newTestClient(t, &Config{RetryBackoff: &RetryBackoff{FetchRetries: 2, FetchRetryTimeout: time.Second}},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	_, err := client.FetchV2(&experiment.User{UserId: "user_id"})
+	require.ErrorIs(t, err, experiment.ErrUnauthorized)
+	require.NotErrorIs(t, err, experiment.ErrRateLimited)
+	var requestErr *experiment.RequestError
+	require.True(t, errors.As(err, &requestErr))
+	require.Equal(t, 1, requestErr.Attempt)
+	require.False(t, requestErr.Retryable)
+	require.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+	// Unexpected statuses which are not errors are retried, but are not retryable errors.
+	client, requests = newTestClient(t, &Config{RetryBackoff: &RetryBackoff{FetchRetries: 1, FetchRetryTimeout: time.Second}},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	_, err = client.FetchV2(&experiment.User{UserId: "user_id"})
+	require.True(t, errors.As(err, &requestErr))
+	require.Equal(t, http.StatusNoContent, requestErr.StatusCode)
+	require.False(t, requestErr.Retryable)
+	require.Equal(t, int32(2), atomic.LoadInt32(requests))
+
+	// Invalid responses are retried.
+	client, requests = newTestClient(t, &Config{RetryBackoff: &RetryBackoff{FetchRetries: 1, FetchRetryTimeout: time.Second}},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{`))
+		})
+	_, err = client.FetchV2(&experiment.User{UserId: "user_id"})
+	require.True(t, errors.As(err, &requestErr))
+	require.Equal(t, http.StatusOK, requestErr.StatusCode)
+	require.Equal(t, 2, requestErr.Attempt)
+	require.Error(t, requestErr.Err)
+	require.Equal(t, int32(2), atomic.LoadInt32(requests))
+}
@@ -0,0 +1,60 @@
+package remote
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/amplitude/experiment-go-server/pkg/experiment"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientVariations(t *testing.T) {
+	var flagKeys []string
+	var failing atomic.Bool
+	client, _ := newTestClient(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		flagKeysJson, _ := base64.StdEncoding.DecodeString(r.Header.Get("X-Amp-Exp-Flag-Keys"))
+		flagKeys = nil
+		_ = json.Unmarshal(flagKeysJson, &flagKeys)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{
+			"enabled": {"key": "on", "value": "true"},
+			"limit": {"key": "on", "value": "on", "payload": 25},
+			"config": {"key": "on", "value": "on", "payload": {"color": "blue"}},
+			"off": {"key": "off", "metadata": {"default": true}}
+		}`))
+	})
+	user := &experiment.User{UserId: "user_id"}
+
+	enabled, err := client.BoolVariation("enabled", user, false)
+	require.NoError(t, err)
+	require.True(t, enabled)
+	// Only the requested flag is fetched.
+	require.Equal(t, []string{"enabled"}, flagKeys)
+	limit, err := client.IntVariation("limit", user, 10)
+	require.NoError(t, err)
+	require.Equal(t, 25, limit)
+	var config struct{ Color string }
+	require.NoError(t, client.JSONVariation("config", user, nil, &config))
+	require.Equal(t, "blue", config.Color)
+
+	value, err := client.StringVariation("off", user, "default")
+	require.Equal(t, "default", value)
+	var variationErr *experiment.VariationError
+	require.True(t, errors.As(err, &variationErr))
+	require.Equal(t, experiment.VariationFlagOff, variationErr.Reason)
+
+	// Fetch errors are returned with the default value.
+	failing.Store(true)
+	number, err := client.FloatVariation("limit", user, 1.5)
+	require.Error(t, err)
+	require.False(t, errors.As(err, &variationErr))
+	require.Equal(t, 1.5, number)
+}
@@ -0,0 +1,43 @@
+package experiment
+
+import "fmt"
+
+// VariationErrorReason is the reason a typed variation returned its default value.
+type VariationErrorReason string
+
+const (
+	// VariationFlagNotFound means the flag was not evaluated for the user, for example because it
+	// does not exist.
+	VariationFlagNotFound VariationErrorReason = "flag not found"
+	// VariationFlagOff means the user was assigned the flag's default variant, or the flag is not
+	// deployed.
+	VariationFlagOff VariationErrorReason = "flag off"
+	// VariationTypeMismatch means the variant's payload or value could not be decoded into the
+	// requested type.
+	VariationTypeMismatch VariationErrorReason = "type mismatch"
+)
+
+// VariationError is returned by the typed variation methods of the clients, such as BoolVariation,
+// together with the supplied default value, when the flag's variant cannot be used.
+type VariationError struct {
+	FlagKey string
+	Reason  VariationErrorReason
+	// Err is the decoding error of a type mismatch, or nil.
+	Err error
+}
+
+func (e *VariationError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("flag %s: %s: %v", e.FlagKey, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("flag %s: %s", e.FlagKey, e.Reason)
+}
+
+func (e *VariationError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrFlagNotFound if the reason is VariationFlagNotFound.
+func (e *VariationError) Is(target error) bool {
+	return target == ErrFlagNotFound && e.Reason == VariationFlagNotFound
+}
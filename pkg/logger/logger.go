@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -26,6 +27,18 @@ type LoggerProvider interface {
 	Error(message string, args ...interface{})
 }
 
+// ContextLoggerProvider is an optional extension of LoggerProvider. If the configured provider
+// implements it, messages logged with a context are passed to these methods instead, so that
+// request-scoped values such as trace IDs can be attached to log lines.
+type ContextLoggerProvider interface {
+	LoggerProvider
+	VerboseContext(ctx context.Context, message string, args ...interface{})
+	DebugContext(ctx context.Context, message string, args ...interface{})
+	InfoContext(ctx context.Context, message string, args ...interface{})
+	WarnContext(ctx context.Context, message string, args ...interface{})
+	ErrorContext(ctx context.Context, message string, args ...interface{})
+}
+
 type Logger struct {
 	level  LogLevel
 	loggerProvider LoggerProvider
@@ -65,6 +78,62 @@ func (l *Logger) Error(format string, args ...interface{}) {
 	}
 }
 
+func (l *Logger) VerboseContext(ctx context.Context, format string, args ...interface{}) {
+	if l.shouldLog(Verbose) {
+		if p, ok := l.loggerProvider.(ContextLoggerProvider); ok {
+			p.VerboseContext(ctx, format, args)
+		} else {
+			l.loggerProvider.Verbose(format, args)
+		}
+	}
+}
+
+func (l *Logger) DebugContext(ctx context.Context, format string, args ...interface{}) {
+	if l.shouldLog(Debug) {
+		if p, ok := l.loggerProvider.(ContextLoggerProvider); ok {
+			p.DebugContext(ctx, format, args)
+		} else {
+			l.loggerProvider.Debug(format, args)
+		}
+	}
+}
+
+func (l *Logger) InfoContext(ctx context.Context, format string, args ...interface{}) {
+	if l.shouldLog(Info) {
+		if p, ok := l.loggerProvider.(ContextLoggerProvider); ok {
+			p.InfoContext(ctx, format, args)
+		} else {
+			l.loggerProvider.Info(format, args)
+		}
+	}
+}
+
+func (l *Logger) WarnContext(ctx context.Context, format string, args ...interface{}) {
+	if l.shouldLog(Warn) {
+		if p, ok := l.loggerProvider.(ContextLoggerProvider); ok {
+			p.WarnContext(ctx, format, args)
+		} else {
+			l.loggerProvider.Warn(format, args)
+		}
+	}
+}
+
+func (l *Logger) ErrorContext(ctx context.Context, format string, args ...interface{}) {
+	if l.shouldLog(Error) {
+		if p, ok := l.loggerProvider.(ContextLoggerProvider); ok {
+			p.ErrorContext(ctx, format, args)
+		} else {
+			l.loggerProvider.Error(format, args)
+		}
+	}
+}
+
+// Enabled reports whether messages at the level are logged. Callers on hot paths can check it before
+// building log arguments, which are allocated even if the message is not logged.
+func (l *Logger) Enabled(level LogLevel) bool {
+	return l.shouldLog(level)
+}
+
 func (l *Logger) shouldLog(level LogLevel) bool {
 	return l.level <= level
 }
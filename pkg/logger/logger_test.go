@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"context"
 	"testing"
 )
 
@@ -194,3 +195,78 @@ func TestLoggerMultipleMessages(t *testing.T) {
 		t.Errorf("Expected 1 Error call, got %d", len(mock.errorCalls))
 	}
 }
+
+type contextKey string
+
+// mockContextLoggerProvider records the contexts passed to context-aware log methods.
+type mockContextLoggerProvider struct {
+	*mockLoggerProvider
+	contexts []context.Context
+}
+
+func (m *mockContextLoggerProvider) VerboseContext(ctx context.Context, format string, args ...interface{}) {
+	m.contexts = append(m.contexts, ctx)
+}
+
+func (m *mockContextLoggerProvider) DebugContext(ctx context.Context, format string, args ...interface{}) {
+	m.contexts = append(m.contexts, ctx)
+}
+
+func (m *mockContextLoggerProvider) InfoContext(ctx context.Context, format string, args ...interface{}) {
+	m.contexts = append(m.contexts, ctx)
+}
+
+func (m *mockContextLoggerProvider) WarnContext(ctx context.Context, format string, args ...interface{}) {
+	m.contexts = append(m.contexts, ctx)
+}
+
+func (m *mockContextLoggerProvider) ErrorContext(ctx context.Context, format string, args ...interface{}) {
+	m.contexts = append(m.contexts, ctx)
+}
+
+// TestLoggerContext tests that contexts are passed to context-aware providers
+func TestLoggerContext(t *testing.T) {
+	mock := &mockContextLoggerProvider{mockLoggerProvider: newMockLoggerProvider()}
+	logger := New(Debug, mock)
+	ctx := context.WithValue(context.Background(), contextKey("trace"), "abc")
+
+	logger.VerboseContext(ctx, "verbose")
+	logger.DebugContext(ctx, "debug")
+	logger.ErrorContext(ctx, "error")
+
+	if len(mock.contexts) != 2 {
+		t.Fatalf("Expected 2 context calls, got %d", len(mock.contexts))
+	}
+	if mock.contexts[0].Value(contextKey("trace")) != "abc" {
+		t.Errorf("Expected context to be passed to provider")
+	}
+	if len(mock.debugCalls) != 0 || len(mock.errorCalls) != 0 {
+		t.Errorf("Expected no calls to non-context methods")
+	}
+}
+
+// TestLoggerContextFallback tests that providers without context support still receive messages
+func TestLoggerContextFallback(t *testing.T) {
+	mock := newMockLoggerProvider()
+	logger := New(Debug, mock)
+
+	logger.DebugContext(context.Background(), "debug")
+	logger.WarnContext(context.Background(), "warn")
+
+	if len(mock.debugCalls) != 1 {
+		t.Errorf("Expected 1 Debug call, got %d", len(mock.debugCalls))
+	}
+	if len(mock.warnCalls) != 1 {
+		t.Errorf("Expected 1 Warn call, got %d", len(mock.warnCalls))
+	}
+}
+
+func TestLoggerEnabled(t *testing.T) {
+	l := New(Warn, newMockLoggerProvider())
+	if l.Enabled(Debug) || l.Enabled(Info) {
+		t.Errorf("expected levels below Warn to be disabled")
+	}
+	if !l.Enabled(Warn) || !l.Enabled(Error) {
+		t.Errorf("expected Warn and above to be enabled")
+	}
+}